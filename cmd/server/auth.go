@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/sha256"
 	"crypto/subtle"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -28,7 +29,7 @@ func authMiddleware(apiSecret string, next http.Handler) http.Handler {
 		// Extract API key from Authorization header.
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Missing or malformed API Key", http.StatusUnauthorized)
+			writeProblem(w, errors.New("missing or malformed API key"), http.StatusUnauthorized)
 			return
 		}
 
@@ -41,7 +42,7 @@ func authMiddleware(apiSecret string, next http.Handler) http.Handler {
 		hashedRequestKey := sha256.Sum256([]byte(requestKey))
 
 		if subtle.ConstantTimeCompare(hashedAPIKey[:], hashedRequestKey[:]) != 1 {
-			http.Error(w, "Invalid or missing API Key", http.StatusUnauthorized)
+			writeProblem(w, errors.New("invalid or missing API key"), http.StatusUnauthorized)
 			return
 		}
 
@@ -4,17 +4,23 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lukasschwab/tiir/pkg/config"
 	"github.com/lukasschwab/tiir/pkg/render"
+	"github.com/lukasschwab/tiir/pkg/store"
 	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/lukasschwab/tiir/pkg/tir"
 	"github.com/sethvargo/go-envconfig"
 )
 
@@ -34,6 +40,16 @@ var (
 		"text/html":             render.HTML,
 	}
 
+	// searchRenderers by negotiated format; see negotiate.
+	searchRenderers = map[string]render.SearchFunction{
+		"json":             render.JSONSearch,
+		"application/json": render.JSONSearch,
+		"plain":            render.PlainSearch,
+		"text/plain":       render.PlainSearch,
+		"html":             render.HTMLSearch,
+		"text/html":        render.HTMLSearch,
+	}
+
 	// acceptPrecedence defines a deterministic order for Accept header
 	// negotiation, checked against the formatRenderers map.
 	acceptPrecedence = []string{
@@ -44,6 +60,89 @@ var (
 	}
 )
 
+// Page sizes for paginated routes, which accept limit and cursor query
+// parameters.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// defaultSearchLimit is the default maximum number of search results.
+const defaultSearchLimit = 50
+
+// negotiate a content type and renderer for r: its format query parameter,
+// then its Accept header, then HTML.
+func negotiate(r *http.Request) (contentType string, renderer render.Function) {
+	// Check for format query parameter first.
+	format := r.URL.Query().Get("format")
+	if renderer, ok := formatRenderers[format]; ok {
+		return format, renderer
+	}
+
+	// Fall back on Accept header.
+	acceptHeader := r.Header.Get("Accept")
+	if acceptHeader != "" {
+		for _, contentType := range acceptPrecedence {
+			if strings.Contains(acceptHeader, contentType) {
+				return contentType, formatRenderers[contentType]
+			}
+		}
+	}
+
+	// Fall back on HTML.
+	return "text/html", render.HTML
+}
+
+// writePage renders page in the format requested by r, with Link headers (and,
+// for HTML, links) to adjacent pages.
+func writePage(w http.ResponseWriter, r *http.Request, page *store.Page) {
+	links := render.Links{Next: pageURL(r, page.Next), Prev: pageURL(r, page.Prev)}
+	if links.Next != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, links.Next))
+	}
+	if links.Prev != "" {
+		w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"`, links.Prev))
+	}
+
+	contentType, renderer := negotiate(r)
+	if contentType == "text/html" || contentType == "html" {
+		renderer = func(texts []*text.Text, to io.Writer) error {
+			return render.HTMLPage(texts, links, to)
+		}
+	}
+	w.Header().Set("Content-Type", fmt.Sprintf("%v; charset=utf-8", contentType))
+	if err := renderer(page.Texts, w); err != nil {
+		log.Printf("error rendering: %v", err)
+	}
+}
+
+// writeProblem responds with a [store.Problem] describing err. The error's kind
+// determines the response status (e.g. 404 for [store.ErrNotFound]); other
+// errors respond with fallback.
+func writeProblem(w http.ResponseWriter, err error, fallback int) {
+	problem := store.NewProblem(err, fallback)
+	log.Printf("responding %d: %v", problem.Status, err)
+	w.Header().Set("Content-Type", store.ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("error encoding problem: %v", err)
+	}
+}
+
+// pageURL is r's URL with its cursor replaced, or empty if cursor is empty.
+// Cursors are positions, so the URL drops r's offset, which only applies to
+// the first page.
+func pageURL(r *http.Request, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	values := r.URL.Query()
+	values.Set("cursor", cursor)
+	values.Del("offset")
+	return (&url.URL{Path: r.URL.Path, RawQuery: values.Encode()}).String()
+}
+
 func main() {
 	cfg, err := config.Load(envconfig.OsLookuper())
 	if err != nil {
@@ -55,70 +154,148 @@ func main() {
 		}
 	}()
 
-	apiSecret := cfg.GetAPISecret()
+	apiSecret, err := cfg.GetAPISecret()
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+	server := &http.Server{
+		Addr:    ":8080",
+		Handler: newHandler(cfg.App, apiSecret),
+	}
 
+	// ctx is canceled on SIGINT/SIGTERM; stop() also cancels it, which we
+	// use to unify signal-driven and error-driven shutdown paths.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Server starting on :8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Server error: %v", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Gracefully shutting down: %v", context.Cause(ctx))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	log.Printf("Shutdown")
+}
+
+// newHandler serves app's texts, requiring apiSecret (if set) for requests
+// that modify them.
+func newHandler(app tir.Interface, apiSecret string) http.Handler {
 	mux := http.NewServeMux()
 
+	// listTexts matching r's query parameters over defaults, one page at a
+	// time.
+	listTexts := func(w http.ResponseWriter, r *http.Request, defaults store.Query) {
+		q, err := store.ParseQuery(r.URL.Query(), defaults)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("invalid query: %w", err), http.StatusBadRequest)
+			return
+		}
+		if q.Limit == 0 {
+			q.Limit = defaultPageSize
+		}
+		q.Limit = min(q.Limit, maxPageSize)
+
+		page, err := store.Paginate(r.Context(), app.Query, q, r.URL.Query().Get("cursor"))
+		var warning *store.Warning
+		if errors.As(err, &warning) {
+			log.Printf("[WARN] listing texts: %v", warning)
+		} else if errors.Is(err, store.ErrInvalidCursor) {
+			writeProblem(w, err, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			writeProblem(w, fmt.Errorf("error listing texts: %w", err), http.StatusInternalServerError)
+			return
+		}
+		writePage(w, r, page)
+	}
+
 	// Root redirect.
 	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/texts", http.StatusFound)
 	})
 
-	// List all texts.
+	// Health check, e.g. for tir config init and load balancers.
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"status":"ok"}`)
+	})
+
+	// List read texts. Query parameters filter, sort, and paginate texts; see
+	// store.ParseQuery.
 	mux.HandleFunc("GET /texts", func(w http.ResponseWriter, r *http.Request) {
-		texts, err := cfg.App.List()
+		listTexts(w, r, tir.ListQuery())
+	})
+
+	// List queued and in-progress texts.
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, r *http.Request) {
+		listTexts(w, r, tir.QueueQuery())
+	})
+
+	// Dedicated route for the JSON feed.
+	mux.HandleFunc("GET /texts/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		q, err := store.ParseQuery(r.URL.Query(), tir.ListQuery())
 		if err != nil {
-			log.Printf("error listing texts: %v", err)
-			http.Error(w, fmt.Sprintf("error listing texts: %v", err), http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("invalid query: %w", err), http.StatusBadRequest)
+			return
+		}
+		texts, err := app.Query(r.Context(), q)
+		var warning *store.Warning
+		if errors.As(err, &warning) {
+			log.Printf("[WARN] listing texts: %v", warning)
+		} else if err != nil {
+			writeProblem(w, fmt.Errorf("error listing texts: %w", err), http.StatusInternalServerError)
 			return
 		}
 
-		// Check for format query parameter first.
-		format := r.URL.Query().Get("format")
-		if format != "" {
-			if renderer, ok := formatRenderers[format]; ok {
-				w.Header().Set("Content-Type", fmt.Sprintf("%v; charset=utf-8", format))
-				if err := renderer(texts, w); err != nil {
-					log.Printf("error rendering: %v", err)
-				}
-				return
-			}
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		if err := render.JSONFeed(texts, w); err != nil {
+			log.Printf("error rendering JSON feed: %v", err)
 		}
+	})
 
-		// Fall back on Accept header.
-		acceptHeader := r.Header.Get("Accept")
-		if acceptHeader != "" {
-			for _, contentType := range acceptPrecedence {
-				if strings.Contains(acceptHeader, contentType) {
-					renderer := formatRenderers[contentType]
-					w.Header().Set("Content-Type", fmt.Sprintf("%v; charset=utf-8", contentType))
-					if err := renderer(texts, w); err != nil {
-						log.Printf("error rendering: %v", err)
-					}
-					return
-				}
+	// Search texts' titles, authors, and notes, most relevant first. Accepts q
+	// and limit query parameters.
+	mux.HandleFunc("GET /texts/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		limit := defaultSearchLimit
+		if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+			parsed, err := strconv.Atoi(rawLimit)
+			if err != nil || parsed <= 0 {
+				writeProblem(w, fmt.Errorf("invalid limit %q", rawLimit), http.StatusBadRequest)
+				return
 			}
+			limit = parsed
 		}
+		limit = min(limit, maxPageSize)
 
-		// Fall back on HTML.
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := render.HTML(texts, w); err != nil {
-			log.Printf("error rendering HTML: %v", err)
+		contentType, _ := negotiate(r)
+		renderer, ok := searchRenderers[contentType]
+		if !ok {
+			writeProblem(w, fmt.Errorf("unsupported search format %q", contentType), http.StatusNotAcceptable)
+			return
 		}
-	})
 
-	// Dedicated route for the JSON feed.
-	mux.HandleFunc("GET /texts/feed.json", func(w http.ResponseWriter, r *http.Request) {
-		texts, err := cfg.App.List()
+		results, err := app.Search(r.Context(), query, limit)
 		if err != nil {
-			log.Printf("error listing texts: %v", err)
-			http.Error(w, fmt.Sprintf("error listing texts: %v", err), http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("error searching texts: %w", err), http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
-		if err := render.JSONFeed(texts, w); err != nil {
-			log.Printf("error rendering JSON feed: %v", err)
+		w.Header().Set("Content-Type", fmt.Sprintf("%v; charset=utf-8", contentType))
+		if err := renderer(query, results, w); err != nil {
+			log.Printf("error rendering: %v", err)
 		}
 	})
 
@@ -126,14 +303,13 @@ func main() {
 	mux.HandleFunc("POST /texts", func(w http.ResponseWriter, r *http.Request) {
 		t := new(text.Text)
 		if err := json.NewDecoder(r.Body).Decode(t); err != nil {
-			http.Error(w, fmt.Sprintf("error parsing request body: %v", err), http.StatusBadRequest)
+			writeProblem(w, fmt.Errorf("error parsing request body: %w", err), http.StatusBadRequest)
 			return
 		}
 
-		created, err := cfg.App.Create(t)
+		created, err := app.Create(r.Context(), t)
 		if err != nil {
-			log.Printf("error writing record: %v", err)
-			http.Error(w, fmt.Sprintf("error writing record: %v", err), http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("error writing record: %w", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -144,16 +320,44 @@ func main() {
 		}
 	})
 
+	// Upsert or delete several texts at once, keeping upserted texts' IDs: all
+	// of them, or none if the store can write atomically. See store.Batch.
+	mux.HandleFunc("POST /texts:batch", func(w http.ResponseWriter, r *http.Request) {
+		batch := new(store.Batch)
+		if err := json.NewDecoder(r.Body).Decode(batch); err != nil {
+			writeProblem(w, fmt.Errorf("error parsing request body: %w", err), http.StatusBadRequest)
+			return
+		} else if len(batch.Upsert) > 0 && len(batch.Delete) > 0 {
+			writeProblem(w, fmt.Errorf("batch can't both upsert and delete texts"), http.StatusBadRequest)
+			return
+		}
+
+		var texts []*text.Text
+		var err error
+		if len(batch.Delete) > 0 {
+			texts, err = app.DeleteMany(r.Context(), batch.Delete)
+		} else {
+			texts, err = app.UpsertMany(r.Context(), batch.Upsert)
+		}
+		if err != nil {
+			writeProblem(w, fmt.Errorf("error writing records: %w", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(store.BatchResult{Texts: texts}); err != nil {
+			log.Printf("error encoding response: %v", err)
+		}
+	})
+
 	// Get text by ID.
 	mux.HandleFunc("GET /texts/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 
-		t, err := cfg.App.Read(id)
+		t, err := app.Read(r.Context(), id)
 		if err != nil {
-			// BODGE: assume the text wasn't found. Makes upsert-adaptation in
-			// store.http easier.
-			log.Printf("error getting record: %v", err)
-			http.Error(w, "Not found", http.StatusNotFound)
+			writeProblem(w, fmt.Errorf("error getting record: %w", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -170,14 +374,13 @@ func main() {
 
 		updates := new(text.Text)
 		if err := json.NewDecoder(r.Body).Decode(updates); err != nil {
-			http.Error(w, fmt.Sprintf("error parsing request body: %v", err), http.StatusBadRequest)
+			writeProblem(w, fmt.Errorf("error parsing request body: %w", err), http.StatusBadRequest)
 			return
 		}
 
-		updated, err := cfg.App.Update(id, updates)
+		updated, err := app.Update(r.Context(), id, updates)
 		if err != nil {
-			log.Printf("error updating record: %v", err)
-			http.Error(w, fmt.Sprintf("error updating record: %v", err), http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("error updating record: %w", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -192,10 +395,9 @@ func main() {
 	mux.HandleFunc("DELETE /texts/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 
-		deleted, err := cfg.App.Delete(id)
+		deleted, err := app.Delete(r.Context(), id)
 		if err != nil {
-			log.Printf("error deleting record: %v", err)
-			http.Error(w, fmt.Sprintf("error deleting record: %v", err), http.StatusInternalServerError)
+			writeProblem(w, fmt.Errorf("error deleting record: %w", err), http.StatusInternalServerError)
 			return
 		}
 
@@ -209,35 +411,5 @@ func main() {
 	mux.Handle("/static/", http.FileServer(http.FS(staticFS)))
 
 	// Wrap with middleware.
-	handler := loggingMiddleware(authMiddleware(apiSecret, mux))
-
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: handler,
-	}
-
-	// ctx is canceled on SIGINT/SIGTERM; stop() also cancels it, which we
-	// use to unify signal-driven and error-driven shutdown paths.
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
-	go func() {
-		log.Printf("Server starting on :8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Server error: %v", err)
-			stop()
-		}
-	}()
-
-	<-ctx.Done()
-	log.Printf("Gracefully shutting down: %v", context.Cause(ctx))
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
-	}
-
-	log.Printf("Shutdown")
+	return loggingMiddleware(authMiddleware(apiSecret, mux))
 }
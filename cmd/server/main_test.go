@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/lukasschwab/tiir/pkg/store/storetest"
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/lukasschwab/tiir/pkg/tir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformance runs the storetest suite against a store.HTTP talking to
+// the server's handler.
+func TestConformance(t *testing.T) {
+	const secret = "secret"
+	storetest.Run(t, func(t *testing.T) store.Interface {
+		server := httptest.NewServer(newHandler(tir.New(store.UseMemory()), secret))
+		t.Cleanup(server.Close)
+		s, err := store.UseHTTP(server.URL, secret)
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestHealth(t *testing.T) {
+	server := httptest.NewServer(newHandler(tir.New(store.UseMemory()), "secret"))
+	t.Cleanup(server.Close)
+	s, err := store.UseHTTP(server.URL, "")
+	require.NoError(t, err)
+	require.NoError(t, s.(*store.HTTP).Health(context.Background()))
+
+	s, err = store.UseHTTP(server.URL+"/nowhere", "")
+	require.NoError(t, err)
+	require.Error(t, s.(*store.HTTP).Health(context.Background()))
+}
+
+func TestListInvalidStatus(t *testing.T) {
+	server := httptest.NewServer(newHandler(tir.New(store.UseMemory()), "secret"))
+	t.Cleanup(server.Close)
+	for _, route := range []string{"/texts", "/queue"} {
+		resp, err := server.Client().Get(server.URL + route + "?format=json&status=finished")
+		require.NoError(t, err)
+		problem := new(store.Problem)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(problem))
+		require.NoError(t, resp.Body.Close())
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, store.ProblemContentType, resp.Header.Get("Content-Type"))
+		for _, status := range text.Statuses {
+			assert.Contains(t, problem.Detail, string(status))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/config"
+	"github.com/mattn/go-isatty"
+)
+
+// AuthCommand manages secrets in the OS keyring.
+type AuthCommand struct {
+	Login AuthLoginCommand `cmd:"" help:"Store a secret, e.g. an API secret, in the OS keyring (or the keyring file in TIR_KEYRING_FILE)."`
+}
+
+// AuthLoginCommand stores a secret in the keyring, for a store whose
+// api_secret_keyring or auth_token_keyring setting names its account. It runs
+// without opening the store, which may not open without the secret.
+type AuthLoginCommand struct {
+	Account string `arg:"" optional:"" help:"Keyring account to store the secret for (default: the account the store's secret is read from, e.g. its api_secret_keyring)."`
+}
+
+func (command *AuthLoginCommand) Run(rt *runtime) error {
+	keyring, account, err := config.Keyring(rt.config[0], rt.config[1:]...)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	} else if command.Account != "" {
+		account = command.Account
+	} else if account == "" {
+		return errors.New("log in: no keyring account is configured; set api_secret_keyring or auth_token_keyring in the store block, or name one, e.g. tir auth login tir.example.com")
+	}
+
+	secret, err := readSecret(fmt.Sprintf("Secret for %v: ", account))
+	if err != nil {
+		return fmt.Errorf("log in: %w", err)
+	} else if secret == "" {
+		return errors.New("log in: secret can't be empty")
+	} else if err := keyring.Set(account, secret); err != nil {
+		return fmt.Errorf("log in: store secret in %v: %w", keyring, err)
+	}
+	fmt.Fprintf(rt.stdout, "Stored the secret for %v in %v.\n", account, keyring)
+	return nil
+}
+
+// readSecret from the terminal, prompting with prompt, or else from stdin,
+// e.g. piped from a password manager.
+func readSecret(prompt string) (string, error) {
+	if isatty.IsTerminal(os.Stdin.Fd()) {
+		return config.ReadPassphrase(prompt)
+	}
+	secret, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"fmt"
+)
+
+// CompactCommand rewrites a log-structured store down to its live records.
+type CompactCommand struct{}
+
+func (command *CompactCommand) Run(rt *runtime) error {
+	if err := rt.cfg.App.Compact(rt.ctx); err != nil {
+		return fmt.Errorf("compact store: %w", err)
+	}
+	return nil
+}
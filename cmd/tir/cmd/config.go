@@ -2,12 +2,22 @@ package cmd
 
 import (
 	"fmt"
+
+	"github.com/lukasschwab/tiir/pkg/config"
 )
 
-// ConfigCommand prints the resolved configuration with secrets masked.
-type ConfigCommand struct{}
+// ConfigCommand prints or checks tir's configuration.
+type ConfigCommand struct {
+	Show     ConfigShowCommand     `cmd:"" default:"1" help:"Print the resolved configuration with secrets masked, its profile, and the available profiles."`
+	Validate ConfigValidateCommand `cmd:"" help:"Check config files for syntax errors, unknown keys, and values of the wrong type."`
+	Schema   ConfigSchemaCommand   `cmd:"" help:"Print the JSON Schema for config files."`
+	Init     ConfigInitCommand     `cmd:"" help:"Write a config file, from a form or from flags."`
+}
+
+// ConfigShowCommand prints the resolved configuration with secrets masked.
+type ConfigShowCommand struct{}
 
-func (command *ConfigCommand) Run(rt *runtime) error {
+func (command *ConfigShowCommand) Run(rt *runtime) error {
 	contents, err := rt.cfg.MaskedJSON()
 	if err != nil {
 		return fmt.Errorf("marshal configuration: %w", err)
@@ -15,3 +25,54 @@ func (command *ConfigCommand) Run(rt *runtime) error {
 	_, err = fmt.Fprintln(rt.stdout, string(contents))
 	return err
 }
+
+// ConfigValidateCommand checks config files against the config schema. It runs
+// without loading the configuration, which fails if a config file is invalid.
+type ConfigValidateCommand struct {
+	Files []string `arg:"" optional:"" type:"existingfile" help:"Config files to check (default: the config files tir loads)."`
+}
+
+func (command *ConfigValidateCommand) Run(rt *runtime) error {
+	paths := command.Files
+	if len(paths) == 0 {
+		var err error
+		if paths, err = config.Paths(); err != nil {
+			return fmt.Errorf("find config files: %w", err)
+		} else if len(paths) == 0 {
+			fmt.Fprintln(rt.stdout, "No config files found.")
+			return nil
+		}
+	}
+
+	count := 0
+	for _, path := range paths {
+		problems, err := config.ValidateFile(path)
+		if err != nil {
+			return fmt.Errorf("validate config: %w", err)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(rt.stdout, "%v: ok\n", path)
+		}
+		for _, problem := range problems {
+			fmt.Fprintln(rt.stdout, problem)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		return fmt.Errorf("validate config: found %d problems", count)
+	}
+	return nil
+}
+
+// ConfigSchemaCommand prints the JSON Schema for config files, including the
+// settings of every registered store type.
+type ConfigSchemaCommand struct{}
+
+func (command *ConfigSchemaCommand) Run(rt *runtime) error {
+	schema, err := config.Schema()
+	if err != nil {
+		return fmt.Errorf("marshal schema: %w", err)
+	}
+	_, err = fmt.Fprintln(rt.stdout, string(schema))
+	return err
+}
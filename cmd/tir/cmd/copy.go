@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/mattn/go-isatty"
+)
+
+// CopyCommand copies every text in the configured store to another store, then
+// verifies the copy.
+type CopyCommand struct {
+	To           string `name:"to" required:"" placeholder:"URI" help:"Store to copy to, e.g. libsql://db.turso.io, file:///path/to/tir.json, or https://tir.example.com."`
+	DryRun       bool   `name:"dry-run" help:"Show what would be copied without copying it."`
+	Overwrite    bool   `xor:"existing" help:"Overwrite records that differ in the destination."`
+	SkipExisting bool   `name:"skip-existing" xor:"existing" help:"Leave records that differ in the destination unchanged."`
+}
+
+func (command *CopyCommand) Run(rt *runtime) error {
+	to, err := rt.cfg.OpenStore(command.To)
+	if err != nil {
+		return fmt.Errorf("open store: %w", err)
+	}
+	defer to.Close()
+
+	opts := store.CopyOptions{Overwrite: command.Overwrite, SkipExisting: command.SkipExisting, DryRun: command.DryRun}
+	if isatty.IsTerminal(os.Stderr.Fd()) {
+		opts.Progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rCopying %v/%v", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+	result, err := rt.cfg.App.Copy(rt.ctx, to, opts)
+	if errors.Is(err, store.ErrConflict) {
+		return fmt.Errorf("copy records: %w; use --overwrite or --skip-existing", err)
+	} else if err != nil {
+		return fmt.Errorf("copy records: %w", err)
+	}
+
+	verb := "Copied"
+	if command.DryRun {
+		verb = "Would copy"
+	}
+	fmt.Fprintf(rt.stdout, "%v %v new, %v overwritten, %v skipped, %v unchanged.\n",
+		verb, result.Created, result.Overwritten, len(result.Skipped), result.Unchanged)
+	for from, to := range result.IDs {
+		fmt.Fprintf(rt.stdout, "Destination stored %v as %v.\n", from, to)
+	}
+	if command.DryRun {
+		return nil
+	}
+
+	mismatches, err := rt.cfg.App.Verify(rt.ctx, to, result)
+	if err != nil {
+		return fmt.Errorf("verify copy: %w", err)
+	}
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(rt.stdout, "%v: %v\n", mismatch.ID, mismatch.Reason)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("verify copy: %v records don't match", len(mismatches))
+	}
+	fmt.Fprintln(rt.stdout, "Verified every record.")
+	return nil
+}
@@ -26,12 +26,18 @@ func (command *CreateCommand) Run(rt *runtime) error {
 }
 
 func createFromURL(rt *runtime, url string) error {
+	return createFrom(rt, metadata(url))
+}
+
+// metadata for the text at url, or a text with only the URL set if its
+// metadata can't be read.
+func metadata(url string) *text.Text {
 	initial, err := web.WebMetadata(url)
 	if err != nil {
 		log.Printf("couldn't read %q; continuing without metadata: %v", url, err)
-		initial = &text.Text{URL: url}
+		return &text.Text{URL: url}
 	}
-	return createFrom(rt, initial)
+	return initial
 }
 
 func createFrom(rt *runtime, initial *text.Text) error {
@@ -39,7 +45,7 @@ func createFrom(rt *runtime, initial *text.Text) error {
 	if err != nil {
 		return fmt.Errorf("run editor: %w", err)
 	}
-	created, err := rt.cfg.App.Create(final)
+	created, err := rt.cfg.App.Create(rt.ctx, final)
 	if err != nil {
 		return fmt.Errorf("create record: %w", err)
 	}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// DBCommand manages a libsql store's database.
+type DBCommand struct {
+	Migrate DBMigrateCommand `cmd:"" help:"Apply pending schema migrations (libsql stores only)."`
+}
+
+// DBMigrateCommand applies schema migrations. tir applies them automatically
+// when it opens a store, unless store.migrations is "manual"; this command
+// opens the store without migrating it, so it sees the schema as it is.
+type DBMigrateCommand struct {
+	Status bool `help:"Show applied and pending migrations without applying any."`
+	To     int  `placeholder:"N" help:"Migrate to schema version N, rather than the latest version."`
+}
+
+func (command *DBMigrateCommand) Run(rt *runtime) error {
+	migrator, err := rt.cfg.App.Migrator()
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if !command.Status {
+		if err := migrator.Migrate(rt.ctx, command.To); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	migrations, err := migrator.Migrations(rt.ctx)
+	if err != nil {
+		return fmt.Errorf("list migrations: %w", err)
+	}
+	for _, migration := range migrations {
+		status := "pending"
+		if !migration.AppliedAt.IsZero() {
+			status = "applied " + migration.AppliedAt.Local().Format(time.DateTime)
+		} else if migration.Applied {
+			status = "applied"
+		}
+		if _, err := fmt.Fprintf(rt.stdout, "%4d %-24v %v\n", migration.Version, migration.Name, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,7 +11,7 @@ type DeleteCommand struct {
 }
 
 func (command *DeleteCommand) Run(rt *runtime) error {
-	deleted, err := rt.cfg.App.Delete(command.ID)
+	deleted, err := rt.cfg.App.Delete(rt.ctx, command.ID)
 	if err != nil {
 		return fmt.Errorf("delete record: %w", err)
 	}
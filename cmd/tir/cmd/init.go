@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/lukasschwab/tiir/pkg/config"
+	"github.com/sethvargo/go-envconfig"
+)
+
+// ConfigInitCommand writes a config file, from a form or from flags. It runs
+// without loading the configuration, which it may replace.
+type ConfigInitCommand struct {
+	NonInteractive bool   `name:"non-interactive" help:"Don't prompt: configure the store with --store-uri, or --store and its flags, e.g. --file-location or --base-url, and the editor with --editor."`
+	Output         string `short:"o" type:"path" placeholder:"PATH" help:"Config file to write (default: $HOME/.tir.config). Files named .yaml, .yml, or .toml are written in those formats."`
+	Force          bool   `help:"Overwrite the config file if it exists."`
+	KeepSecret     string `name:"keep-secret" enum:"keyring,config" default:"keyring" help:"Where --non-interactive keeps the store's secret, e.g. --api-secret: the OS keyring (keyring), or the config file (config)."`
+	NoCheck        bool   `name:"no-check" help:"Don't check the store: that its file is writable, its database reachable, or its server healthy."`
+}
+
+// Where to keep a store's secret.
+const (
+	keepInKeyring = "keyring"
+	keepInCommand = "command"
+	keepInFile    = "file"
+	keepInConfig  = "config"
+)
+
+func (command *ConfigInitCommand) Run(rt *runtime) error {
+	path := command.Output
+	if path == "" {
+		var err error
+		if path, err = config.UserPath(); err != nil {
+			return fmt.Errorf("init config: %w", err)
+		}
+	}
+	_, err := os.Stat(path)
+	exists := err == nil
+
+	setup, err := config.NewSetup(rt.config[0])
+	if err != nil {
+		return fmt.Errorf("init config: %w", err)
+	}
+	keep := command.KeepSecret
+	if command.NonInteractive {
+		if exists && !command.Force {
+			return fmt.Errorf("init config: %v exists; pass --force to overwrite it", path)
+		} else if !command.NoCheck {
+			if err := setup.Check(rt.ctx); err != nil {
+				return fmt.Errorf("check store: %w", err)
+			}
+		}
+	} else {
+		var write bool
+		if setup, keep, write, err = command.prompt(rt.ctx, rt.config[0], path, exists); err != nil {
+			return fmt.Errorf("init config: %w", err)
+		} else if !write {
+			fmt.Fprintf(rt.stdout, "Didn't write %v.\n", path)
+			return nil
+		}
+	}
+
+	var accounts []string
+	keyring := config.OpenKeyring(rt.config...)
+	if keep == keepInKeyring {
+		if accounts, err = setup.KeepSecrets(keyring); err != nil {
+			return fmt.Errorf("init config: %w", err)
+		}
+	}
+	contents, err := setup.Marshal(path)
+	if err != nil {
+		return fmt.Errorf("init config: %w", err)
+	} else if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("init config: %w", err)
+	} else if err := os.WriteFile(path, contents, 0o600); err != nil {
+		return fmt.Errorf("init config: %w", err)
+	}
+	fmt.Fprintf(rt.stdout, "Wrote %v.\n", path)
+	for _, account := range accounts {
+		fmt.Fprintf(rt.stdout, "Stored the secret for %v in %v.\n", account, keyring)
+	}
+	return nil
+}
+
+// prompt for the config file's settings, starting from those in flags, and
+// whether to write it to path. The form checks the store before writing.
+func (command *ConfigInitCommand) prompt(ctx context.Context, flags envconfig.Lookuper, path string, exists bool) (setup config.Setup, keep string, write bool, err error) {
+	if setup, err = config.NewSetup(flags); err != nil {
+		return setup, "", false, err
+	}
+	if err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Title("Store").
+				Description("Where tir keeps the texts you record.").
+				Options(huh.NewOptions(config.StoreTypes()...)...).
+				Value(&setup.Store),
+			huh.NewSelect[string]().
+				Title("Editor").
+				Description("How you edit texts: vim, or forms in the terminal.").
+				Options(huh.NewOptions("tea", "huh", "vim")...).
+				Value(&setup.Editor),
+		),
+	).RunWithContext(ctx); err != nil {
+		return setup, "", false, err
+	}
+
+	// Start from the flags' settings for the chosen store.
+	chosen := envconfig.MapLookuper(map[string]string{"TIR_STORE_TYPE": setup.Store, "TIR_EDITOR": setup.Editor})
+	if setup, err = config.NewSetup(envconfig.MultiLookuper(chosen, flags)); err != nil {
+		return setup, "", false, err
+	}
+	settings := config.SetupSettings(setup.Store)
+	values := make([]string, len(settings))
+	var fields []huh.Field
+	var secrets []*huh.Group
+	keep = keepInKeyring
+	// The form asks for the first secret setting, if any, and where to keep it.
+	secretIndex := -1
+	var secretSource string
+	for i, setting := range settings {
+		values[i] = setup.Settings[setting.Key]
+		if setting.Secret {
+			if secretIndex >= 0 {
+				continue
+			}
+			secretIndex = i
+			secrets = append(secrets,
+				huh.NewGroup(
+					huh.NewSelect[string]().
+						Title(fmt.Sprintf("Where should tir read the %v from?", setting.Key)).
+						Options(
+							huh.NewOption("The OS keyring", keepInKeyring),
+							huh.NewOption("A command's output, e.g. pass show tir", keepInCommand),
+							huh.NewOption("A file", keepInFile),
+							huh.NewOption("This config file, in plaintext", keepInConfig),
+						).
+						Value(&keep),
+				),
+				huh.NewGroup(
+					huh.NewInput().
+						Title(setting.Key).
+						Description("Leave it empty if the store doesn't need it.").
+						EchoMode(huh.EchoModePassword).
+						Value(&values[i]),
+				).WithHideFunc(func() bool { return keep != keepInKeyring && keep != keepInConfig }),
+				huh.NewGroup(
+					huh.NewInput().
+						TitleFunc(func() string {
+							if keep == keepInCommand {
+								return "Command printing the " + setting.Key
+							}
+							return "File containing the " + setting.Key
+						}, &keep).
+						Value(&secretSource),
+				).WithHideFunc(func() bool { return keep != keepInCommand && keep != keepInFile }),
+			)
+			continue
+		}
+		input := huh.NewInput().Title(setting.Key).Value(&values[i])
+		if setting.Location {
+			input = input.Validate(func(value string) error {
+				if strings.TrimSpace(value) == "" {
+					return fmt.Errorf("%v stores need a %v", setup.Store, setting.Key)
+				}
+				return nil
+			})
+		}
+		fields = append(fields, input)
+	}
+
+	// withValues is setup with the form's values.
+	withValues := func() config.Setup {
+		result := config.Setup{Store: setup.Store, Editor: setup.Editor, Settings: make(map[string]string)}
+		for i, setting := range settings {
+			key := setting.Key
+			if i == secretIndex && keep == keepInCommand {
+				result.Settings[key+"_command"] = secretSource
+			} else if i == secretIndex && keep == keepInFile {
+				result.Settings[key+"_file"] = secretSource
+			} else if values[i] != "" {
+				result.Settings[key] = values[i]
+			}
+		}
+		return result
+	}
+
+	var groups []*huh.Group
+	if len(fields) > 0 {
+		groups = append(groups, huh.NewGroup(fields...).Title(fmt.Sprintf("%v store", setup.Store)))
+	}
+	groups = append(groups, secrets...)
+	title := "Write " + path + "?"
+	if exists {
+		title = "Overwrite " + path + "?"
+	}
+	groups = append(groups, huh.NewGroup(
+		huh.NewConfirm().
+			Title(title).
+			Description("tir checks the store first.").
+			Value(&write).
+			Validate(func(write bool) error {
+				if !write || command.NoCheck {
+					return nil
+				} else if err := withValues().Check(ctx); err != nil {
+					return fmt.Errorf("%w; fix it, or pass --no-check", err)
+				}
+				return nil
+			}),
+	))
+	if err := huh.NewForm(groups...).RunWithContext(ctx); errors.Is(err, huh.ErrUserAborted) {
+		return setup, keep, false, nil
+	} else if err != nil {
+		return setup, keep, false, err
+	}
+	return withValues(), keep, write, nil
+}
@@ -2,14 +2,19 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/lukasschwab/tiir/pkg/render"
+	"github.com/lukasschwab/tiir/pkg/store"
 	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/lukasschwab/tiir/pkg/tir"
 )
 
 var (
@@ -17,19 +22,43 @@ var (
 )
 
 type ListCommand struct {
-	Output string `short:"o" enum:"tea,plain,json,jsonfeed,html" default:"tea" help:"Output format for listed texts (tea, plain, json, jsonfeed, html)."`
+	Output     string `short:"o" enum:"tea,plain,json,jsonfeed,html" default:"tea" help:"Output format for listed texts (tea, plain, json, jsonfeed, html)."`
+	queryFlags `embed:""`
 }
 
 func (command *ListCommand) Run(rt *runtime) error {
-	renderFunc, ok := outputRenderers[outputFormat(command.Output)]
-	if !ok {
-		return invalidOption("output format", command.Output, rendererOptions)
+	q, err := command.query(tir.ListQuery())
+	if err != nil {
+		return err
 	}
-
-	texts, err := rt.cfg.App.List()
+	texts, err := queryTexts(rt, q)
 	if err != nil {
 		return fmt.Errorf("list texts: %w", err)
 	}
+	return renderTexts(rt, command.Output, texts)
+}
+
+// queryTexts lists the texts matching q, printing warnings, e.g. about files
+// the store skipped, to stderr.
+func queryTexts(rt *runtime, q store.Query) ([]*text.Text, error) {
+	texts, err := rt.cfg.App.Query(rt.ctx, q)
+	var warning *store.Warning
+	if errors.As(err, &warning) {
+		for _, problem := range warning.Problems {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", problem)
+		}
+		return texts, nil
+	}
+	return texts, err
+}
+
+// renderTexts in the named output format, printing the user's selection (if
+// the format is interactive).
+func renderTexts(rt *runtime, output string, texts []*text.Text) error {
+	renderFunc, ok := outputRenderers[outputFormat(output)]
+	if !ok {
+		return invalidOption("output format", output, rendererOptions)
+	}
 
 	selectedText, err := renderFunc(texts, rt.stdout)
 	if err != nil {
@@ -115,7 +144,9 @@ func (i item) Title() string {
 }
 
 func (i item) Description() string { return i.Text.Note }
-func (i item) FilterValue() string { return i.Title() }
+func (i item) FilterValue() string {
+	return strings.Join(append([]string{i.Title()}, i.Text.Tags...), " ")
+}
 
 type model struct {
 	list list.Model
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// LogCommand prints the history of a text, for stores that record it.
+type LogCommand struct {
+	ID string `arg:"" help:"The record whose history to show."`
+}
+
+// shortRevisionLength abbreviates revision IDs, like git's short hashes.
+const shortRevisionLength = 8
+
+func (command *LogCommand) Run(rt *runtime) error {
+	revisions, err := rt.cfg.App.History(rt.ctx, command.ID)
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+	for _, revision := range revisions {
+		id := revision.ID
+		if len(id) > shortRevisionLength {
+			id = id[:shortRevisionLength]
+		}
+		timestamp := revision.Timestamp.Local().Format(time.DateTime)
+		if _, err := fmt.Fprintf(rt.stdout, "%v %v %v: %v\n", id, timestamp, revision.Author, revision.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -27,12 +27,12 @@ func (command *MigrateCommand) Run(rt *runtime) error {
 
 	p.Parse()
 	log.Printf("Writing %v texts to app", len(p.parsed))
-	for _, text := range p.parsed {
-		created, err := rt.cfg.App.Create(text)
-		if err != nil {
-			return fmt.Errorf("create text: %w", err)
-		}
-		log.Printf("Created text %v: %+v", created.ID, created)
+	created, err := rt.cfg.App.CreateMany(rt.ctx, p.parsed)
+	if err != nil {
+		return fmt.Errorf("create texts: %w", err)
+	}
+	for _, text := range created {
+		log.Printf("Created text %v: %+v", text.ID, text)
 	}
 	log.Printf("Wrote %v texts to app", len(p.parsed))
 	return nil
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+)
+
+// queryFlags narrow, sort, and paginate listed texts; see [store.Query].
+type queryFlags struct {
+	Tag    string `short:"t" help:"Only list texts with this tag."`
+	Author string `help:"Only list texts whose author contains this string."`
+	URL    string `name:"url" help:"Only list texts whose URL contains this string."`
+	Domain string `help:"Only list texts from this domain or its subdomains."`
+	Since  string `help:"Only list texts at or after this date (2006-01-02) or RFC 3339 time."`
+	Until  string `help:"Only list texts before this date (2006-01-02) or RFC 3339 time."`
+	Match  string `short:"m" help:"Only list texts whose title, author, or note contains this string."`
+	Sort   string `enum:",timestamp,title,author" default:"" help:"Field to sort by (timestamp, title, author)."`
+	Order  string `enum:",asc,desc" default:"" help:"Sort direction (asc, desc)."`
+	Limit  int    `help:"Maximum number of texts to list."`
+	Offset int    `help:"Number of texts to skip."`
+}
+
+// query applies flags over defaults.
+func (flags *queryFlags) query(defaults store.Query) (store.Query, error) {
+	q := defaults
+	q.Tag = flags.Tag
+	q.Author = flags.Author
+	q.URL = flags.URL
+	q.Domain = flags.Domain
+	q.Match = flags.Match
+	q.Limit = flags.Limit
+	q.Offset = flags.Offset
+	if flags.Sort != "" {
+		q.Sort = store.SortField(flags.Sort)
+	}
+
+	var err error
+	if q.Since, err = store.ParseTime(flags.Since); err != nil {
+		return q, fmt.Errorf("invalid --since: %w", err)
+	} else if q.Until, err = store.ParseTime(flags.Until); err != nil {
+		return q, fmt.Errorf("invalid --until: %w", err)
+	} else if flags.Order == "" {
+		return q, nil
+	} else if q.Direction, err = store.ParseDirection(flags.Order); err != nil {
+		return q, err
+	}
+	return q, nil
+}
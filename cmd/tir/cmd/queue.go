@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/lukasschwab/tiir/pkg/tir"
+)
+
+// QueueCommand manages texts you haven't finished reading yet.
+type QueueCommand struct {
+	List    QueueListCommand    `cmd:"" default:"withargs" help:"List the texts in your queue, oldest first."`
+	Add     QueueAddCommand     `cmd:"" help:"Queue texts to read later."`
+	Start   QueueStartCommand   `cmd:"" help:"Mark a queued text as in progress."`
+	Abandon QueueAbandonCommand `cmd:"" help:"Give up on a queued text without recording it as read."`
+}
+
+type QueueListCommand struct {
+	Output     string `short:"o" enum:"tea,plain,json,jsonfeed,html" default:"tea" help:"Output format for listed texts (tea, plain, json, jsonfeed, html)."`
+	queryFlags `embed:""`
+}
+
+func (command *QueueListCommand) Run(rt *runtime) error {
+	q, err := command.query(tir.QueueQuery())
+	if err != nil {
+		return err
+	}
+	texts, err := queryTexts(rt, q)
+	if err != nil {
+		return fmt.Errorf("list queue: %w", err)
+	}
+	return renderTexts(rt, command.Output, texts)
+}
+
+type QueueAddCommand struct {
+	URLs []string `arg:"" name:"url" help:"URLs to queue."`
+}
+
+// Run queues each URL without prompting unless its metadata is incomplete.
+func (command *QueueAddCommand) Run(rt *runtime) error {
+	for _, url := range command.URLs {
+		initial := metadata(url)
+		initial.Status = text.StatusQueued
+		if initial.Validate() != nil {
+			final, err := initial.EditWith(rt.cfg.Editor)
+			if err != nil {
+				return fmt.Errorf("run editor: %w", err)
+			}
+			// Editors needn't preserve the status.
+			final.Status = text.StatusQueued
+			initial = final
+		}
+		created, err := rt.cfg.App.Create(rt.ctx, initial)
+		if err != nil {
+			return fmt.Errorf("queue record: %w", err)
+		}
+		log.Printf("successfully queued record %v: %v", created.ID, created.Title)
+	}
+	return nil
+}
+
+type QueueStartCommand struct {
+	ID string `arg:"" name:"id" help:"The record to start reading."`
+}
+
+func (command *QueueStartCommand) Run(rt *runtime) error {
+	return setStatus(rt, command.ID, text.StatusReading)
+}
+
+type QueueAbandonCommand struct {
+	ID string `arg:"" name:"id" help:"The record to abandon."`
+}
+
+func (command *QueueAbandonCommand) Run(rt *runtime) error {
+	return setStatus(rt, command.ID, text.StatusAbandoned)
+}
+
+func setStatus(rt *runtime, id string, status text.Status) error {
+	updated, err := rt.cfg.App.Update(rt.ctx, id, &text.Text{Status: status})
+	if err != nil {
+		return fmt.Errorf("update record: %w", err)
+	}
+	log.Printf("successfully marked record %v %v", updated.ID, updated.Status)
+	return nil
+}
+
+// DoneCommand moves a text from the queue into the log of texts you read.
+type DoneCommand struct {
+	ID string `arg:"" name:"id" help:"The queued record you finished reading."`
+}
+
+func (command *DoneCommand) Run(rt *runtime) error {
+	initial, err := rt.cfg.App.Read(rt.ctx, command.ID)
+	if err != nil {
+		return fmt.Errorf("read record %q: %w", command.ID, err)
+	}
+	// Edit as a read text, so the editor asks for a note.
+	initial.Status = text.StatusRead
+	final, err := initial.EditWith(rt.cfg.Editor)
+	if err != nil {
+		return fmt.Errorf("run editor: %w", err)
+	}
+	finished, err := rt.cfg.App.Finish(rt.ctx, command.ID, final)
+	if err != nil {
+		return fmt.Errorf("finish record: %w", err)
+	}
+	repr, err := json.MarshalIndent(finished, "", "\t")
+	if err != nil {
+		return fmt.Errorf("represent finished record %q: %w", finished.ID, err)
+	}
+	log.Printf("successfully finished record %v: %s", finished.ID, repr)
+	return nil
+}
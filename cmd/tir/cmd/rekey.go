@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lukasschwab/tiir/pkg/config"
+	"github.com/lukasschwab/tiir/pkg/store"
+)
+
+// RekeyCommand re-encrypts an encrypted_file store with a new passphrase or key
+// file. The store opens with the configured key, as usual.
+type RekeyCommand struct {
+	NewKeyFile    string `name:"new-key-file" type:"path" placeholder:"PATH" help:"Encrypt with the key in this file, generating it if it doesn't exist, rather than a new passphrase."`
+	NewPassphrase string `name:"new-passphrase" env:"TIR_STORE_NEW_PASSPHRASE" hidden:"" help:"New passphrase; read from TIR_STORE_NEW_PASSPHRASE, or prompted for."`
+}
+
+func (command *RekeyCommand) Run(rt *runtime) error {
+	key, err := command.newKey()
+	if err != nil {
+		return fmt.Errorf("rekey: %w", err)
+	} else if err := rt.cfg.App.Rekey(rt.ctx, key); err != nil {
+		return fmt.Errorf("rekey: %w", err)
+	}
+
+	if command.NewKeyFile != "" {
+		fmt.Fprintf(rt.stdout, "Rekeyed the store. Set %v to %v to open it.\n", config.KeyEncryptedFileStoreKeyFile, command.NewKeyFile)
+	} else {
+		fmt.Fprintf(rt.stdout, "Rekeyed the store. Open it with the new passphrase (and without %v).\n", config.KeyEncryptedFileStoreKeyFile)
+	}
+	return nil
+}
+
+// newKey to encrypt the store with: from the new key file, the new
+// passphrase, or a passphrase the user enters twice.
+func (command *RekeyCommand) newKey() (store.Key, error) {
+	if command.NewKeyFile != "" {
+		if _, err := os.Stat(command.NewKeyFile); errors.Is(err, os.ErrNotExist) {
+			return store.GenerateKeyFile(command.NewKeyFile)
+		}
+		return store.ReadKeyFile(command.NewKeyFile)
+	} else if command.NewPassphrase != "" {
+		return store.Passphrase(command.NewPassphrase), nil
+	}
+
+	passphrase, err := config.ReadPassphrase("New passphrase: ")
+	if err != nil {
+		return store.Key{}, err
+	} else if passphrase == "" {
+		return store.Key{}, errors.New("passphrase can't be empty")
+	}
+	confirmation, err := config.ReadPassphrase("Confirm new passphrase: ")
+	if err != nil {
+		return store.Key{}, err
+	} else if confirmation != passphrase {
+		return store.Key{}, errors.New("passphrases don't match")
+	}
+	return store.Passphrase(passphrase), nil
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/alecthomas/kong"
@@ -14,10 +16,14 @@ import (
 
 // CLI describes tir's command line interface.
 type CLI struct {
-	Verbose bool `short:"v" help:"Enable verbose logging."`
+	Verbose bool    `short:"v" help:"Enable verbose logging."`
+	Profile *string `short:"p" help:"Configuration profile to use, from the profiles in your config files." env:"TIR_PROFILE"`
 
-	Store            *string `short:"s" enum:"file,memory,http,libsql" help:"Store to use (file, memory, http, libsql)."`
-	FileLocation     *string `name:"file-location" help:"File to use when store is file."`
+	Store            *string `short:"s" enum:"${store_types}" help:"Store to use (${store_list})."`
+	StoreURI         *string `name:"store-uri" placeholder:"URI" help:"Store to use, by URI, e.g. file:///home/me/.tir.json, https://tir.example.com/?secret_env=TIR_API_SECRET, libsql://db.turso.io, or memory:."`
+	FileLocation     *string `name:"file-location" help:"File to use when store is file, encrypted_file, jsonl, or bolt, or directory when store is markdown or git."`
+	KeyFile          *string `name:"key-file" help:"Key file to use when store is encrypted_file, rather than a passphrase."`
+	Remote           *string `name:"remote" help:"Git remote to pull from and push to when store is git."`
 	BaseURL          *string `name:"base-url" help:"Service URL to use when store is http."`
 	APISecret        *string `name:"api-secret" help:"API secret to use when store is http."`
 	ConnectionString *string `name:"connection-string" help:"Connection string to use when store is libsql."`
@@ -25,18 +31,33 @@ type CLI struct {
 
 	Create  CreateCommand  `cmd:"" help:"Record a text you read."`
 	List    ListCommand    `cmd:"" help:"List all the texts you recorded reading."`
-	Config  ConfigCommand  `cmd:"" help:"Print the resolved configuration."`
+	Search  SearchCommand  `cmd:"" help:"Search the titles, authors, and notes of texts you recorded."`
+	Queue   QueueCommand   `cmd:"" help:"Manage texts you plan to read."`
+	Done    DoneCommand    `cmd:"" help:"Record that you finished reading a queued text."`
+	Config  ConfigCommand  `cmd:"" help:"Print or check the configuration."`
+	Compact CompactCommand `cmd:"" help:"Rewrite the store without obsolete records (jsonl stores only)."`
 	Update  UpdateCommand  `cmd:"" aliases:"edit" help:"Update your record of a text you read."`
 	Delete  DeleteCommand  `cmd:"" help:"Delete your record of a text you read."`
+	Log     LogCommand     `cmd:"" help:"Show the history of a record (git stores only)."`
+	Sync    SyncCommand    `cmd:"" help:"Replay changes made while a cached remote store was unavailable, or sync with another store."`
+	Copy    CopyCommand    `cmd:"" help:"Copy every record to another store, then verify the copy."`
+	DB      DBCommand      `cmd:"" name:"db" help:"Manage the store's database (libsql stores only)."`
+	Rekey   RekeyCommand   `cmd:"" help:"Re-encrypt the store with a new passphrase or key file (encrypted_file stores only)."`
+	Auth    AuthCommand    `cmd:"" help:"Manage secrets in the OS keyring."`
 	Migrate MigrateCommand `cmd:"" help:"Batch-create records from an existing tir HTML file."`
 }
 
 type runtime struct {
-	cfg    *config.Config
+	// ctx is canceled when the user interrupts tir, e.g. with Ctrl-C.
+	ctx context.Context
+	cfg *config.Config
+	// config is where cfg is loaded from, for commands that run without it.
+	config []envconfig.Lookuper
 	stdout io.Writer
 }
 
-func (cli CLI) configLookuper() envconfig.Lookuper {
+// configLookuper maps cli's flags to configuration keys for running command.
+func (cli CLI) configLookuper(command string) envconfig.Lookuper {
 	values := make(map[string]string)
 	put := func(key string, value *string) {
 		if value != nil {
@@ -44,12 +65,20 @@ func (cli CLI) configLookuper() envconfig.Lookuper {
 		}
 	}
 
+	put("TIR_PROFILE", cli.Profile)
 	put("TIR_STORE_TYPE", cli.Store)
+	put("TIR_STORE", cli.StoreURI)
 	put("TIR_STORE_PATH", cli.FileLocation)
+	put("TIR_STORE_REMOTE", cli.Remote)
 	put("TIR_STORE_BASE_URL", cli.BaseURL)
 	put("TIR_API_SECRET", cli.APISecret)
 	put("TIR_CONNECTION_STRING", cli.ConnectionString)
+	put("TIR_STORE_KEY_FILE", cli.KeyFile)
 	put("TIR_EDITOR", cli.Editor)
+	if strings.HasPrefix(command, "db migrate") {
+		// Open the store as it is; the command migrates it.
+		values["TIR_STORE_MIGRATIONS"] = string(config.MigrationsManual)
+	}
 	return envconfig.MapLookuper(values)
 }
 
@@ -62,30 +91,51 @@ func Execute() {
 
 By default, it writes a JSON collection to $HOME/.tir.json with an interactive
 CLI for adding readings. Configure tir with /etc/tir/.tir.config,
-$HOME/.tir.config, TIR_* environment variables, or the flags below.`),
+$HOME/.tir.config, $XDG_CONFIG_HOME/tir/config.{json,yaml,toml}, TIR_*
+environment variables, or the flags below.
+
+`+config.StoreHelp()),
+		kong.Vars{
+			"store_types": strings.Join(config.StoreTypes(), ","),
+			"store_list":  optionList(config.StoreTypes()),
+		},
 		kong.UsageOnError(),
 	)
 	if err != nil {
 		log.Fatalf("build command line parser: %v", err)
 	}
 
-	ctx, err := parser.Parse(os.Args[1:])
+	kongCtx, err := parser.Parse(os.Args[1:])
 	parser.FatalIfErrorf(err)
 	if !cli.Verbose {
 		log.SetOutput(io.Discard)
 	}
 
-	cfg, err := config.Load(cli.configLookuper(), envconfig.OsLookuper())
-	if err != nil {
-		log.Fatalf("error loading config: %v", err)
+	var cfg *config.Config
+	command := kongCtx.Command()
+	lookupers := []envconfig.Lookuper{cli.configLookuper(command), envconfig.OsLookuper()}
+	if !strings.HasPrefix(command, "config validate") && command != "config schema" && command != "config init" && !strings.HasPrefix(command, "auth login") {
+		// Checking and writing config files, and storing the secret the store
+		// needs, mustn't fail on loading the configuration.
+		cfg, err = config.Load(lookupers[0], lookupers[1:]...)
+		// Report errors loading config, e.g. a wrong passphrase, even without -v.
+		parser.FatalIfErrorf(err, "load config")
 	}
-	defer func() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err = kongCtx.Run(&runtime{ctx: ctx, cfg: cfg, config: lookupers, stdout: os.Stdout})
+	interrupted := ctx.Err() != nil
+	stop()
+
+	if cfg != nil {
 		if err := cfg.App.Close(); err != nil {
 			log.Printf("error closing app: %v", err)
 		}
-	}()
-
-	if err := ctx.Run(&runtime{cfg: cfg, stdout: os.Stdout}); err != nil {
+	}
+	if err != nil && interrupted {
+		// Canceled operations fail with context errors; don't report them.
+		log.Printf("interrupted: %v", err)
+		os.Exit(130)
+	} else if err != nil {
 		log.Fatalf("%v", err)
 	}
 }
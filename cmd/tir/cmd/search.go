@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/render"
+)
+
+type SearchCommand struct {
+	Query  []string `arg:"" help:"Terms to search for; results contain every term."`
+	Output string   `short:"o" enum:"plain,json,html" default:"plain" help:"Output format for results (plain, json, html)."`
+	Limit  int      `short:"n" default:"20" help:"Maximum number of results."`
+}
+
+// searchRenderers by output format.
+var searchRenderers = map[outputFormat]render.SearchFunction{
+	OutputPlain: render.PlainSearch,
+	OutputJSON:  render.JSONSearch,
+	OutputHTML:  render.HTMLSearch,
+}
+
+func (command *SearchCommand) Run(rt *runtime) error {
+	renderer, ok := searchRenderers[outputFormat(command.Output)]
+	if !ok {
+		return invalidOption("output format", command.Output, []string{string(OutputPlain), string(OutputJSON), string(OutputHTML)})
+	}
+
+	query := strings.Join(command.Query, " ")
+	results, err := rt.cfg.App.Search(rt.ctx, query, command.Limit)
+	if err != nil {
+		return fmt.Errorf("search texts: %w", err)
+	}
+	if err := renderer(query, results, rt.stdout); err != nil {
+		return fmt.Errorf("render results: %w", err)
+	}
+	return nil
+}
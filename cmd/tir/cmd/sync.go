@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// SyncCommand replays changes queued while a cached remote store was
+// unavailable, refreshing the cache's mirror, and resolves changes that
+// conflict with the remote. With
+// --with, it instead syncs the configured store with another store.
+type SyncCommand struct {
+	Status      bool   `help:"Show pending changes without replaying them, or with --with, the changes sync would make."`
+	With        string `name:"with" placeholder:"URI" help:"Sync with another store, e.g. jsonl:///path/to/tir.jsonl or https://tir.example.com."`
+	Interactive bool   `short:"i" help:"With --with, resolve texts changed in both stores with the editor, rather than keeping the most recent change."`
+	Checkpoint  string `type:"path" help:"With --with, file recording the last sync (default: in $XDG_STATE_HOME/tir/sync)."`
+	KeepLocal   string `name:"keep-local" placeholder:"ID" xor:"resolve" help:"Resolve conflicts for a record by overwriting the remote text with your changes."`
+	KeepRemote  string `name:"keep-remote" placeholder:"ID" xor:"resolve" help:"Resolve conflicts for a record by discarding your changes."`
+}
+
+func (command *SyncCommand) Run(rt *runtime) error {
+	if command.With != "" {
+		return command.syncWith(rt)
+	} else if command.Interactive || command.Checkpoint != "" {
+		return errors.New("--interactive and --checkpoint require --with")
+	}
+
+	outbox, err := rt.cfg.App.Outbox()
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+
+	if command.KeepLocal != "" {
+		err = outbox.Resolve(rt.ctx, command.KeepLocal, true)
+	} else if command.KeepRemote != "" {
+		err = outbox.Resolve(rt.ctx, command.KeepRemote, false)
+	}
+	if err != nil {
+		return fmt.Errorf("resolve conflicts: %w", err)
+	}
+
+	var pending []*store.PendingChange
+	if command.Status {
+		pending, err = outbox.Pending(rt.ctx)
+	} else if pending, err = outbox.Replay(rt.ctx); errors.Is(err, store.ErrUnavailable) {
+		log.Printf("sync: %v", err)
+		fmt.Fprintln(rt.stdout, "Remote store unavailable; changes remain pending.")
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("sync: %w", err)
+	}
+	return printPending(rt, pending)
+}
+
+// syncWith syncs the configured store with the store command.With describes.
+func (command *SyncCommand) syncWith(rt *runtime) error {
+	if command.KeepLocal != "" || command.KeepRemote != "" {
+		return errors.New("--keep-local and --keep-remote resolve cached changes; use --interactive with --with")
+	}
+	path := command.Checkpoint
+	if path == "" {
+		var err error
+		if path, err = rt.cfg.CheckpointPath(command.With); err != nil {
+			return fmt.Errorf("find checkpoint: %w", err)
+		}
+	}
+	checkpoint, err := store.LoadCheckpoint(path)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+	other, err := rt.cfg.OpenStore(command.With)
+	if err != nil {
+		return fmt.Errorf("open store: %w", err)
+	}
+	defer other.Close()
+
+	opts := store.SyncOptions{DryRun: command.Status}
+	if command.Interactive {
+		opts.Resolve = resolveWithEditor(rt)
+	}
+	changes, syncErr := rt.cfg.App.Sync(rt.ctx, other, checkpoint, opts)
+	if !command.Status {
+		// Record partial progress, even if sync failed.
+		if err := checkpoint.Save(path); err != nil {
+			return errors.Join(syncErr, fmt.Errorf("save checkpoint: %w", err))
+		}
+	}
+	printSyncChanges(rt, changes, command.Status)
+	if syncErr != nil {
+		return fmt.Errorf("sync: %w", syncErr)
+	}
+	return nil
+}
+
+// resolveWithEditor resolves a conflict by showing the user both versions of
+// the text, then letting them edit the most recent version to keep.
+func resolveWithEditor(rt *runtime) store.Resolver {
+	return func(ctx context.Context, local, remote *text.Text) (*text.Text, error) {
+		candidate, _ := store.LastWriterWins(ctx, local, remote)
+		fmt.Fprintf(rt.stdout, "%v was changed in both stores.\n", candidate.ID)
+		for _, version := range []struct {
+			name string
+			text *text.Text
+		}{{"local", local}, {"remote", remote}} {
+			if version.text == nil {
+				fmt.Fprintf(rt.stdout, "%v: deleted\n", version.name)
+				continue
+			}
+			repr, err := json.MarshalIndent(version.text, "", "\t")
+			if err != nil {
+				return nil, fmt.Errorf("represent %v version: %w", version.name, err)
+			}
+			fmt.Fprintf(rt.stdout, "%v: %s\n", version.name, repr)
+		}
+
+		initial := *candidate
+		updates, err := initial.EditWith(rt.cfg.Editor)
+		if err != nil {
+			return nil, fmt.Errorf("run editor: %w", err)
+		}
+		resolved := *candidate
+		resolved.Integrate(updates)
+		if !resolved.Equal(candidate) {
+			resolved.Updated = time.Now()
+		}
+		return &resolved, nil
+	}
+}
+
+func printSyncChanges(rt *runtime, changes []store.SyncChange, dryRun bool) {
+	if len(changes) == 0 {
+		fmt.Fprintln(rt.stdout, "Stores are in sync.")
+		return
+	}
+	for _, change := range changes {
+		where := "local"
+		if change.Store == "b" {
+			where = "remote"
+		}
+		conflict := ""
+		if change.Conflict {
+			conflict = " (conflict)"
+		}
+		fmt.Fprintf(rt.stdout, "%-6v %-6v %v %v%v\n", change.Op, where, change.ID, change.Title, conflict)
+	}
+	if dryRun {
+		fmt.Fprintln(rt.stdout, "Dry run; no changes made.")
+	}
+}
+
+func printPending(rt *runtime, pending []*store.PendingChange) error {
+	if len(pending) == 0 {
+		_, err := fmt.Fprintln(rt.stdout, "No pending changes.")
+		return err
+	}
+	conflicts := false
+	for _, change := range pending {
+		title := ""
+		if change.Text != nil {
+			title = change.Text.Title
+		} else if change.Base != nil {
+			title = change.Base.Title
+		}
+		fmt.Fprintf(rt.stdout, "%-6v %v %v %v\n", change.Op, change.ID, change.At.Local().Format(time.DateTime), title)
+		if change.Conflict != "" {
+			conflicts = true
+			fmt.Fprintf(rt.stdout, "       conflict: %v\n", change.Conflict)
+		}
+	}
+	if conflicts {
+		fmt.Fprintln(rt.stdout, "Resolve conflicts with --keep-local ID or --keep-remote ID.")
+	}
+	return nil
+}
@@ -11,7 +11,7 @@ type UpdateCommand struct {
 }
 
 func (command *UpdateCommand) Run(rt *runtime) error {
-	initial, err := rt.cfg.App.Read(command.ID)
+	initial, err := rt.cfg.App.Read(rt.ctx, command.ID)
 	if err != nil {
 		return fmt.Errorf("read record %q: %w", command.ID, err)
 	}
@@ -19,7 +19,7 @@ func (command *UpdateCommand) Run(rt *runtime) error {
 	if err != nil {
 		return fmt.Errorf("run editor: %w", err)
 	}
-	updated, err := rt.cfg.App.Update(command.ID, final)
+	updated, err := rt.cfg.App.Update(rt.ctx, command.ID, final)
 	if err != nil {
 		return fmt.Errorf("update record: %w", err)
 	}
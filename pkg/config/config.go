@@ -3,7 +3,10 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,8 +14,12 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/lukasschwab/tiir/pkg/edit"
+	"github.com/lukasschwab/tiir/pkg/secret"
 	"github.com/lukasschwab/tiir/pkg/store"
 	"github.com/lukasschwab/tiir/pkg/text"
 	"github.com/lukasschwab/tiir/pkg/tir"
@@ -22,22 +29,51 @@ import (
 const (
 	KeyStoreGroup                  = "store"
 	KeyStoreType                   = KeyStoreGroup + ".type"
+	KeyStoreURI                    = KeyStoreGroup + ".uri"
 	KeyFileStoreLocation           = KeyStoreGroup + ".path"
+	KeyGitStoreRemote              = KeyStoreGroup + ".remote"
 	KeyHTTPStoreBaseURL            = KeyStoreGroup + ".base_url"
 	KeyHTTPStoreAPISecret          = KeyStoreGroup + ".api_secret"
 	KeyLibSQLStoreConnectionString = KeyStoreGroup + ".connection_string"
+	KeyLibSQLStoreMigrations       = KeyStoreGroup + ".migrations"
+	KeyEncryptedFileStoreKeyFile   = KeyStoreGroup + ".key_file"
 	KeyEditor                      = "editor"
 )
 
 type storeType string
 
 const (
-	StoreTypeFile   storeType = "file"
-	StoreTypeMemory storeType = "memory"
-	StoreTypeHTTP   storeType = "http"
-	StoreTypeLibSQL storeType = "libsql"
+	StoreTypeFile          storeType = "file"
+	StoreTypeEncryptedFile storeType = "encrypted_file"
+	StoreTypeJSONL         storeType = "jsonl"
+	StoreTypeMarkdown      storeType = "markdown"
+	StoreTypeGit           storeType = "git"
+	StoreTypeBolt          storeType = "bolt"
+	StoreTypeMemory        storeType = "memory"
+	StoreTypeHTTP          storeType = "http"
+	StoreTypeLibSQL        storeType = "libsql"
 )
 
+type migrationsMode string
+
+const (
+	// MigrationsAuto applies pending schema migrations on opening a store.
+	MigrationsAuto migrationsMode = "auto"
+	// MigrationsManual leaves them for tir db migrate.
+	MigrationsManual migrationsMode = "manual"
+)
+
+type cacheType string
+
+const (
+	CacheTypeFile   cacheType = "file"
+	CacheTypeSQLite cacheType = "sqlite"
+)
+
+// outboxSuffix names a cache's outbox: the cache at path queues changes in
+// path+outboxSuffix.
+const outboxSuffix = ".outbox"
+
 type editorType string
 
 const (
@@ -47,23 +83,72 @@ const (
 )
 
 type values struct {
-	Store struct {
-		Type             string `json:"type"`
-		Path             string `json:"path,omitempty"`
-		BaseURL          string `json:"base_url,omitempty"`
-		APISecret        string `json:"api_secret,omitempty"`
-		ConnectionString string `json:"connection_string,omitempty"`
-	} `json:"store"`
-	Editor string `json:"editor"`
+	Store  storeValues `json:"store"`
+	Editor string      `json:"editor"`
+	// Profile is the selected profile, if any, of Profiles, those defined in
+	// config files.
+	Profile  string   `json:"profile,omitempty"`
+	Profiles []string `json:"available_profiles,omitempty"`
+}
+
+// storeValues configure the store: its registered type, the type's
+// configuration, and the cache.
+type storeValues struct {
+	// URI describing the store, if it's configured by URI.
+	URI  string
+	Type string
+	// Config is a value of the registered store type's configuration type.
+	Config any
+	Cache  cacheValues
+}
+
+type cacheValues struct {
+	Type string `json:"type,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// MarshalJSON marshals values as a config file's store block.
+func (values storeValues) MarshalJSON() ([]byte, error) {
+	var block bytes.Buffer
+	fmt.Fprintf(&block, `{"type":%q`, values.Type)
+	if values.URI != "" {
+		uri, err := json.Marshal(values.URI)
+		if err != nil {
+			return nil, err
+		}
+		block.WriteString(`,"uri":`)
+		block.Write(uri)
+	}
+	if values.Config != nil {
+		fields, err := marshalStoreConfig(values.Config)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 {
+			block.WriteByte(',')
+			block.Write(fields)
+		}
+	}
+	if values.Cache != (cacheValues{}) {
+		cache, err := json.Marshal(values.Cache)
+		if err != nil {
+			return nil, err
+		}
+		block.WriteString(`,"cache":`)
+		block.Write(cache)
+	}
+	block.WriteByte('}')
+	return block.Bytes(), nil
 }
 
 type fileValues struct {
 	Store *struct {
-		Type             *string `json:"type"`
-		Path             *string `json:"path"`
-		BaseURL          *string `json:"base_url"`
-		APISecret        *string `json:"api_secret"`
-		ConnectionString *string `json:"connection_string"`
+		Type  *string `json:"type"`
+		URI   *string `json:"uri"`
+		Cache *struct {
+			Type *string `json:"type"`
+			Path *string `json:"path"`
+		} `json:"cache"`
 	} `json:"store"`
 	Editor *string `json:"editor"`
 }
@@ -75,7 +160,16 @@ func (lookuper fileLookuper) Lookup(key string) (string, bool) {
 	return value, ok
 }
 
-func newFileLookuper(path string) (envconfig.Lookuper, error) {
+// configFile is a parsed config file: its values outside any profile, and in
+// each of its profiles.
+type configFile struct {
+	values         fileLookuper
+	profiles       map[string]fileLookuper
+	defaultProfile *string
+}
+
+// readConfigFile at path, if it exists.
+func readConfigFile(path string) (*configFile, error) {
 	contents, err := os.ReadFile(path)
 	if errors.Is(err, os.ErrNotExist) {
 		return nil, nil
@@ -83,11 +177,45 @@ func newFileLookuper(path string) (envconfig.Lookuper, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read config file %q: %w", path, err)
 	}
+	root, problems := validateConfigFile(path, contents)
+	if len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i, problem := range problems {
+			errs[i] = problem
+		}
+		return nil, fmt.Errorf("invalid config file; fix it, or check it with tir config validate:\n%w", errors.Join(errs...))
+	}
+	// Parse the file's values, in any format, as JSON.
+	if contents, err = json.Marshal(root.plain()); err != nil {
+		return nil, fmt.Errorf("read config file %q: %w", path, err)
+	}
 
-	var file fileValues
+	var file struct {
+		Profiles       map[string]json.RawMessage `json:"profiles"`
+		DefaultProfile *string                    `json:"default_profile"`
+	}
 	if err := json.Unmarshal(contents, &file); err != nil {
 		return nil, fmt.Errorf("parse config file %q: %w", path, err)
 	}
+	parsed := &configFile{profiles: make(map[string]fileLookuper), defaultProfile: file.DefaultProfile}
+	if parsed.values, err = newFileLookuper(contents); err != nil {
+		return nil, fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	for name, profile := range file.Profiles {
+		if parsed.profiles[name], err = newFileLookuper(profile); err != nil {
+			return nil, fmt.Errorf("parse profile %q in config file %q: %w", name, path, err)
+		}
+	}
+	return parsed, nil
+}
+
+// newFileLookuper for the values in contents: a config file, or a profile in
+// one.
+func newFileLookuper(contents []byte) (fileLookuper, error) {
+	var file fileValues
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
 
 	values := make(fileLookuper)
 	put := func(key string, value *string) {
@@ -97,29 +225,56 @@ func newFileLookuper(path string) (envconfig.Lookuper, error) {
 	}
 	if file.Store != nil {
 		put("TIR_STORE_TYPE", file.Store.Type)
-		put("TIR_STORE_PATH", file.Store.Path)
-		put("TIR_STORE_BASE_URL", file.Store.BaseURL)
-		put("TIR_API_SECRET", file.Store.APISecret)
-		put("TIR_CONNECTION_STRING", file.Store.ConnectionString)
+		put("TIR_STORE", file.Store.URI)
+		if file.Store.Cache != nil {
+			put("TIR_CACHE_TYPE", file.Store.Cache.Type)
+			put("TIR_CACHE_PATH", file.Store.Cache.Path)
+		}
 	}
 	put("TIR_EDITOR", file.Editor)
+
+	// Read the rest of the store block as any registered store type's
+	// configuration.
+	var block struct {
+		Store map[string]json.RawMessage `json:"store"`
+	}
+	if err := json.Unmarshal(contents, &block); err != nil {
+		return nil, err
+	}
+	for key, envs := range storeKeys() {
+		raw, ok := block.Store[key]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		value := string(raw)
+		if err := json.Unmarshal(raw, &value); err != nil && raw[0] == '"' {
+			return nil, err
+		}
+		for _, env := range envs {
+			values[env] = value
+		}
+	}
 	return values, nil
 }
 
 type envValues struct {
-	StoreType        *string `env:"TIR_STORE_TYPE,noinit"`
-	FileLocation     *string `env:"TIR_STORE_PATH,noinit"`
-	BaseURL          *string `env:"TIR_STORE_BASE_URL,noinit"`
-	APISecret        *string `env:"TIR_API_SECRET,noinit"`
-	ConnectionString *string `env:"TIR_CONNECTION_STRING,noinit"`
-	Editor           *string `env:"TIR_EDITOR,noinit"`
+	StoreType *string `env:"TIR_STORE_TYPE,noinit"`
+	CacheType *string `env:"TIR_CACHE_TYPE,noinit"`
+	CachePath *string `env:"TIR_CACHE_PATH,noinit"`
+	Editor    *string `env:"TIR_EDITOR,noinit"`
 }
 
 // Load constructs a configured application from the supplied lookupers. Values
-// are applied in this order: defaults, /etc/tir/.tir.config,
-// $HOME/.tir.config, and lookupers in priority order.
+// are applied in this order: defaults, the config files in [Paths], and
+// lookupers in priority order. Values in the selected profile override the
+// config files' other values; the profile is selected by TIR_PROFILE, or the
+// config files' default_profile, with the same precedence.
 func Load(lookuper envconfig.Lookuper, fallbacks ...envconfig.Lookuper) (*Config, error) {
-	return load(configPaths(), append([]envconfig.Lookuper{lookuper}, fallbacks...))
+	paths, err := Paths()
+	if err != nil {
+		return nil, err
+	}
+	return load(paths, append([]envconfig.Lookuper{lookuper}, fallbacks...))
 }
 
 // load constructs a configured application using the supplied configuration
@@ -127,16 +282,78 @@ func Load(lookuper envconfig.Lookuper, fallbacks ...envconfig.Lookuper) (*Config
 // letting tests use isolated files and map-backed values rather than mutating
 // process state.
 func load(paths []string, lookupers []envconfig.Lookuper) (*Config, error) {
-	sources := append([]envconfig.Lookuper{}, lookupers...)
-	for i := len(paths) - 1; i >= 0; i-- {
-		lookuper, err := newFileLookuper(paths[i])
+	cfg, err := resolve(paths, lookupers)
+	if err != nil {
+		return cfg, err
+	}
+	if err := cfg.initialize(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Keyring returns the keyring tir reads secrets from, and the account in it
+// holding the configured store's secret (e.g. api_secret_keyring), or else
+// TIR_API_SECRET_KEYRING, if either is set. Unlike Load, it doesn't open the
+// store, which may need the secret.
+func Keyring(lookuper envconfig.Lookuper, fallbacks ...envconfig.Lookuper) (secret.Keyring, string, error) {
+	paths, err := Paths()
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := resolve(paths, append([]envconfig.Lookuper{lookuper}, fallbacks...))
+	if err != nil {
+		return nil, "", err
+	}
+	keyring := OpenKeyring(cfg.sources...)
+
+	config := reflect.ValueOf(cfg.values.Store.Config)
+	for _, field := range storeFields(config.Type()) {
+		if s, ok := config.Field(field.index).Interface().(secret.Secret); ok && s.Account != "" {
+			return keyring, s.Account, nil
+		}
+	}
+	return keyring, cfg.sources.secret("TIR_API_SECRET").Account, nil
+}
+
+// OpenKeyring returns the keyring tir reads secrets from: the file in
+// TIR_KEYRING_FILE, if lookupers set it, or else the OS keyring.
+func OpenKeyring(lookupers ...envconfig.Lookuper) secret.Keyring {
+	if keyring := layers(lookupers).keyring(); keyring != nil {
+		return keyring
+	}
+	return secret.SecretService()
+}
+
+// resolve the configuration in paths and lookupers, like load, without opening
+// the store.
+func resolve(paths []string, lookupers []envconfig.Lookuper) (*Config, error) {
+	var files []*configFile
+	for _, path := range paths {
+		file, err := readConfigFile(path)
 		if err != nil {
 			return nil, err
 		}
-		if lookuper != nil {
-			sources = append(sources, lookuper)
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+
+	profile, profiles := selectProfile(lookupers, files)
+	if profile != "" && len(profiles) == 0 {
+		return nil, fmt.Errorf("undefined profile %q; config files don't define any profiles", profile)
+	} else if profile != "" && !slices.Contains(profiles, profile) {
+		return nil, fmt.Errorf("undefined profile %q; use one of %v", profile, strings.Join(profiles, ", "))
+	}
+	sources := append(layers{}, lookupers...)
+	for i := len(files) - 1; i >= 0; i-- {
+		if values, ok := files[i].profiles[profile]; ok {
+			sources = append(sources, values)
 		}
 	}
+	for i := len(files) - 1; i >= 0; i-- {
+		sources = append(sources, files[i].values)
+	}
 	sources = append(sources, defaultLookuper())
 
 	var env envValues
@@ -147,13 +364,128 @@ func load(paths []string, lookupers []envconfig.Lookuper) (*Config, error) {
 		return nil, fmt.Errorf("read environment: %w", err)
 	}
 
-	cfg := &Config{values: valuesFrom(env)}
-	if err := cfg.initialize(); err != nil {
-		return cfg, err
+	cfg := &Config{values: valuesFrom(env), sources: sources}
+	cfg.values.Profile, cfg.values.Profiles = profile, profiles
+	if uri, layer, ok := storeURI(sources); ok {
+		values, err := cfg.parseStoreSpec(uri, false)
+		if err != nil {
+			return cfg, fmt.Errorf("read store URI: %w", err)
+		}
+		// The URI only overrides settings from its own or lower-priority
+		// sources, e.g. not a path set with a flag.
+		config := reflect.New(reflect.TypeOf(values.Config)).Elem()
+		config.Set(reflect.ValueOf(values.Config))
+		if err := applyStoreSettings(config, sources[:layer], false); err != nil {
+			return cfg, err
+		}
+		cfg.values.Store.URI, cfg.values.Store.Type, cfg.values.Store.Config = uri, values.Type, config.Interface()
+	} else {
+		registration, ok := store.Lookup(cfg.values.Store.Type)
+		if !ok {
+			return cfg, invalidStoreType(cfg.values.Store.Type)
+		}
+		config, err := readStoreConfig(registration, sources, false)
+		if err != nil {
+			return cfg, fmt.Errorf("read %v store config: %w", registration.Name, err)
+		}
+		cfg.values.Store.Config = config.Interface()
 	}
 	return cfg, nil
 }
 
+// selectProfile returns the profile selected by TIR_PROFILE in lookupers, or
+// else the last default_profile in files, and the profiles files define, in
+// order.
+func selectProfile(lookupers []envconfig.Lookuper, files []*configFile) (string, []string) {
+	var profiles []string
+	for _, file := range files {
+		for name := range file.profiles {
+			if !slices.Contains(profiles, name) {
+				profiles = append(profiles, name)
+			}
+		}
+	}
+	slices.Sort(profiles)
+
+	for _, lookuper := range lookupers {
+		if lookuper == nil {
+			continue
+		} else if profile, ok := lookuper.Lookup("TIR_PROFILE"); ok {
+			return profile, profiles
+		}
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].defaultProfile != nil {
+			return *files[i].defaultProfile, profiles
+		}
+	}
+	return "", profiles
+}
+
+// layers of configuration sources, in priority order.
+type layers []envconfig.Lookuper
+
+// Lookup key in the highest-priority source that sets it.
+func (sources layers) Lookup(key string) (string, bool) {
+	for _, source := range sources {
+		if source == nil {
+			continue
+		} else if value, ok := source.Lookup(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// secret held by the environment variable env, or the command, file, or
+// keyring account in the variables named for it, e.g. TIR_API_SECRET_COMMAND.
+// They're read from the highest-priority source that sets any of them; the
+// secret isn't read until it's needed.
+func (sources layers) secret(env string) secret.Secret {
+	for _, source := range sources {
+		if source == nil {
+			continue
+		}
+		var s secret.Secret
+		found := false
+		for i, suffix := range secretSuffixes {
+			if value, ok := source.Lookup(env + suffix.env); ok {
+				*secretParts(&s)[i], found = value, true
+			}
+		}
+		if found {
+			s.Keyring = sources.keyring()
+			return s
+		}
+	}
+	return secret.Secret{}
+}
+
+// keyring holding secrets: the file in TIR_KEYRING_FILE, if it's set, or nil
+// for the OS keyring.
+func (sources layers) keyring() secret.Keyring {
+	if path, ok := sources.Lookup("TIR_KEYRING_FILE"); ok && path != "" {
+		return secret.File(path)
+	}
+	return nil
+}
+
+// storeURI is the configured store URI, and the index of the source setting
+// it, if the highest-priority source that configures the store sets its URI
+// rather than its type.
+func storeURI(sources layers) (string, int, bool) {
+	for i, source := range sources {
+		if source == nil {
+			continue
+		} else if uri, ok := source.Lookup("TIR_STORE"); ok && uri != "" {
+			return uri, i, true
+		} else if _, ok := source.Lookup("TIR_STORE_TYPE"); ok {
+			return "", 0, false
+		}
+	}
+	return "", 0, false
+}
+
 func defaultLookuper() envconfig.Lookuper {
 	values := map[string]string{
 		"TIR_STORE_TYPE": string(StoreTypeFile),
@@ -165,22 +497,63 @@ func defaultLookuper() envconfig.Lookuper {
 	return envconfig.MapLookuper(values)
 }
 
+// Paths returns the config files tir loads, in order: /etc/tir/.tir.config,
+// $HOME/.tir.config, and $XDG_CONFIG_HOME/tir/config.json, .yaml, .yml, or
+// .toml (by default in $HOME/.config), if they exist. Returns an error if there
+// are several of the latter.
+func Paths() ([]string, error) {
+	var paths []string
+	for _, path := range configPaths() {
+		if fileExists(path) {
+			paths = append(paths, path)
+		}
+	}
+	var xdg []string
+	if dir, err := configDir(); err == nil {
+		for _, ext := range []string{"json", "yaml", "yml", "toml"} {
+			if path := filepath.Join(dir, "config."+ext); fileExists(path) {
+				xdg = append(xdg, path)
+			}
+		}
+	}
+	if len(xdg) > 1 {
+		return nil, fmt.Errorf("found config files %v; keep one", strings.Join(xdg, " and "))
+	}
+	return append(paths, xdg...), nil
+}
+
 func configPaths() []string {
 	paths := []string{"/etc/tir/.tir.config"}
-	if home, err := os.UserHomeDir(); err == nil {
-		paths = append(paths, filepath.Join(home, ".tir.config"))
+	if path, err := UserPath(); err == nil {
+		paths = append(paths, path)
 	}
 	return paths
 }
 
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// configDir is tir's directory for config files: $XDG_CONFIG_HOME/tir, or
+// $HOME/.config/tir.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "tir"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("find config directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "tir"), nil
+}
+
 func valuesFrom(env envValues) values {
 	var values values
 
 	apply(&values.Store.Type, env.StoreType)
-	apply(&values.Store.Path, env.FileLocation)
-	apply(&values.Store.BaseURL, env.BaseURL)
-	apply(&values.Store.APISecret, env.APISecret)
-	apply(&values.Store.ConnectionString, env.ConnectionString)
+	apply(&values.Store.Cache.Type, env.CacheType)
+	apply(&values.Store.Cache.Path, env.CachePath)
 	apply(&values.Editor, env.Editor)
 	return values
 }
@@ -194,53 +567,29 @@ func apply(destination *string, source *string) {
 // Config contains the configured store-backed app and editor. Callers must
 // close App when finished.
 type Config struct {
-	values values
-	App    tir.Interface
-	Editor text.Editor
+	values  values
+	sources layers
+	App     tir.Interface
+	Editor  text.Editor
 }
 
 func (cfg *Config) initialize() error {
-	switch storeType(cfg.values.Store.Type) {
-	case StoreTypeFile:
-		if cfg.values.Store.Path == "" {
-			return errors.New("must provide filepath for file store")
-		}
-		log.Printf("Using file store: %v", cfg.values.Store.Path)
-		appStore, err := store.UseFile(cfg.values.Store.Path)
-		if err != nil {
-			return fmt.Errorf("create file store: %w", err)
-		}
-		cfg.App = tir.New(appStore)
-	case StoreTypeMemory:
-		log.Printf("Using memory store")
-		cfg.App = tir.New(store.UseMemory())
-	case StoreTypeHTTP:
-		if cfg.values.Store.BaseURL == "" {
-			return errors.New("must provide base URL for HTTP store")
-		}
-		log.Printf("Using HTTP store: %v", cfg.values.Store.BaseURL)
-		appStore, err := store.UseHTTP(cfg.values.Store.BaseURL, cfg.GetAPISecret())
-		if err != nil {
-			return fmt.Errorf("create HTTP store: %w", err)
-		}
-		cfg.App = tir.New(appStore)
-	case StoreTypeLibSQL:
-		if cfg.values.Store.ConnectionString == "" {
-			return errors.New("must provide connection string for LibSQL store")
-		}
-		log.Printf("Using LibSQL store")
-		appStore, err := store.UseLibSQL(cfg.values.Store.ConnectionString)
-		if err != nil {
-			return fmt.Errorf("create LibSQL store: %w", err)
-		}
-		cfg.App = tir.New(appStore)
-	default:
-		return fmt.Errorf("invalid store type %q", cfg.values.Store.Type)
+	appStore, err := open(cfg.values.Store)
+	if err != nil {
+		return err
+	}
+	if appStore, err = cfg.withCache(appStore); err != nil {
+		return err
 	}
+	cfg.App = tir.New(appStore)
 
 	switch editorType(cfg.values.Editor) {
 	case EditorTypeVim:
 		cfg.Editor = edit.Vim
+		if storeType(cfg.values.Store.Type) == StoreTypeEncryptedFile {
+			// Don't write decrypted texts to disk for editing.
+			cfg.Editor = edit.PrivateVim
+		}
 	case EditorTypeTea:
 		cfg.Editor = edit.Tea
 	case EditorTypeHuh:
@@ -251,40 +600,292 @@ func (cfg *Config) initialize() error {
 	return nil
 }
 
+// open the store described by values, without its cache.
+func open(values storeValues) (store.Interface, error) {
+	registration, ok := store.Lookup(values.Type)
+	if !ok {
+		return nil, invalidStoreType(values.Type)
+	}
+	return registration.Open(values.Config)
+}
+
+func invalidStoreType(name string) error {
+	return fmt.Errorf("invalid store type %q; use one of %v", name, strings.Join(StoreTypes(), ", "))
+}
+
+// withCache wraps remote in a [store.Cache], if a cache path is configured.
+func (cfg *Config) withCache(remote store.Interface) (store.Interface, error) {
+	cache := cfg.values.Store.Cache
+	if cache.Path == "" {
+		return remote, nil
+	} else if storeType(cfg.values.Store.Type) == StoreTypeEncryptedFile {
+		// The mirror would hold decrypted texts.
+		remote.Close()
+		return nil, errors.New("can't cache an encrypted file store")
+	}
+	var mirror store.Interface
+	var err error
+	switch cacheType(cache.Type) {
+	case "", CacheTypeFile:
+		mirror, err = store.UseFile(cache.Path)
+	case CacheTypeSQLite:
+		mirror, err = store.UseLibSQL("file://" + cache.Path)
+	default:
+		remote.Close()
+		return nil, fmt.Errorf("invalid cache type %q", cache.Type)
+	}
+	if err != nil {
+		remote.Close()
+		return nil, fmt.Errorf("create cache mirror: %w", err)
+	}
+	log.Printf("Caching store in %v", cache.Path)
+	cached, err := store.UseCache(remote, mirror, cache.Path+outboxSuffix)
+	if err != nil {
+		remote.Close()
+		mirror.Close()
+		return nil, fmt.Errorf("create cache: %w", err)
+	}
+	return cached, nil
+}
+
+// OpenStore opens the store described by spec: a store URI, like the
+// configured store's, e.g. "file:///home/me/tir.json",
+// "https://tir.example.com/?secret_env=TIR_API_SECRET",
+// "libsql://db.turso.io", or "memory:"; or a store type and location separated
+// by a colon, e.g. "jsonl:/home/me/tir.jsonl" or "libsql:file:///home/me/tir.db".
+// Unless the spec sets them, an HTTP store uses the configured API secret and
+// an encrypted_file store the configured key. Callers must close the store.
+func (cfg *Config) OpenStore(spec string) (store.Interface, error) {
+	values, err := cfg.parseStoreSpec(spec, true)
+	if err != nil {
+		return nil, err
+	}
+	return open(values)
+}
+
+// parseStoreSpec into the values describing the store; see OpenStore. Settings
+// the spec doesn't include are read from cfg's sources: if inheritOnly, only
+// those stores opened from specs inherit, e.g. credentials.
+//
+// In a URI, i.e. a spec whose location starts with "//", query parameters
+// named for the store's settings set them, and secret_env names the
+// environment variable holding the store's secret. Other parameters are left in
+// URL locations, e.g. a libSQL authToken.
+func (cfg *Config) parseStoreSpec(spec string, inheritOnly bool) (storeValues, error) {
+	kind, location, ok := strings.Cut(spec, ":")
+	isURI := strings.HasPrefix(location, "//")
+	if kind == "https" || (kind == string(StoreTypeHTTP) && isURI) {
+		// A bare http or https URL describes an HTTP store.
+		kind = string(StoreTypeHTTP)
+	}
+	registration, registered := store.Lookup(kind)
+	if !registered && ok {
+		return storeValues{}, fmt.Errorf("invalid store type %q in spec %q", kind, spec)
+	} else if !registered {
+		return storeValues{}, fmt.Errorf("invalid store spec %q; use TYPE:LOCATION", spec)
+	}
+	locationField, hasLocation := storeLocation(registration.Config)
+	if !ok && hasLocation {
+		return storeValues{}, fmt.Errorf("invalid store spec %q; use TYPE:LOCATION", spec)
+	} else if !hasLocation && strings.TrimPrefix(location, "//") != "" {
+		return storeValues{}, fmt.Errorf("invalid store spec %q; %v stores don't have a location", spec, kind)
+	}
+
+	config, err := readStoreConfig(registration, cfg.sources, inheritOnly)
+	if err != nil {
+		return storeValues{}, err
+	}
+	if isURI {
+		if location, err = cfg.applyURIQuery(config, spec, location, locationField); err != nil {
+			return storeValues{}, fmt.Errorf("invalid store URI %q: %w", maskStoreURI(spec), err)
+		}
+	}
+	if hasLocation {
+		config.Field(locationField.index).SetString(location)
+	}
+	return storeValues{Type: kind, Config: config.Interface()}, nil
+}
+
+// applyURIQuery applies the settings in a store URI's query parameters to
+// config, returning the location the URI describes: the path, for stores with
+// a filesystem path, or the URI without the parameters it set.
+func (cfg *Config) applyURIQuery(config reflect.Value, uri, location string, locationField storeField) (string, error) {
+	var parsed *url.URL
+	var query url.Values
+	var err error
+	if locationField.spec == "path" {
+		path, rawQuery, _ := strings.Cut(strings.TrimPrefix(location, "//"), "?")
+		if location, err = url.PathUnescape(path); err != nil {
+			return "", err
+		} else if query, err = url.ParseQuery(rawQuery); err != nil {
+			return "", err
+		}
+	} else {
+		if parsed, err = url.Parse(uri); err != nil {
+			return "", err
+		}
+		query, location = parsed.Query(), uri
+	}
+
+	fields := storeFields(config.Type())
+	// Secrets the URI sets replace the configured ones.
+	replaced := make(map[int]bool)
+	setSecretPart := func(field storeField, part int, value string) {
+		if !replaced[field.index] {
+			config.Field(field.index).SetZero()
+			replaced[field.index] = true
+		}
+		setSecret(config.Field(field.index), part, value, cfg.sources.keyring())
+	}
+	for key := range query {
+		value := query.Get(key)
+		// Find the field, and the part of a secret, the parameter sets.
+		var field storeField
+		part := -1
+		for _, f := range fields {
+			if i := slices.IndexFunc(f.settings(), func(s storeSetting) bool { return s.key == key }); i >= 0 && f.index != locationField.index {
+				field, part = f, i
+			}
+		}
+		switch {
+		case key == "secret_env":
+			secret, ok := cfg.sources.Lookup(value)
+			if !ok {
+				return "", fmt.Errorf("secret_env %v isn't set", value)
+			}
+			for _, field := range fields {
+				if field.mask == "secret" {
+					setSecretPart(field, 0, secret)
+				}
+			}
+		case part >= 0 && field.secret:
+			setSecretPart(field, part, value)
+		case part >= 0:
+			if err := setField(config.Field(field.index), value); err != nil {
+				return "", fmt.Errorf("invalid %v: %w", key, err)
+			}
+		case locationField.spec != "path":
+			// Leave other parameters in the URL.
+			continue
+		default:
+			return "", fmt.Errorf("unknown parameter %q", key)
+		}
+		query.Del(key)
+		if parsed != nil {
+			parsed.RawQuery = query.Encode()
+			location = parsed.String()
+		}
+	}
+	return location, nil
+}
+
+// CheckpointPath is where to save the checkpoint for syncing the configured
+// store with the store described by spec (see OpenStore and [store.Sync]): a
+// file in $XDG_STATE_HOME/tir/sync, named for the pair of stores.
+func (cfg *Config) CheckpointPath(spec string) (string, error) {
+	with, err := cfg.parseStoreSpec(spec, true)
+	if err != nil {
+		return "", err
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(cfg.values.Store.spec() + "\n" + with.spec()))
+	return filepath.Join(dir, "sync", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// stateDir is tir's directory for state files: $XDG_STATE_HOME/tir, or
+// $HOME/.local/state/tir.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "tir"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("find state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tir"), nil
+}
+
 const maskedSecret = "REDACTED"
 
-// GetAPISecret returns the configured API secret.
-func (cfg *Config) GetAPISecret() string { return cfg.values.Store.APISecret }
+// GetAPISecret returns the configured API secret, running the command or
+// reading the file or keyring account that holds it, if necessary.
+func (cfg *Config) GetAPISecret() (string, error) {
+	secret, err := cfg.sources.secret("TIR_API_SECRET").Get()
+	if err != nil {
+		return "", fmt.Errorf("error reading API secret: %w", err)
+	}
+	return secret, nil
+}
 
 // MaskedJSON returns the resolved configuration formatted as a JSON config
-// file, with secrets replaced by a fixed mask.
+// file, with secrets replaced by a fixed mask. It names the selected profile,
+// if any, and lists the profiles defined in config files.
 func (cfg *Config) MaskedJSON() ([]byte, error) {
 	values := cfg.values
-	if values.Store.APISecret != "" {
-		values.Store.APISecret = maskedSecret
+	if values.Store.Config != nil {
+		values.Store.Config = maskStoreConfig(values.Store.Config)
 	}
-	values.Store.ConnectionString = maskConnectionString(values.Store.ConnectionString)
+	values.Store.URI = maskStoreURI(values.Store.URI)
 	return json.MarshalIndent(values, "", "\t")
 }
 
-func maskConnectionString(connectionString string) string {
-	if connectionString == "" {
-		return ""
+// maskStoreURI masks the secrets in a store URI: those maskURL masks, and query
+// parameters setting the store's mask:"secret" fields, e.g. api_secret.
+func maskStoreURI(uri string) string {
+	kind, _, _ := strings.Cut(uri, ":")
+	if kind == "https" {
+		kind = string(StoreTypeHTTP)
 	}
+	registration, ok := store.Lookup(kind)
+	if !ok {
+		return maskURL(uri)
+	}
+	var params []string
+	for _, field := range storeFields(registration.Config) {
+		if field.mask != "secret" {
+			continue
+		}
+		for _, setting := range field.settings() {
+			if setting.key != "" {
+				params = append(params, setting.key)
+			}
+		}
+	}
+	return maskURL(uri, params...)
+}
 
-	parsed, err := url.Parse(connectionString)
-	if err != nil {
+// maskURL masks a password, authToken parameter, or any of params embedded in
+// a URL, e.g. a connection string or git remote. Other URLs, and scp-like
+// "user@host:path" git remotes, can't embed secrets and are returned
+// unchanged; URLs that don't parse are masked entirely.
+func maskURL(raw string, params ...string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil && !strings.Contains(raw, "://") {
+		return raw
+	} else if err != nil {
 		return maskedSecret
 	}
+
+	masked := false
 	if parsed.User != nil {
 		if _, hasPassword := parsed.User.Password(); hasPassword {
 			parsed.User = url.UserPassword(parsed.User.Username(), maskedSecret)
+			masked = true
 		}
 	}
 	query := parsed.Query()
-	if query.Has("authToken") {
-		query.Set("authToken", maskedSecret)
-		parsed.RawQuery = query.Encode()
+	for _, param := range append([]string{"authToken"}, params...) {
+		if query.Has(param) {
+			query.Set(param, maskedSecret)
+			parsed.RawQuery = query.Encode()
+			masked = true
+		}
+	}
+	if !masked {
+		return raw
 	}
 	return parsed.String()
 }
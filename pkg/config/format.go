@@ -0,0 +1,402 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// node is a value parsed from a config file, with the line it's on.
+type node struct {
+	line int
+	// value is a string, bool, number (int, int64, float64, or json.Number),
+	// nil, date or time, []*node for arrays, or []member for objects.
+	value any
+}
+
+// member of an object node.
+type member struct {
+	key   string
+	line  int
+	value *node
+}
+
+// dateTime is a TOML date or time, which JSON and YAML have no equivalent of.
+type dateTime string
+
+// get the value of the member with key, if n is an object with one.
+func (n *node) get(key string) *node {
+	members, _ := n.value.([]member)
+	for _, m := range members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// add a member to n, an object.
+func (n *node) add(key string, line int, value *node) {
+	members, _ := n.value.([]member)
+	n.value = append(members, member{key: key, line: line, value: value})
+}
+
+// kind of n's value, as named in JSON Schema: "object", "array", "string",
+// "integer", "number", "boolean", or "null"; or "datetime".
+func (n *node) kind() string {
+	switch v := n.value.(type) {
+	case []member:
+		return "object"
+	case []*node:
+		return "array"
+	case string:
+		return "string"
+	case int, int64:
+		return "integer"
+	case float64:
+		return "number"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return "datetime"
+	}
+}
+
+// plain converts n to values [encoding/json] marshals: maps, slices, and
+// scalars.
+func (n *node) plain() any {
+	switch v := n.value.(type) {
+	case []member:
+		object := make(map[string]any, len(v))
+		for _, m := range v {
+			object[m.key] = m.value.plain()
+		}
+		return object
+	case []*node:
+		array := make([]any, len(v))
+		for i, item := range v {
+			array[i] = item.plain()
+		}
+		return array
+	case dateTime:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+// parseConfigFile parses contents in the format path's extension implies:
+// YAML for .yaml and .yml files, TOML for .toml files, and otherwise JSON.
+// Syntax errors are [Problem]s.
+func parseConfigFile(path string, contents []byte) (*node, error) {
+	var root *node
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		root, err = parseYAML(contents)
+	case ".toml":
+		root, err = parseTOML(contents)
+	default:
+		root, err = parseJSON(contents)
+	}
+	var problem Problem
+	if errors.As(err, &problem) {
+		problem.Path = path
+		return nil, problem
+	} else if err != nil {
+		return nil, Problem{Path: path, Message: err.Error()}
+	}
+	return root, nil
+}
+
+// lineAt is the line number of offset in contents.
+func lineAt(contents []byte, offset int64) int {
+	return 1 + bytes.Count(contents[:min(offset, int64(len(contents)))], []byte("\n"))
+}
+
+func parseJSON(contents []byte) (*node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	line := func() int { return lineAt(contents, decoder.InputOffset()) }
+	syntaxError := func(err error) error {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return Problem{Line: lineAt(contents, syntax.Offset), Message: err.Error()}
+		} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return Problem{Line: line(), Message: "unexpected end of JSON input"}
+		}
+		return Problem{Line: line(), Message: err.Error()}
+	}
+
+	var parse func(token json.Token) (*node, error)
+	parse = func(token json.Token) (*node, error) {
+		n := &node{line: line()}
+		switch token {
+		case json.Delim('{'):
+			members := []member{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, syntaxError(err)
+				}
+				keyLine := line()
+				token, err := decoder.Token()
+				if err != nil {
+					return nil, syntaxError(err)
+				}
+				value, err := parse(token)
+				if err != nil {
+					return nil, err
+				}
+				members = append(members, member{key: key.(string), line: keyLine, value: value})
+			}
+			n.value = members
+		case json.Delim('['):
+			items := []*node{}
+			for decoder.More() {
+				token, err := decoder.Token()
+				if err != nil {
+					return nil, syntaxError(err)
+				}
+				item, err := parse(token)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			n.value = items
+		default:
+			n.value = token
+			return n, nil
+		}
+		// Consume the closing delimiter.
+		if _, err := decoder.Token(); err != nil {
+			return nil, syntaxError(err)
+		}
+		return n, nil
+	}
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	root, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, Problem{Line: line(), Message: "unexpected data after the top-level value"}
+	}
+	return root, nil
+}
+
+func parseYAML(contents []byte) (*node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		// yaml's errors include their line numbers.
+		return nil, err
+	} else if len(document.Content) == 0 {
+		// The file is empty, or only comments.
+		return &node{line: 1, value: []member{}}, nil
+	}
+
+	var convert func(y *yaml.Node) (*node, error)
+	convert = func(y *yaml.Node) (*node, error) {
+		n := &node{line: y.Line}
+		switch y.Kind {
+		case yaml.AliasNode:
+			return convert(y.Alias)
+		case yaml.MappingNode:
+			members := []member{}
+			for i := 0; i+1 < len(y.Content); i += 2 {
+				value, err := convert(y.Content[i+1])
+				if err != nil {
+					return nil, err
+				}
+				members = append(members, member{key: y.Content[i].Value, line: y.Content[i].Line, value: value})
+			}
+			n.value = members
+		case yaml.SequenceNode:
+			items := []*node{}
+			for _, y := range y.Content {
+				item, err := convert(y)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			n.value = items
+		default:
+			if err := y.Decode(&n.value); err != nil {
+				return nil, Problem{Line: y.Line, Message: err.Error()}
+			}
+			if t, ok := n.value.(time.Time); ok {
+				n.value = dateTime(t.Format(time.RFC3339Nano))
+			}
+		}
+		return n, nil
+	}
+	return convert(document.Content[0])
+}
+
+func parseTOML(contents []byte) (*node, error) {
+	var parser unstable.Parser
+	parser.Reset(contents)
+	line := func(n *unstable.Node) int {
+		if n == nil || n.Raw.Length == 0 {
+			return 0
+		}
+		return parser.Shape(n.Raw).Start.Line
+	}
+
+	// keys are the parts of a dotted key, and their lines.
+	type key struct {
+		name string
+		line int
+	}
+	keysOf := func(it unstable.Iterator) []key {
+		var keys []key
+		for it.Next() {
+			keys = append(keys, key{name: string(it.Node().Data), line: line(it.Node())})
+		}
+		return keys
+	}
+
+	// table walks keys from t to a table, creating tables that don't exist. If
+	// array, it appends a table to the array of tables at keys.
+	table := func(t *node, keys []key, array bool) (*node, error) {
+		for i, k := range keys {
+			last := i == len(keys)-1
+			next := t.get(k.name)
+			switch {
+			case next == nil && array && last:
+				next = &node{line: k.line, value: []*node{}}
+				t.add(k.name, k.line, next)
+			case next == nil:
+				next = &node{line: k.line, value: []member{}}
+				t.add(k.name, k.line, next)
+			}
+			if items, ok := next.value.([]*node); ok && array && last {
+				item := &node{line: k.line, value: []member{}}
+				next.value = append(items, item)
+				next = item
+			} else if ok && len(items) > 0 {
+				// Tables within arrays of tables belong to the last one.
+				next = items[len(items)-1]
+			}
+			if next.kind() != "object" {
+				return nil, Problem{Line: k.line, Message: fmt.Sprintf("%v isn't a table", k.name)}
+			}
+			t = next
+		}
+		return t, nil
+	}
+
+	var value func(v *unstable.Node, valueLine int) (*node, error)
+	// keyValue adds kv, a KeyValue node, to t.
+	keyValue := func(t *node, kv *unstable.Node) error {
+		keys := keysOf(kv.Key())
+		// Dotted keys name tables within t; the last part names the value.
+		t, err := table(t, keys[:len(keys)-1], false)
+		if err != nil {
+			return err
+		}
+		k := keys[len(keys)-1]
+		if t.get(k.name) != nil {
+			return Problem{Line: k.line, Message: fmt.Sprintf("%v is defined twice", k.name)}
+		}
+		v, err := value(kv.Value(), k.line)
+		if err != nil {
+			return err
+		}
+		t.add(k.name, k.line, v)
+		return nil
+	}
+	value = func(v *unstable.Node, valueLine int) (*node, error) {
+		n := &node{line: valueLine}
+		var err error
+		switch v.Kind {
+		case unstable.String:
+			n.value = string(v.Data)
+		case unstable.Bool:
+			n.value = string(v.Data) == "true"
+		case unstable.Integer:
+			n.value, err = strconv.ParseInt(string(v.Data), 0, 64)
+		case unstable.Float:
+			n.value, err = strconv.ParseFloat(strings.ReplaceAll(string(v.Data), "_", ""), 64)
+		case unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+			n.value = dateTime(v.Data)
+		case unstable.Array:
+			items := []*node{}
+			children := v.Children()
+			for children.Next() {
+				item, err := value(children.Node(), valueLine)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			n.value = items
+		case unstable.InlineTable:
+			n.value = []member{}
+			children := v.Children()
+			for children.Next() {
+				if err := keyValue(n, children.Node()); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, Problem{Line: valueLine, Message: fmt.Sprintf("unsupported value %q", v.Data)}
+		}
+		if err != nil {
+			return nil, Problem{Line: valueLine, Message: err.Error()}
+		}
+		return n, nil
+	}
+
+	root := &node{line: 1, value: []member{}}
+	current := root
+	for parser.NextExpression() {
+		expression := parser.Expression()
+		var err error
+		switch expression.Kind {
+		case unstable.Table:
+			current, err = table(root, keysOf(expression.Key()), false)
+		case unstable.ArrayTable:
+			current, err = table(root, keysOf(expression.Key()), true)
+		case unstable.KeyValue:
+			err = keyValue(current, expression)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := parser.Error(); err != nil {
+		problem := Problem{Message: err.Error()}
+		var parserError *unstable.ParserError
+		if errors.As(err, &parserError) {
+			// The highlighted bytes are a slice of contents.
+			if offset := cap(contents) - cap(parserError.Highlight); offset >= 0 && offset <= len(contents) {
+				problem.Line = lineAt(contents, int64(offset))
+			}
+		}
+		return nil, problem
+	}
+	return root, nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ReadPassphrase prompts for a passphrase on the terminal without echoing it.
+// Fails if stdin isn't a terminal.
+func ReadPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("can't prompt for a passphrase: stdin isn't a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+)
+
+// SchemaID identifies the JSON Schema for config files; it's published at this
+// URL, and in this repository as config.schema.json.
+const SchemaID = "https://raw.githubusercontent.com/lukasschwab/tiir/main/config.schema.json"
+
+// Problem with a config file: a syntax error, an unknown key, or a value of the
+// wrong type.
+type Problem struct {
+	Path string
+	// Line the problem is on, starting at 1, or 0 if it's unknown.
+	Line    int
+	Message string
+}
+
+func (p Problem) Error() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%v: %v", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%v:%d: %v", p.Path, p.Line, p.Message)
+}
+
+// schema is the subset of JSON Schema that describes config files.
+type schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Properties  map[string]*schema `json:"properties,omitempty"`
+	// AdditionalProperties describes an object's properties that aren't in
+	// Properties. If it's nil, objects can't have other properties.
+	AdditionalProperties *schema            `json:"-"`
+	Defs                 map[string]*schema `json:"$defs,omitempty"`
+}
+
+func (s *schema) MarshalJSON() ([]byte, error) {
+	type plain schema
+	output := struct {
+		*plain
+		AdditionalProperties any `json:"additionalProperties,omitempty"`
+	}{plain: (*plain)(s)}
+	if s.AdditionalProperties != nil {
+		output.AdditionalProperties = s.AdditionalProperties
+	} else if s.Type == "object" {
+		output.AdditionalProperties = false
+	}
+	return json.Marshal(output)
+}
+
+// Schema returns the JSON Schema for config files, including every registered
+// store type's settings.
+func Schema() ([]byte, error) {
+	return json.MarshalIndent(configSchema(store.Registered()), "", "  ")
+}
+
+// configSchema for config files, with registered store types' settings.
+func configSchema(registered []store.Registration) *schema {
+	var types []string
+	storeBlock := &schema{
+		Type:        "object",
+		Description: "The store to keep texts in.",
+		Properties: map[string]*schema{
+			"uri": {Type: "string", Description: "The store's URI, e.g. file:///home/me/.tir.json, instead of its type and settings. Or set TIR_STORE."},
+			"cache": {
+				Type:        "object",
+				Description: "A local cache of a remote store.",
+				Properties: map[string]*schema{
+					"type": {Type: "string", Enum: []string{string(CacheTypeFile), string(CacheTypeSQLite)}, Description: "Or set TIR_CACHE_TYPE."},
+					"path": {Type: "string", Description: "Or set TIR_CACHE_PATH."},
+				},
+			},
+		},
+	}
+	// Describe each setting with the store types that use it.
+	users := make(map[string][]string)
+	for _, r := range registered {
+		types = append(types, r.Name)
+		for _, field := range storeFields(r.Config) {
+			for _, setting := range field.settings() {
+				if setting.key == "" {
+					continue
+				} else if _, ok := storeBlock.Properties[setting.key]; !ok {
+					storeBlock.Properties[setting.key] = &schema{Type: jsonType(r.Config.Field(field.index).Type)}
+				}
+				users[setting.key] = append(users[setting.key], r.Name)
+				description := fmt.Sprintf("Used by %v stores. Or set %v.", strings.Join(users[setting.key], ", "), setting.env)
+				if setting.help != "" {
+					description = setting.help + " " + description
+				}
+				storeBlock.Properties[setting.key].Description = description
+			}
+		}
+	}
+	storeBlock.Properties["type"] = &schema{Type: "string", Enum: types, Description: "The type of store. Or set TIR_STORE_TYPE."}
+
+	settings := map[string]*schema{
+		"store":  {Ref: "#/$defs/store"},
+		"editor": {Ref: "#/$defs/editor"},
+	}
+	properties := map[string]*schema{
+		"$schema":         {Type: "string"},
+		"default_profile": {Type: "string", Description: "The profile to use unless --profile or TIR_PROFILE selects another."},
+		"profiles": {
+			Type:                 "object",
+			Description:          "Named profiles, each overriding the settings outside profiles.",
+			AdditionalProperties: &schema{Ref: "#/$defs/profile"},
+		},
+	}
+	for key, s := range settings {
+		properties[key] = s
+	}
+	return &schema{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		ID:         SchemaID,
+		Title:      "tir configuration",
+		Type:       "object",
+		Properties: properties,
+		Defs: map[string]*schema{
+			"store":   storeBlock,
+			"editor":  {Type: "string", Enum: []string{string(EditorTypeVim), string(EditorTypeTea), string(EditorTypeHuh)}, Description: "The editor for creating and updating texts. Or set TIR_EDITOR."},
+			"profile": {Type: "object", Properties: settings},
+		},
+	}
+}
+
+// jsonType is the JSON Schema type of values of t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// validate n, at key, against s, a schema within root. It appends problems
+// to problems.
+func (s *schema) validate(root *schema, n *node, key string, problems *[]Problem) {
+	if name, ok := strings.CutPrefix(s.Ref, "#/$defs/"); ok {
+		s = root.Defs[name]
+	}
+	kind := n.kind()
+	if kind == "null" {
+		// null leaves the setting unset.
+		return
+	} else if s.Type != "" && kind != s.Type && (s.Type != "number" || kind != "integer") {
+		*problems = append(*problems, Problem{Line: n.line, Message: fmt.Sprintf("%v must be %v, not %v", key, article(s.Type), article(kind))})
+		return
+	}
+	if value, ok := n.value.(string); ok && s.Enum != nil && !slices.Contains(s.Enum, value) {
+		*problems = append(*problems, Problem{Line: n.line, Message: fmt.Sprintf("invalid %v %q; use one of %v", key, value, strings.Join(s.Enum, ", "))})
+	}
+	members, _ := n.value.([]member)
+	for _, m := range members {
+		memberKey := m.key
+		if key != "" {
+			memberKey = key + "." + m.key
+		}
+		if property, ok := s.Properties[m.key]; ok {
+			property.validate(root, m.value, memberKey, problems)
+		} else if s.AdditionalProperties != nil {
+			s.AdditionalProperties.validate(root, m.value, memberKey, problems)
+		} else {
+			*problems = append(*problems, Problem{Line: m.line, Message: fmt.Sprintf("unknown key %v", memberKey)})
+		}
+	}
+}
+
+// article prefixes a JSON Schema type with an indefinite article.
+func article(kind string) string {
+	switch kind {
+	case "object", "array", "integer":
+		return "an " + kind
+	case "null":
+		return kind
+	default:
+		return "a " + kind
+	}
+}
+
+// validateConfigFile parses contents, the config file at path, and validates
+// it against the schema. Returns the parsed file, if it's valid, and the
+// problems found.
+func validateConfigFile(path string, contents []byte) (*node, []Problem) {
+	root, err := parseConfigFile(path, contents)
+	if problem, ok := err.(Problem); ok {
+		return nil, []Problem{problem}
+	}
+	var problems []Problem
+	s := configSchema(store.Registered())
+	s.validate(s, root, "", &problems)
+	for i := range problems {
+		problems[i].Path = path
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return root, nil
+}
+
+// ValidateFile validates the config file at path: its syntax, keys, and the
+// types of its values. Returns the problems found, or an error if the file
+// can't be read.
+func ValidateFile(path string) ([]Problem, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %q: %w", path, err)
+	}
+	_, problems := validateConfigFile(path, contents)
+	return problems, nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"config.json": `{
+	"store": {
+		"type": "file",
+		"pth": "/tmp/tir.json"
+	},
+	"editor": 3
+}`,
+		"config.yaml": `store:
+  type: file
+  pth: /tmp/tir.json
+editor: 3
+`,
+		"config.toml": `editor = 3
+
+[store]
+type = "file"
+pth = "/tmp/tir.json"
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+			problems, err := ValidateFile(path)
+			require.NoError(t, err)
+			var messages []string
+			for _, problem := range problems {
+				assert.Equal(t, path, problem.Path)
+				messages = append(messages, problem.Error()[len(path):])
+			}
+			slices.Sort(messages)
+			assert.Equal(t, map[string][]string{
+				"config.json": {":4: unknown key store.pth", ":6: editor must be a string, not an integer"},
+				"config.yaml": {":3: unknown key store.pth", ":4: editor must be a string, not an integer"},
+				"config.toml": {":1: editor must be a string, not an integer", ":5: unknown key store.pth"},
+			}[name], messages)
+		})
+	}
+}
+
+func TestValidateFileReportsSyntaxErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".tir.config")
+	require.NoError(t, os.WriteFile(path, []byte("{\n\t\"store\": {\n\t\t\"type\": \"file\",\n\t}\n}"), 0o600))
+	problems, err := ValidateFile(path)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	// The trailing comma.
+	assert.Equal(t, 3, problems[0].Line)
+
+	path = filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte("[store]\ntype = \"file\"\npath =\n"), 0o600))
+	problems, err = ValidateFile(path)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 3, problems[0].Line)
+}
+
+func TestLoadFailsOnInvalidConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".tir.config")
+	require.NoError(t, os.WriteFile(path, []byte(`{"store": {"type": "memory", "base_ulr": "https://example.test"}}`), 0o600))
+	_, err := load([]string{path}, nil)
+	assert.ErrorContains(t, err, path+":1: unknown key store.base_ulr")
+}
+
+func TestLoadYAMLAndTOML(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+store:
+  type: http
+  base_url: https://example.test
+  api_secret: from-yaml
+profiles:
+  work:
+    editor: huh
+default_profile: work
+`), 0o600))
+	cfg, err := load([]string{yamlPath}, nil)
+	require.NoError(t, err)
+	require.NoError(t, cfg.App.Close())
+	assert.Equal(t, "from-yaml", apiSecret(t, cfg))
+	assert.Equal(t, "huh", cfg.values.Editor)
+
+	tomlPath := filepath.Join(dir, "config.toml")
+	require.NoError(t, os.WriteFile(tomlPath, []byte(`
+default_profile = "work"
+
+[store]
+type = "http"
+base_url = "https://example.test"
+api_secret = "from-toml"
+
+[profiles.work]
+editor = "huh"
+`), 0o600))
+	cfg, err = load([]string{tomlPath}, nil)
+	require.NoError(t, err)
+	require.NoError(t, cfg.App.Close())
+	assert.Equal(t, "from-toml", apiSecret(t, cfg))
+	assert.Equal(t, "huh", cfg.values.Editor)
+}
+
+func TestPathsRejectsSeveralXDGConfigFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "tir")
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("editor: vim\n"), 0o600))
+
+	paths, err := Paths()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "config.yaml"), paths[len(paths)-1])
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.toml"), []byte(`editor = "vim"`), 0o600))
+	_, err = Paths()
+	assert.ErrorContains(t, err, "keep one")
+}
+
+// TestSchemaIsPublished checks config.schema.json describes the built-in
+// stores. Update it with tir config schema > config.schema.json.
+func TestSchemaIsPublished(t *testing.T) {
+	published, err := os.ReadFile(filepath.Join("..", "..", "config.schema.json"))
+	require.NoError(t, err)
+	builtIn := slices.DeleteFunc(store.Registered(), func(r store.Registration) bool { return r.Name == "test" })
+	schema, err := configSchema(builtIn).MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, string(schema), string(published))
+}
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/secret"
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// Setup describes a new config file, e.g. one tir config init writes: its
+// store and editor.
+type Setup struct {
+	// Store is the store type, and Settings the settings in its store block,
+	// by key, e.g. "path".
+	Store    string
+	Settings map[string]string
+	Editor   string
+}
+
+// SetupSetting is a setting of a store type, for a [Setup].
+type SetupSetting struct {
+	// Key in the store block, e.g. "base_url", and Env, the environment
+	// variable holding it.
+	Key, Env string
+	// Location is true for the setting holding the store's location, e.g. its
+	// path, and Secret for secrets, which shouldn't be written to config files.
+	Location, Secret bool
+}
+
+// SetupSettings of the registered store type called name, in order, without
+// those reading secrets from elsewhere, e.g. api_secret_command.
+func SetupSettings(name string) []SetupSetting {
+	registration, ok := store.Lookup(name)
+	if !ok {
+		return nil
+	}
+	var settings []SetupSetting
+	for _, field := range storeFields(registration.Config) {
+		if field.key == "" {
+			continue
+		}
+		settings = append(settings, SetupSetting{
+			Key:      field.key,
+			Env:      field.env,
+			Location: field.spec == "path" || field.spec == "location",
+			Secret:   field.mask == "secret",
+		})
+	}
+	return settings
+}
+
+// NewSetup from the settings in lookuper, e.g. tir's flags: TIR_STORE or
+// TIR_STORE_TYPE, the store type's settings, and TIR_EDITOR. A store URI in
+// TIR_STORE sets the store unless TIR_STORE_TYPE names a different type. The
+// store type defaults to file, and the editor to tea.
+func NewSetup(lookuper envconfig.Lookuper) (Setup, error) {
+	setup := Setup{Store: string(StoreTypeFile), Settings: make(map[string]string), Editor: string(EditorTypeTea)}
+	storeType, hasType := lookuper.Lookup("TIR_STORE_TYPE")
+	if hasType {
+		setup.Store = storeType
+	}
+	if value, ok := lookuper.Lookup("TIR_EDITOR"); ok {
+		setup.Editor = value
+	}
+	if uri, ok := lookuper.Lookup("TIR_STORE"); ok && uri != "" {
+		cfg := &Config{sources: layers{lookuper}}
+		values, err := cfg.parseStoreSpec(uri, false)
+		if err != nil {
+			return setup, fmt.Errorf("read store URI: %w", err)
+		} else if !hasType || storeType == values.Type {
+			setup.Store, setup.Settings = values.Type, setupValues(values.Config)
+			return setup, nil
+		}
+	}
+	for _, setting := range SetupSettings(setup.Store) {
+		if value, ok := lookuper.Lookup(setting.Env); ok {
+			setup.Settings[setting.Key] = value
+		}
+	}
+	return setup, nil
+}
+
+// setupValues are the settings in config, a registered store type's
+// configuration, by key, for a [Setup]. Secrets include the settings reading
+// them from elsewhere, e.g. api_secret_command.
+func setupValues(config any) map[string]string {
+	settings := make(map[string]string)
+	value := reflect.ValueOf(config)
+	for _, field := range storeFields(value.Type()) {
+		if field.key == "" {
+			continue
+		}
+		v := value.Field(field.index)
+		if s, ok := v.Interface().(secret.Secret); ok {
+			parts := secretParts(&s)
+			for i, setting := range field.settings() {
+				if *parts[i] != "" {
+					settings[setting.key] = *parts[i]
+				}
+			}
+		} else if v.Kind() == reflect.String && !v.IsZero() {
+			settings[field.key] = v.String()
+		} else if !v.IsZero() {
+			if encoded, err := json.Marshal(v.Interface()); err == nil {
+				settings[field.key] = string(encoded)
+			}
+		}
+	}
+	return settings
+}
+
+// storeValues setup describes.
+func (setup Setup) storeValues() (storeValues, error) {
+	registration, ok := store.Lookup(setup.Store)
+	if !ok {
+		return storeValues{}, invalidStoreType(setup.Store)
+	}
+	settings := make(map[string]string)
+	for _, field := range storeFields(registration.Config) {
+		for _, s := range field.settings() {
+			if value, ok := setup.Settings[s.key]; ok && s.key != "" {
+				settings[s.env] = value
+			}
+		}
+	}
+	config, err := readStoreConfig(registration, layers{envconfig.MapLookuper(settings)}, false)
+	if err != nil {
+		return storeValues{}, err
+	}
+	return storeValues{Type: setup.Store, Config: config.Interface()}, nil
+}
+
+// Check the store setup describes: that its file or directory is writable, its
+// libSQL database reachable, or its server healthy.
+func (setup Setup) Check(ctx context.Context) error {
+	values, err := setup.storeValues()
+	if err != nil {
+		return err
+	}
+	switch config := values.Config.(type) {
+	case httpStoreConfig:
+		if config.BaseURL == "" {
+			return errors.New("must provide base URL for HTTP store")
+		}
+		s, err := store.UseHTTPWithSecret(config.BaseURL, config.APISecret.Get)
+		if err != nil {
+			return err
+		} else if err := s.(*store.HTTP).Health(ctx); err != nil {
+			return fmt.Errorf("server at %v isn't healthy: %w", maskURL(config.BaseURL), err)
+		}
+		return nil
+	case libSQLStoreConfig:
+		if config.ConnectionString == "" {
+			return errors.New("must provide connection string for LibSQL store")
+		}
+		connectionString, err := config.connectionString()
+		if err != nil {
+			return err
+		}
+		// Open the database as it is, without migrating it.
+		s, err := store.UseLibSQLWithoutMigrating(connectionString)
+		if err != nil {
+			return fmt.Errorf("can't reach database: %w", err)
+		}
+		return s.Close()
+	}
+	if field, ok := storeLocation(reflect.TypeOf(values.Config)); ok && field.spec == "path" {
+		path := reflect.ValueOf(values.Config).Field(field.index).String()
+		if path == "" {
+			return fmt.Errorf("must provide path for %v store", setup.Store)
+		}
+		return checkWritable(path)
+	}
+	return nil
+}
+
+// checkWritable checks tir can write path, a file or directory: that it's
+// writable, or else that it can be created in the closest directory above it
+// that exists.
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("can't write %v: %w", path, err)
+		}
+		return f.Close()
+	}
+	dir := path
+	for err != nil && errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+		info, err = os.Stat(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("can't write %v: %w", path, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("can't write %v: %v isn't a directory", path, dir)
+	}
+	f, err := os.CreateTemp(dir, ".tir-check-*")
+	if err != nil {
+		return fmt.Errorf("can't write %v: %w", path, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// KeepSecrets moves setup's secrets, e.g. its api_secret, and any authToken in
+// a libSQL connection string, into keyring. The settings naming the keyring
+// account holding them, e.g. api_secret_keyring, replace them. The account is
+// named for the store's host, e.g. "tir.example.com". Returns the accounts.
+func (setup *Setup) KeepSecrets(keyring secret.Keyring) ([]string, error) {
+	if setup.Store == string(StoreTypeLibSQL) {
+		if parsed, err := url.Parse(setup.Settings["connection_string"]); err == nil && parsed.Query().Has("authToken") {
+			query := parsed.Query()
+			setup.Settings["auth_token"] = query.Get("authToken")
+			query.Del("authToken")
+			parsed.RawQuery = query.Encode()
+			setup.Settings["connection_string"] = parsed.String()
+		}
+	}
+
+	host := setup.Store
+	for _, setting := range SetupSettings(setup.Store) {
+		if parsed, err := url.Parse(setup.Settings[setting.Key]); setting.Location && err == nil && parsed.Hostname() != "" {
+			host = parsed.Hostname()
+		}
+	}
+	var accounts []string
+	for _, setting := range SetupSettings(setup.Store) {
+		value := setup.Settings[setting.Key]
+		if !setting.Secret || value == "" {
+			continue
+		}
+		account := host
+		if len(accounts) > 0 {
+			account += "/" + setting.Key
+		}
+		if err := keyring.Set(account, value); err != nil {
+			return accounts, fmt.Errorf("couldn't store %v in keyring: %w", setting.Key, err)
+		}
+		delete(setup.Settings, setting.Key)
+		setup.Settings[setting.Key+"_keyring"] = account
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// Marshal setup as a config file at path, in the format its extension implies;
+// see [Paths]. Empty settings are left out.
+func (setup Setup) Marshal(path string) ([]byte, error) {
+	registration, ok := store.Lookup(setup.Store)
+	if !ok {
+		return nil, invalidStoreType(setup.Store)
+	}
+	block := map[string]any{"type": setup.Store}
+	for _, field := range storeFields(registration.Config) {
+		for _, s := range field.settings() {
+			value := setup.Settings[s.key]
+			if value == "" || s.key == "" {
+				continue
+			}
+			block[s.key] = value
+			if kind := jsonType(registration.Config.Field(field.index).Type); kind != "string" {
+				// Write bools and numbers as such.
+				var typed any
+				if err := json.Unmarshal([]byte(value), &typed); err != nil {
+					return nil, fmt.Errorf("invalid %v %q: must be %v", s.key, value, article(kind))
+				}
+				block[s.key] = typed
+			}
+		}
+	}
+	file := map[string]any{"store": block, "editor": setup.Editor}
+
+	var contents []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		contents, err = yaml.Marshal(file)
+	case ".toml":
+		contents, err = toml.Marshal(file)
+	default:
+		file["$schema"] = SchemaID
+		if contents, err = json.MarshalIndent(file, "", "    "); err == nil {
+			contents = append(contents, '\n')
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal config file: %w", err)
+	}
+	if _, problems := validateConfigFile(path, contents); len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i, problem := range problems {
+			errs[i] = problem
+		}
+		return nil, fmt.Errorf("invalid config file:\n%w", errors.Join(errs...))
+	}
+	return contents, nil
+}
+
+// UserPath is the config file in the user's home directory, $HOME/.tir.config.
+func UserPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("find home directory: %w", err)
+	}
+	return filepath.Join(home, ".tir.config"), nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/secret"
+	"github.com/sethvargo/go-envconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSetup(t *testing.T) {
+	setup, err := NewSetup(envconfig.MapLookuper(map[string]string{
+		"TIR_STORE_TYPE":     "http",
+		"TIR_STORE_BASE_URL": "https://tir.example.com",
+		"TIR_API_SECRET":     "secret",
+		"TIR_STORE_PATH":     "/not/for/http/stores",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Setup{
+		Store:    "http",
+		Settings: map[string]string{"base_url": "https://tir.example.com", "api_secret": "secret"},
+		Editor:   "tea",
+	}, setup)
+
+	setup, err = NewSetup(envconfig.MapLookuper(nil))
+	require.NoError(t, err)
+	assert.Equal(t, Setup{Store: "file", Settings: map[string]string{}, Editor: "tea"}, setup)
+}
+
+func TestNewSetupFromURI(t *testing.T) {
+	setup, err := NewSetup(envconfig.MapLookuper(map[string]string{
+		"TIR_STORE":  "file:///tmp/tir.json",
+		"TIR_EDITOR": "vim",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Setup{Store: "file", Settings: map[string]string{"path": "/tmp/tir.json"}, Editor: "vim"}, setup)
+
+	setup, err = NewSetup(envconfig.MapLookuper(map[string]string{
+		"TIR_STORE":      "https://tir.example.com/?api_secret=secret",
+		"TIR_STORE_TYPE": "http",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Setup{
+		Store:    "http",
+		Settings: map[string]string{"base_url": "https://tir.example.com/", "api_secret": "secret"},
+		Editor:   "tea",
+	}, setup)
+
+	setup, err = NewSetup(envconfig.MapLookuper(map[string]string{
+		"TIR_STORE":      "file:///tmp/tir.json",
+		"TIR_STORE_TYPE": "jsonl",
+		"TIR_STORE_PATH": "/tmp/tir.jsonl",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Setup{Store: "jsonl", Settings: map[string]string{"path": "/tmp/tir.jsonl"}, Editor: "tea"}, setup, "a different store type overrides the URI")
+
+	_, err = NewSetup(envconfig.MapLookuper(map[string]string{"TIR_STORE": "file:///tmp/tir.json?colour=blue"}))
+	assert.ErrorContains(t, err, `unknown parameter "colour"`)
+}
+
+func TestSetupCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	assert.NoError(t, Setup{Store: "file", Settings: map[string]string{"path": filepath.Join(dir, "new", "tir.json")}}.Check(ctx))
+	assert.NoError(t, Setup{Store: "markdown", Settings: map[string]string{"path": dir}}.Check(ctx))
+	assert.Error(t, Setup{Store: "file", Settings: map[string]string{}}.Check(ctx))
+
+	blocker := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+	assert.ErrorContains(t, Setup{Store: "file", Settings: map[string]string{"path": filepath.Join(blocker, "tir.json")}}.Check(ctx), "not a directory")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	assert.NoError(t, Setup{Store: "http", Settings: map[string]string{"base_url": server.URL}}.Check(ctx))
+	assert.ErrorContains(t, Setup{Store: "http", Settings: map[string]string{"base_url": server.URL + "/nowhere"}}.Check(ctx), "isn't healthy")
+
+	assert.NoError(t, Setup{Store: "libsql", Settings: map[string]string{"connection_string": "file://" + filepath.Join(dir, "tir.db")}}.Check(ctx))
+}
+
+func TestSetupKeepSecrets(t *testing.T) {
+	keyring := secret.File(filepath.Join(t.TempDir(), "keyring.json"))
+
+	setup := Setup{Store: "libsql", Settings: map[string]string{"connection_string": "libsql://db.turso.io?authToken=token"}}
+	accounts, err := setup.KeepSecrets(keyring)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db.turso.io"}, accounts)
+	assert.Equal(t, map[string]string{"connection_string": "libsql://db.turso.io", "auth_token_keyring": "db.turso.io"}, setup.Settings)
+	token, err := keyring.Get("db.turso.io")
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+
+	setup = Setup{Store: "http", Settings: map[string]string{"base_url": "https://tir.example.com", "api_secret_command": "pass show tir"}}
+	accounts, err = setup.KeepSecrets(keyring)
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+	assert.Equal(t, map[string]string{"base_url": "https://tir.example.com", "api_secret_command": "pass show tir"}, setup.Settings)
+}
+
+func TestSetupMarshal(t *testing.T) {
+	dir := t.TempDir()
+	keyringPath := filepath.Join(dir, "keyring.json")
+	require.NoError(t, secret.File(keyringPath).Set("tir.example.com", "from-keyring"))
+	setup := Setup{
+		Store:    "http",
+		Settings: map[string]string{"base_url": "https://tir.example.com", "api_secret_keyring": "tir.example.com", "api_secret": ""},
+		Editor:   "huh",
+	}
+	for _, name := range []string{".tir.config", "config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			contents, err := setup.Marshal(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, contents, 0o600))
+
+			cfg, err := load([]string{path}, []envconfig.Lookuper{envconfig.MapLookuper(map[string]string{"TIR_KEYRING_FILE": keyringPath})})
+			require.NoError(t, err)
+			t.Cleanup(func() { assert.NoError(t, cfg.App.Close()) })
+			assert.Equal(t, "https://tir.example.com", cfg.values.Store.Config.(httpStoreConfig).BaseURL)
+			assert.Equal(t, "huh", cfg.values.Editor)
+			assert.Equal(t, "from-keyring", apiSecret(t, cfg))
+		})
+	}
+
+	_, err := Setup{Store: "nonexistent"}.Marshal(filepath.Join(dir, ".tir.config"))
+	assert.Error(t, err)
+}
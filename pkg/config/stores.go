@@ -0,0 +1,463 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/secret"
+	"github.com/lukasschwab/tiir/pkg/store"
+)
+
+// Built-in store types' configurations; see [store.Register] for their tags.
+type (
+	pathStoreConfig struct {
+		Path string `json:"path" spec:"path"`
+	}
+	encryptedFileStoreConfig struct {
+		Path    string `json:"path" spec:"path"`
+		KeyFile string `json:"key_file,omitempty" spec:"inherit"`
+		// Passphrase is only read from the environment, and never output.
+		Passphrase string `json:"-" env:"TIR_STORE_PASSPHRASE" spec:"inherit"`
+	}
+	gitStoreConfig struct {
+		Path   string `json:"path" spec:"path"`
+		Remote string `json:"remote,omitempty" mask:"url"`
+	}
+	memoryStoreConfig struct{}
+	httpStoreConfig   struct {
+		BaseURL   string        `json:"base_url" mask:"url" spec:"location"`
+		APISecret secret.Secret `json:"api_secret,omitempty" env:"TIR_API_SECRET" mask:"secret" spec:"inherit"`
+	}
+	libSQLStoreConfig struct {
+		ConnectionString string        `json:"connection_string" env:"TIR_CONNECTION_STRING" mask:"url" spec:"location"`
+		AuthToken        secret.Secret `json:"auth_token,omitempty" mask:"secret"`
+		Migrations       string        `json:"migrations,omitempty"`
+	}
+)
+
+func init() {
+	store.Register(string(StoreTypeFile), pathStore("file", "filepath", store.UseFile))
+	store.Register(string(StoreTypeEncryptedFile), func(config encryptedFileStoreConfig) (store.Interface, error) {
+		if config.Path == "" {
+			return nil, errors.New("must provide filepath for encrypted file store")
+		}
+		key, err := config.key()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using encrypted file store: %v", config.Path)
+		s, err := store.UseEncryptedFile(config.Path, key)
+		if err != nil {
+			return nil, fmt.Errorf("create encrypted file store: %w", err)
+		}
+		return s, nil
+	})
+	store.Register(string(StoreTypeJSONL), pathStore("JSONL", "filepath", store.UseJSONL))
+	store.Register(string(StoreTypeMarkdown), pathStore("markdown", "directory path", store.UseMarkdown))
+	store.Register(string(StoreTypeGit), func(config gitStoreConfig) (store.Interface, error) {
+		if config.Path == "" {
+			return nil, errors.New("must provide directory path for git store")
+		}
+		log.Printf("Using git store: %v", config.Path)
+		s, err := store.UseGit(config.Path, config.Remote)
+		if err != nil {
+			return nil, fmt.Errorf("create git store: %w", err)
+		}
+		return s, nil
+	})
+	store.Register(string(StoreTypeBolt), pathStore("bolt", "filepath", store.UseBolt))
+	store.Register(string(StoreTypeMemory), func(memoryStoreConfig) (store.Interface, error) {
+		log.Printf("Using memory store")
+		return store.UseMemory(), nil
+	})
+	store.Register(string(StoreTypeHTTP), func(config httpStoreConfig) (store.Interface, error) {
+		if config.BaseURL == "" {
+			return nil, errors.New("must provide base URL for HTTP store")
+		}
+		log.Printf("Using HTTP store: %v", maskURL(config.BaseURL))
+		// Read the secret, e.g. by running its command, only once it's needed.
+		s, err := store.UseHTTPWithSecret(config.BaseURL, config.APISecret.Get)
+		if err != nil {
+			return nil, fmt.Errorf("create HTTP store: %w", err)
+		}
+		return s, nil
+	})
+	store.Register(string(StoreTypeLibSQL), func(config libSQLStoreConfig) (store.Interface, error) {
+		if config.ConnectionString == "" {
+			return nil, errors.New("must provide connection string for LibSQL store")
+		}
+		log.Printf("Using LibSQL store")
+		use := store.UseLibSQL
+		switch migrationsMode(config.Migrations) {
+		case "", MigrationsAuto:
+		case MigrationsManual:
+			use = store.UseLibSQLWithoutMigrating
+		default:
+			return nil, fmt.Errorf("invalid migrations mode %q", config.Migrations)
+		}
+		connectionString, err := config.connectionString()
+		if err != nil {
+			return nil, err
+		}
+		s, err := use(connectionString)
+		if err != nil {
+			return nil, fmt.Errorf("create LibSQL store: %w", err)
+		}
+		return s, nil
+	})
+}
+
+// pathStore is the factory for a store type, described by name, configured
+// only by a path, described by pathNoun.
+func pathStore[S store.Interface](name, pathNoun string, use func(path string) (S, error)) store.Factory[pathStoreConfig] {
+	return func(config pathStoreConfig) (store.Interface, error) {
+		if config.Path == "" {
+			return nil, fmt.Errorf("must provide %v for %v store", pathNoun, name)
+		}
+		log.Printf("Using %v store: %v", name, config.Path)
+		s, err := use(config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("create %v store: %w", name, err)
+		}
+		return s, nil
+	}
+}
+
+// key to an encrypted file store: the key in config.KeyFile,
+// config.Passphrase, or a passphrase the user enters.
+func (config encryptedFileStoreConfig) key() (store.Key, error) {
+	if config.KeyFile != "" {
+		return store.ReadKeyFile(config.KeyFile)
+	}
+	passphrase := config.Passphrase
+	if passphrase == "" {
+		var err error
+		passphrase, err = ReadPassphrase(fmt.Sprintf("Passphrase for %v: ", config.Path))
+		if err != nil {
+			return store.Key{}, fmt.Errorf("%w; set TIR_STORE_PASSPHRASE or %v", err, KeyEncryptedFileStoreKeyFile)
+		} else if passphrase == "" {
+			return store.Key{}, errors.New("passphrase can't be empty")
+		}
+	}
+	return store.Passphrase(passphrase), nil
+}
+
+// connectionString to a libSQL database, with the auth token, if it's
+// configured separately, in its authToken parameter.
+func (config libSQLStoreConfig) connectionString() (string, error) {
+	token, err := config.AuthToken.Get()
+	if err != nil {
+		return "", fmt.Errorf("read auth token: %w", err)
+	} else if token == "" {
+		return config.ConnectionString, nil
+	}
+	parsed, err := url.Parse(config.ConnectionString)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+	query := parsed.Query()
+	query.Set("authToken", token)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// StoreTypes are the names of the registered store types, in the order they
+// were registered.
+func StoreTypes() []string {
+	var names []string
+	for _, r := range store.Registered() {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// StoreHelp describes the registered store types and how to configure them.
+func StoreHelp() string {
+	registered := store.Registered()
+	width := 0
+	for _, r := range registered {
+		width = max(width, len(r.Name))
+	}
+	var help strings.Builder
+	help.WriteString("Stores, and their settings in a config file's store block or environment variables:\n")
+	for _, r := range registered {
+		var settings []string
+		for _, field := range storeFields(r.Config) {
+			key, env := field.key, field.env
+			if field.secret {
+				// Abbreviate the settings reading the secret from elsewhere.
+				var keys, envs []string
+				for _, suffix := range secretSuffixes[1:] {
+					keys, envs = append(keys, suffix.key), append(envs, suffix.env)
+				}
+				key += "[" + strings.Join(keys, "|") + "]"
+				env += "[" + strings.Join(envs, "|") + "]"
+			}
+			if field.key == "" {
+				settings = append(settings, env)
+			} else {
+				settings = append(settings, fmt.Sprintf("%v (%v)", key, env))
+			}
+		}
+		fmt.Fprintf(&help, "  %-*s  %v\n", width, r.Name, strings.Join(settings, ", "))
+	}
+	return strings.TrimSuffix(help.String(), "\n")
+}
+
+// storeField describes a field of a registered store type's configuration.
+type storeField struct {
+	index int
+	// key in the store block of config files, if any, and env, the
+	// environment variable holding the field.
+	key, env string
+	// mask and spec are the field's mask and spec tags; see [store.Register].
+	mask, spec string
+	omitEmpty  bool
+	// secret fields are [secret.Secret]s, read from several settings.
+	secret bool
+}
+
+// storeSetting is a key in the store block of config files and the
+// environment variable holding it.
+type storeSetting struct {
+	key, env string
+	// help describing the setting, if it reads a secret from elsewhere.
+	help string
+}
+
+// secretSuffixes name the settings of a secret field: its value, and the
+// command, file, or OS keyring account holding it, in the order of
+// [secretParts].
+var secretSuffixes = []storeSetting{
+	{},
+	{key: "_command", env: "_COMMAND", help: "A shell command printing the %v."},
+	{key: "_file", env: "_FILE", help: "A file containing the %v."},
+	{key: "_keyring", env: "_KEYRING", help: "The OS keyring account holding the %v; store it with tir auth login."},
+}
+
+// secretParts of s set by each of the settings in [secretSuffixes].
+func secretParts(s *secret.Secret) []*string {
+	return []*string{&s.Value, &s.Command, &s.File, &s.Account}
+}
+
+// settings holding field: its key and environment variable and, if it's a
+// secret, those holding the command, file, or keyring account it's read from.
+func (field storeField) settings() []storeSetting {
+	if !field.secret {
+		return []storeSetting{{key: field.key, env: field.env}}
+	}
+	var settings []storeSetting
+	for _, suffix := range secretSuffixes {
+		setting := storeSetting{env: field.env + suffix.env}
+		if field.key != "" {
+			setting.key = field.key + suffix.key
+		}
+		if suffix.help != "" {
+			setting.help = fmt.Sprintf(suffix.help, strings.ReplaceAll(field.key, "_", " "))
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// storeFields of config, a registered store type's configuration.
+func storeFields(config reflect.Type) []storeField {
+	var fields []storeField
+	for i := range config.NumField() {
+		f := config.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "" {
+			key = f.Name
+		} else if key == "-" {
+			key = ""
+		}
+		env := f.Tag.Get("env")
+		if env == "" && key == "" {
+			continue
+		} else if env == "" {
+			env = "TIR_STORE_" + strings.ToUpper(key)
+		}
+		fields = append(fields, storeField{
+			index:     i,
+			key:       key,
+			env:       env,
+			mask:      f.Tag.Get("mask"),
+			spec:      f.Tag.Get("spec"),
+			omitEmpty: slices.Contains(strings.Split(options, ","), "omitempty"),
+			secret:    f.Type == reflect.TypeFor[secret.Secret](),
+		})
+	}
+	return fields
+}
+
+// storeKeys maps each key in the store block of config files to the
+// environment variables holding it, for every registered store type.
+func storeKeys() map[string][]string {
+	keys := make(map[string][]string)
+	for _, r := range store.Registered() {
+		for _, field := range storeFields(r.Config) {
+			for _, setting := range field.settings() {
+				if setting.key != "" && !slices.Contains(keys[setting.key], setting.env) {
+					keys[setting.key] = append(keys[setting.key], setting.env)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// readStoreConfig of store type r from sources, or only the fields stores
+// opened from specs inherit.
+func readStoreConfig(r store.Registration, sources layers, inheritOnly bool) (reflect.Value, error) {
+	config := reflect.New(r.Config).Elem()
+	return config, applyStoreSettings(config, sources, inheritOnly)
+}
+
+// applyStoreSettings sets the fields of config, a registered store type's
+// configuration, that sources set, leaving the others unchanged.
+func applyStoreSettings(config reflect.Value, sources layers, inheritOnly bool) error {
+	for _, field := range storeFields(config.Type()) {
+		if inheritOnly && field.spec != "inherit" {
+			continue
+		}
+		if field.secret {
+			if s := sources.secret(field.env); !s.IsZero() {
+				config.Field(field.index).Set(reflect.ValueOf(s))
+			}
+		} else if value, ok := sources.Lookup(field.env); ok {
+			if err := setField(config.Field(field.index), value); err != nil {
+				return fmt.Errorf("invalid %v: %w", field.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setField to value: a string, or a bool or number in JSON.
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+// setSecret sets field, a secret: part is its index in [secretSuffixes].
+func setSecret(field reflect.Value, part int, value string, keyring secret.Keyring) {
+	if field.Kind() == reflect.String {
+		// A custom store's secret field may be a string.
+		field.SetString(value)
+		return
+	}
+	s := field.Addr().Interface().(*secret.Secret)
+	*secretParts(s)[part] = value
+	s.Keyring = keyring
+}
+
+// marshalStoreConfig marshals config, a registered store type's configuration,
+// as the members of a store block, without the enclosing braces.
+func marshalStoreConfig(config any) ([]byte, error) {
+	value := reflect.ValueOf(config)
+	var members [][]byte
+	add := func(key string, value any) error {
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		members = append(members, slices.Concat(k, []byte(":"), v))
+		return nil
+	}
+	for _, field := range storeFields(value.Type()) {
+		if field.key == "" {
+			continue
+		}
+		f := value.Field(field.index)
+		if field.secret {
+			s := f.Interface().(secret.Secret)
+			for i, setting := range field.settings() {
+				if part := *secretParts(&s)[i]; part != "" {
+					if err := add(setting.key, part); err != nil {
+						return nil, err
+					}
+				}
+			}
+		} else if !field.omitEmpty || !f.IsZero() {
+			if err := add(field.key, f.Interface()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bytes.Join(members, []byte(",")), nil
+}
+
+// maskStoreConfig returns a copy of config with the fields tagged for masking
+// masked.
+func maskStoreConfig(config any) any {
+	masked := reflect.New(reflect.TypeOf(config)).Elem()
+	masked.Set(reflect.ValueOf(config))
+	for _, field := range storeFields(masked.Type()) {
+		value := masked.Field(field.index)
+		if field.secret {
+			if s := value.Addr().Interface().(*secret.Secret); s.Value != "" {
+				s.Value = maskedSecret
+			}
+			continue
+		} else if value.Kind() != reflect.String || value.String() == "" {
+			continue
+		}
+		switch field.mask {
+		case "secret":
+			value.SetString(maskedSecret)
+		case "url":
+			value.SetString(maskURL(value.String()))
+		}
+	}
+	return masked.Interface()
+}
+
+// storeLocation is the field of config holding the location a store spec
+// sets, if any.
+func storeLocation(config reflect.Type) (storeField, bool) {
+	for _, field := range storeFields(config) {
+		if field.spec == "path" || field.spec == "location" {
+			return field, true
+		}
+	}
+	return storeField{}, false
+}
+
+// spec describes the store as a spec OpenStore accepts, with absolute paths and
+// masked secrets, so equivalent stores have equal specs.
+func (values storeValues) spec() string {
+	field, ok := storeLocation(reflect.TypeOf(values.Config))
+	if !ok {
+		return values.Type + ":"
+	}
+	location := reflect.ValueOf(values.Config).Field(field.index).String()
+	if field.spec == "path" {
+		if path, err := filepath.Abs(location); err == nil {
+			location = path
+		}
+	} else if field.mask == "url" {
+		location = maskURL(location)
+	}
+	if storeType(values.Type) == StoreTypeHTTP {
+		return location
+	}
+	return values.Type + ":" + location
+}
@@ -12,13 +12,17 @@ const Huh huhEditor = iota
 type huhEditor int
 
 func (h huhEditor) Update(initial *text.Text) (final *text.Text, err error) {
-	if err = form(initial).Run(); err != nil {
+	tags := text.JoinTags(initial.Tags)
+	if err = form(initial, &tags).Run(); err != nil {
 		return nil, fmt.Errorf("could not edit text: %w", err)
 	}
+	initial.Tags = text.ParseTags(tags)
 	return initial, nil
 }
 
-func form(t *text.Text) *huh.Form {
+// form for editing t in place. Tags are edited as a comma-separated list in
+// tags; see [text.ParseTags].
+func form(t *text.Text, tags *string) *huh.Form {
 	return huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
@@ -33,6 +37,10 @@ func form(t *text.Text) *huh.Form {
 			huh.NewInput().
 				Title("Note").
 				Value(&t.Note),
+			huh.NewInput().
+				Title("Tags").
+				Description("Comma-separated.").
+				Value(tags),
 		),
 	)
 }
@@ -0,0 +1,29 @@
+//go:build linux
+
+package edit
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Filesystem magic numbers for memory-backed filesystems; see statfs(2).
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// memoryDir is a directory on a memory-backed filesystem, whose files are
+// never written to disk: $XDG_RUNTIME_DIR or /dev/shm.
+func memoryDir() (string, error) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		var stat syscall.Statfs_t
+		if dir == "" || syscall.Statfs(dir, &stat) != nil {
+			continue
+		} else if kind := int64(stat.Type); kind == tmpfsMagic || kind == ramfsMagic {
+			return dir, nil
+		}
+	}
+	return "", errors.New("no memory-backed directory for vim's file; set XDG_RUNTIME_DIR to a tmpfs directory, or use the tea or huh editor")
+}
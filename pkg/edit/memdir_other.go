@@ -0,0 +1,11 @@
+//go:build !linux
+
+package edit
+
+import "errors"
+
+// memoryDir is a directory on a memory-backed filesystem. Only Linux
+// guarantees one.
+func memoryDir() (string, error) {
+	return "", errors.New("vim can't edit texts without writing them to disk on this platform; use the tea or huh editor")
+}
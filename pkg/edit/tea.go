@@ -42,20 +42,26 @@ const (
 	titleInputIndex  = 1
 	authorInputIndex = 2
 	noteInputIndex   = 3
+	tagsInputIndex   = 4
 )
 
 var (
+	// inputIndices for required fields. Tags are optional, so they're never
+	// focused initially.
 	inputIndices = []int{urlInputIndex, titleInputIndex, authorInputIndex, noteInputIndex}
 )
 
 type model struct {
 	result *text.Text
+	// status of the initial text, which isn't editable but determines which
+	// fields are required.
+	status text.Status
 
 	focusIndex int
 
 	// TODO: extract to own model: encapsulate value-derived rendering.
-	// URL, Title, Author, Notes.
-	inputs [4]textinput.Model
+	// URL, Title, Author, Notes, Tags.
+	inputs [5]textinput.Model
 }
 
 func (m *model) urlInput() textinput.Model {
@@ -74,6 +80,10 @@ func (m *model) noteInput() textinput.Model {
 	return m.inputs[noteInputIndex]
 }
 
+func (m *model) tagsInput() textinput.Model {
+	return m.inputs[tagsInputIndex]
+}
+
 func (m *model) toText() *text.Text {
 	// NOTE: should we validate here, to prevent premature submission?
 	return &text.Text{
@@ -81,6 +91,8 @@ func (m *model) toText() *text.Text {
 		Title:  m.titleInput().Value(),
 		Author: m.authorInput().Value(),
 		Note:   m.noteInput().Value(),
+		Tags:   text.ParseTags(m.tagsInput().Value()),
+		Status: m.status,
 	}
 }
 
@@ -203,13 +215,14 @@ func (m *model) focus(inputIndex int) tea.Cmd {
 }
 
 func initialModel(initial, result *text.Text) *model {
-	m := &model{result: result}
+	m := &model{result: result, status: initial.Status}
 
 	for index, data := range map[int][2]string{
 		urlInputIndex:    {"   URL> ", initial.URL},
 		titleInputIndex:  {" Title> ", initial.Title},
 		authorInputIndex: {"Author> ", initial.Author},
 		noteInputIndex:   {"  Note> ", initial.Note},
+		tagsInputIndex:   {"  Tags> ", text.JoinTags(initial.Tags)},
 	} {
 		input := textinput.New()
 		// NOTE: would it be cleaner to indicate fields using 'Placeholder?'
@@ -12,14 +12,28 @@ import (
 // TODO: can we support the user's preferred editor without launching an
 // arbitrary application?
 
-// Vim based [text.Editor]. Uses a temporary file for every Update call.
-const Vim vimEditor = iota
+const (
+	// Vim based [text.Editor]. Uses a temporary file for every Update call.
+	Vim vimEditor = iota
+	// PrivateVim is like [Vim], but never writes the text to disk, e.g. for
+	// encrypted stores: it keeps the temporary file in a memory-backed
+	// directory, and disables vim's swap, backup, undo, and viminfo files.
+	// Update fails if there's no memory-backed directory, e.g. on macOS.
+	PrivateVim
+)
 
 type vimEditor int
 
 // Update implements Editor.
 func (v vimEditor) Update(initial *text.Text) (final *text.Text, err error) {
-	f, err := os.CreateTemp("", "meta.*.json")
+	dir, args := "", []string{}
+	if v == PrivateVim {
+		if dir, err = memoryDir(); err != nil {
+			return nil, err
+		}
+		args = []string{"-n", "-i", "NONE", "-c", "set nobackup nowritebackup noundofile"}
+	}
+	f, err := os.CreateTemp(dir, "meta.*.json")
 	if err != nil {
 		return nil, fmt.Errorf("error creating temp file: %w", err)
 	}
@@ -33,7 +47,7 @@ func (v vimEditor) Update(initial *text.Text) (final *text.Text, err error) {
 	}
 
 	// Run vim.
-	cmd := exec.Command("vim", f.Name())
+	cmd := exec.Command("vim", append(args, f.Name())...)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
@@ -60,15 +74,22 @@ type editable text.Text
 // NOTE: these must correspond to the JSON tags in text.Text. Any divergence
 // may break this editor.
 func (e editable) MarshalJSON() ([]byte, error) {
+	// Render an empty list rather than null, so the user knows what to fill.
+	tags := e.Tags
+	if tags == nil {
+		tags = []string{}
+	}
 	return json.Marshal(&struct {
-		Title  string `json:"title"`
-		URL    string `json:"url"`
-		Author string `json:"author"`
-		Note   string `json:"note"`
+		Title  string   `json:"title"`
+		URL    string   `json:"url"`
+		Author string   `json:"author"`
+		Note   string   `json:"note"`
+		Tags   []string `json:"tags"`
 	}{
 		Title:  e.Title,
 		URL:    e.URL,
 		Author: e.Author,
 		Note:   e.Note,
+		Tags:   tags,
 	})
 }
@@ -10,3 +10,8 @@ import (
 func TestVim(t *testing.T) {
 	assert.Implements(t, (*text.Editor)(nil), Vim)
 }
+
+func TestPrivateVim(t *testing.T) {
+	assert.Implements(t, (*text.Editor)(nil), PrivateVim)
+	assert.NotEqual(t, Vim, PrivateVim, "only PrivateVim keeps texts off disk")
+}
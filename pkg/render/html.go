@@ -9,17 +9,44 @@ import (
 	"github.com/lukasschwab/tiir/pkg/text"
 )
 
+//go:embed templates/head.tmpl
+var htmlHeadTemplate string
+
 //go:embed templates/html.tmpl
 var htmlTemplate string
 
+// parseHTML parses an HTML page template, which may use the shared "head"
+// template.
+func parseHTML(name, page string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(htmlHeadTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(page)
+}
+
 // HTML table rendering for texts. HTML assumes texts it receives are already
 // ordered by timestamp, descending; see [text.Sort].
 func HTML(texts []*text.Text, to io.Writer) error {
-	tmpl, err := template.New("html").Parse(htmlTemplate)
+	return HTMLPage(texts, Links{}, to)
+}
+
+// Links to the pages adjacent to a page of texts. Empty links are omitted.
+type Links struct {
+	Next, Prev string
+}
+
+// HTMLPage renders a page of texts like [HTML], with links to adjacent pages.
+func HTMLPage(texts []*text.Text, links Links, to io.Writer) error {
+	tmpl, err := parseHTML("html", htmlTemplate)
 	if err != nil {
 		return fmt.Errorf("error parsing template: %w", err)
 	}
-	if err := tmpl.Execute(to, texts); err != nil {
+	data := struct {
+		Texts []*text.Text
+		Links Links
+	}{texts, links}
+	if err := tmpl.Execute(to, data); err != nil {
 		return fmt.Errorf("error executing template: %w", err)
 	}
 	return nil
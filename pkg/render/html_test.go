@@ -0,0 +1,23 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderHTMLPage(t *testing.T) {
+	texts := []*text.Text{{ID: "adadada0", Title: "My Text", Tags: []string{"go"}}}
+
+	var unpaginated strings.Builder
+	assert.NoError(t, HTML(texts, &unpaginated))
+	assert.Contains(t, unpaginated.String(), "My Text")
+	assert.NotContains(t, unpaginated.String(), `rel="next"`)
+
+	var paginated strings.Builder
+	assert.NoError(t, HTMLPage(texts, Links{Next: "/texts?cursor=abc&limit=1"}, &paginated))
+	assert.Contains(t, paginated.String(), `href="/texts?cursor=abc&amp;limit=1" rel="next">Next`, "labels don't assume an order")
+	assert.NotContains(t, paginated.String(), `rel="prev"`)
+}
@@ -14,6 +14,7 @@ import (
 //		"url": "https://davidchall.github.io/ggip/articles/visualizing-ip-data.html",
 //		"author": "David Hall",
 //		"note": "Use a Hilbert Curve: efficient 2D packing that keeps consecutive sequences spatially contiguous.",
+//		"tags": ["visualization", "networking"],
 //		"id": "35bb8126",
 //		"timestamp": "2023-04-07T21:43:52.776451-07:00"
 //	}]
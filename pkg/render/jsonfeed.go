@@ -21,6 +21,7 @@ import (
 //				"title": "Visualizing IP data",
 //				"content_text": "Use a Hilbert Curve: efficient 2D packing that keeps consecutive sequences spatially contiguous.",
 //				"date_published": "2023-04-07T21:43:52-07:00",
+//				"tags": ["visualization", "networking"],
 //				"authors": [
 //	 				{
 //						"name": "David Hall"
@@ -42,6 +43,7 @@ func JSONFeed(texts []*text.Text, to io.Writer) error {
 		item.Authors = []jsonfeed.Author{author}
 
 		item.ContentText = text.Note
+		item.Tags = text.Tags
 		item.DatePublished = text.Timestamp.Format(time.RFC3339)
 
 		items[i] = item
@@ -4,6 +4,7 @@ import (
 	_ "embed" // Compile-time dependency.
 	"fmt"
 	"io"
+	"strings"
 	"text/template"
 
 	"github.com/lukasschwab/tiir/pkg/text"
@@ -19,7 +20,7 @@ var plainTextTemplate string
 //
 //		Use a Hilbert Curve: efficient 2D packing that keeps consecutive sequences spatially contiguous.
 func Plain(texts []*text.Text, to io.Writer) error {
-	tmpl, err := template.New("plain").Parse(plainTextTemplate)
+	tmpl, err := template.New("plain").Funcs(template.FuncMap{"join": strings.Join}).Parse(plainTextTemplate)
 	if err != nil {
 		return fmt.Errorf("error parsing template: %w", err)
 	}
@@ -18,6 +18,7 @@ func TestRenderPlainText(t *testing.T) {
 			URL:    fmt.Sprintf("github.com/lukasschwab/tiir/pkg/text/%d", i),
 			Author: "L. Schwab",
 			Note:   fmt.Sprintf("This is my note for text #%d. What a good text!", i),
+			Tags:   []string{fmt.Sprintf("tag%d", i)},
 		}
 		assert.NoError(t, someText.Validate())
 		texts[i] = someText
@@ -28,6 +29,7 @@ func TestRenderPlainText(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.NotZero(t, rendered.Len())
+	assert.Contains(t, rendered.String(), "#tag3")
 
 	t.Log(rendered.String())
 }
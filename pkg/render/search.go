@@ -0,0 +1,63 @@
+package render
+
+import (
+	_ "embed" // Compile-time dependency.
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+)
+
+//go:embed templates/plain_search.tmpl
+var plainSearchTemplate string
+
+//go:embed templates/search.tmpl
+var htmlSearchTemplate string
+
+// SearchFunction renders search results, ordered by decreasing relevance, to
+// the provided io.Writer. Provided implementations:
+//
+//   - [PlainSearch]
+//   - [JSONSearch]
+//   - [HTMLSearch]
+type SearchFunction func(query string, results []search.Result, to io.Writer) error
+
+// PlainSearch renders results like [Plain], replacing each note with a
+// snippet of the best-matching field. Matches are *emphasized*.
+func PlainSearch(_ string, results []search.Result, to io.Writer) error {
+	tmpl, err := template.New("plain_search").Parse(plainSearchTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	if err := tmpl.Execute(to, results); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
+
+// JSONSearch renders results as a JSON list of [search.Result].
+func JSONSearch(_ string, results []search.Result, to io.Writer) error {
+	if results == nil {
+		results = []search.Result{}
+	}
+	return json.NewEncoder(to).Encode(results)
+}
+
+// HTMLSearch renders results as an HTML table like [HTML], marking matches in
+// each snippet.
+func HTMLSearch(query string, results []search.Result, to io.Writer) error {
+	tmpl, err := parseHTML("search", htmlSearchTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	data := struct {
+		Query   string
+		Results []search.Result
+	}{query, results}
+	if err := tmpl.Execute(to, data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderSearch(t *testing.T) {
+	results := []search.Result{{
+		Text:    &text.Text{ID: "adadada0", Title: "My Text", Note: "Clear is better than clever."},
+		Score:   1,
+		Snippet: search.Snippet{{Text: "Clear is better than "}, {Text: "clever", Match: true}, {Text: "."}},
+	}}
+
+	var plain strings.Builder
+	assert.NoError(t, PlainSearch("clever", results, &plain))
+	assert.Contains(t, plain.String(), "[adadada0] My Text")
+	assert.Contains(t, plain.String(), "Clear is better than *clever*.")
+
+	var html strings.Builder
+	assert.NoError(t, HTMLSearch("<clever>", results, &html))
+	assert.Contains(t, html.String(), "Clear is better than <mark>clever</mark>.")
+	assert.Contains(t, html.String(), `value="&lt;clever&gt;"`)
+
+	var json strings.Builder
+	assert.NoError(t, JSONSearch("missing", nil, &json))
+	assert.Equal(t, "[]\n", json.String())
+}
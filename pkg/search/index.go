@@ -0,0 +1,139 @@
+package search
+
+import (
+	"math"
+	"sort"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// BM25 parameters, matching FTS5's bm25 function.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// minIDF replaces nonpositive IDFs, as in FTS5.
+	minIDF = 1e-6
+)
+
+// Index is an inverted index of texts' searchable fields. It isn't safe for
+// concurrent use; callers synchronize access.
+type Index struct {
+	// postings maps each term to the IDs of documents containing it.
+	postings map[string]map[string]bool
+	// documents maps each ID to its term frequencies.
+	documents map[string]map[string]int
+	// lengths maps each ID to its token count.
+	lengths     map[string]int
+	totalLength int
+}
+
+// NewIndex constructs an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		postings:  map[string]map[string]bool{},
+		documents: map[string]map[string]int{},
+		lengths:   map[string]int{},
+	}
+}
+
+// Add t's searchable fields to the index, replacing any previous version of
+// t.
+func (idx *Index) Add(t *text.Text) {
+	id := t.ID
+	idx.Remove(id)
+
+	frequencies := map[string]int{}
+	length := 0
+	for _, field := range fields(t) {
+		for _, token := range Tokenize(field) {
+			frequencies[token.Term]++
+			length++
+		}
+	}
+	for term := range frequencies {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[string]bool{}
+		}
+		idx.postings[term][id] = true
+	}
+	idx.documents[id] = frequencies
+	idx.lengths[id] = length
+	idx.totalLength += length
+}
+
+// Remove the text with id from the index, if it's present.
+func (idx *Index) Remove(id string) {
+	frequencies, ok := idx.documents[id]
+	if !ok {
+		return
+	}
+	for term := range frequencies {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= idx.lengths[id]
+	delete(idx.documents, id)
+	delete(idx.lengths, id)
+}
+
+// Hit is a document matching a query and its bm25 relevance score.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Search for documents containing every term in query, ranked by decreasing
+// bm25 score, then by ID. If limit is positive, Search returns at most limit
+// hits.
+func (idx *Index) Search(query string, limit int) []Hit {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Candidates contain every term.
+	var candidates []string
+	for id := range idx.postings[terms[0]] {
+		matchesAll := true
+		for _, term := range terms[1:] {
+			if !idx.postings[term][id] {
+				matchesAll = false
+				break
+			}
+		}
+		if matchesAll {
+			candidates = append(candidates, id)
+		}
+	}
+
+	documentCount := float64(len(idx.documents))
+	averageLength := float64(idx.totalLength) / documentCount
+	hits := make([]Hit, len(candidates))
+	for i, id := range candidates {
+		var score float64
+		for _, term := range terms {
+			frequency := float64(idx.documents[id][term])
+			matchCount := float64(len(idx.postings[term]))
+			idf := math.Log((documentCount - matchCount + 0.5) / (matchCount + 0.5))
+			if idf <= 0 {
+				idf = minIDF
+			}
+			lengthRatio := float64(idx.lengths[id]) / averageLength
+			score += idf * (frequency * (bm25K1 + 1)) / (frequency + bm25K1*(1-bm25B+bm25B*lengthRatio))
+		}
+		hits[i] = Hit{ID: id, Score: score}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
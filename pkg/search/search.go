@@ -0,0 +1,84 @@
+// Package search ranks texts against free-text queries. It provides the
+// in-process inverted [Index] used by stores without native full-text search,
+// and [Highlight] for rendering matches consistently across stores.
+//
+// Tokenization and ranking mirror SQLite's FTS5 defaults (the unicode61
+// tokenizer and bm25 ranking) so results are consistent across stores.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Result of a search: a matching text, its relevance, and a highlighted
+// excerpt.
+type Result struct {
+	Text *text.Text `json:"text"`
+	// Score is the text's relevance; higher is more relevant.
+	Score   float64 `json:"score"`
+	Snippet Snippet `json:"snippet"`
+}
+
+// Token is a normalized word and its byte offsets in the original string.
+type Token struct {
+	Term       string
+	Start, End int
+}
+
+// Tokenize s like FTS5's unicode61 tokenizer: tokens are runs of letters and
+// digits, folded to lower case and stripped of diacritics, so "café" matches
+// "cafe".
+func Tokenize(s string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range s {
+		isTokenRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isTokenRune && start < 0 {
+			start = i
+		} else if !isTokenRune && start >= 0 {
+			tokens = append(tokens, Token{fold(s[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, Token{fold(s[start:]), start, len(s)})
+	}
+	return tokens
+}
+
+// fold word to lower case without diacritics: decompose it, then drop
+// combining marks, e.g. the acute accent of "é".
+func fold(word string) string {
+	// Transformers are stateful, so each call needs its own.
+	removeDiacritics := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(removeDiacritics, strings.ToLower(word))
+	if err != nil {
+		return strings.ToLower(word)
+	}
+	return folded
+}
+
+// Terms in query, deduplicated. A text matches query if it contains every
+// term.
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, token := range Tokenize(query) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
+
+// fields of t that are searchable, in FTS5 column order.
+func fields(t *text.Text) []string {
+	return []string{t.Title, t.Author, t.Note}
+}
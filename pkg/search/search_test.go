@@ -0,0 +1,66 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Hello, wörld! 42x")
+	assert.Equal(t, []Token{{"hello", 0, 5}, {"world", 7, 13}, {"42x", 15, 18}}, tokens)
+	assert.Equal(t, []string{"go", "proverbs"}, Terms("Go proverbs, go!"))
+	assert.Empty(t, Terms(" -- "))
+}
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex()
+	proverbs := &text.Text{ID: "a", Title: "Go Proverbs", Note: "Clear is better than clever"}
+	clever := &text.Text{ID: "b", Title: "Clever code", Note: "Clever, clever, clever"}
+	idx.Add(proverbs)
+	idx.Add(clever)
+	idx.Add(&text.Text{ID: "c", Title: "Unrelated"})
+
+	hits := idx.Search("clever", 0)
+	assert.Len(t, hits, 2)
+	assert.Equal(t, "b", hits[0].ID, "more frequent terms rank higher")
+	assert.Equal(t, "a", hits[1].ID)
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+
+	assert.Len(t, idx.Search("clever", 1), 1)
+	both := idx.Search("clever proverbs", 0)
+	assert.Len(t, both, 1, "all terms must match")
+	assert.Equal(t, "a", both[0].ID)
+	assert.Empty(t, idx.Search("clever missing", 0))
+
+	// Reindexing a modified text replaces its old terms.
+	proverbs.Note = "Errors are values"
+	idx.Add(proverbs)
+	assert.Len(t, idx.Search("clever", 0), 1)
+	assert.Len(t, idx.Search("errors", 0), 1)
+
+	idx.Remove("b")
+	assert.Empty(t, idx.Search("clever", 0))
+}
+
+func TestHighlight(t *testing.T) {
+	snippet := Highlight(&text.Text{Title: "Go Proverbs", Note: "Clear is better than clever."}, "CLEVER go proverbs")
+	assert.Equal(t, Snippet{{Text: "Go", Match: true}, {Text: " "}, {Text: "Proverbs", Match: true}}, snippet, "the title has the most matches")
+
+	snippet = Highlight(&text.Text{Note: "Clear is better than clever, and clever is fine."}, "clever")
+	assert.Equal(t, Snippet{
+		{Text: "Clear is better than "},
+		{Text: "clever", Match: true},
+		{Text: ", and "},
+		{Text: "clever", Match: true},
+		{Text: " is fine."},
+	}, snippet)
+	assert.Equal(t, "Clear is better than clever, and clever is fine.", snippet.String())
+
+	long := &text.Text{Note: "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty"}
+	snippet = Highlight(long, "nineteen")
+	assert.Equal(t, "…five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen seventeen eighteen nineteen twenty", snippet.String())
+	snippet = Highlight(long, "two")
+	assert.Equal(t, "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen…", snippet.String())
+}
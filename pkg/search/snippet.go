@@ -0,0 +1,105 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// snippetTokens is the maximum number of tokens in a snippet.
+const snippetTokens = 16
+
+// ellipsis marks text omitted from a snippet.
+const ellipsis = "…"
+
+// Snippet is an excerpt of a text's field, split into fragments that do or
+// don't match the query.
+type Snippet []Fragment
+
+// Fragment of a snippet.
+type Fragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// String is the snippet's plain text, without highlighting.
+func (s Snippet) String() string {
+	var b strings.Builder
+	for _, fragment := range s {
+		b.WriteString(fragment.Text)
+	}
+	return b.String()
+}
+
+// Highlight excerpts the field of t with the most matches for query's terms:
+// its note, title, or author, preferring them in that order.
+func Highlight(t *text.Text, query string) Snippet {
+	terms := map[string]bool{}
+	for _, term := range Terms(query) {
+		terms[term] = true
+	}
+
+	best, bestMatches := t.Note, 0
+	for _, field := range []string{t.Note, t.Title, t.Author} {
+		matches := 0
+		for _, token := range Tokenize(field) {
+			if terms[token.Term] {
+				matches++
+			}
+		}
+		if matches > bestMatches {
+			best, bestMatches = field, matches
+		}
+	}
+	return excerpt(best, terms)
+}
+
+// excerpt field around its first token in terms, marking every such token.
+func excerpt(field string, terms map[string]bool) Snippet {
+	tokens := Tokenize(field)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// Start a few tokens before the first match, for context.
+	first := 0
+	for i, token := range tokens {
+		if terms[token.Term] {
+			first = i
+			break
+		}
+	}
+	start := max(0, min(first-snippetTokens/4, len(tokens)-snippetTokens))
+	end := min(len(tokens), start+snippetTokens)
+
+	var snippet Snippet
+	appendText := func(s string, match bool) {
+		if s == "" {
+			return
+		}
+		// Merge adjacent fragments of the same kind.
+		if last := len(snippet) - 1; last >= 0 && snippet[last].Match == match {
+			snippet[last].Text += s
+			return
+		}
+		snippet = append(snippet, Fragment{Text: s, Match: match})
+	}
+
+	position := tokens[start].Start
+	if start > 0 {
+		appendText(ellipsis, false)
+	} else {
+		position = 0
+	}
+	for _, token := range tokens[start:end] {
+		appendText(field[position:token.Start], false)
+		appendText(field[token.Start:token.End], terms[token.Term])
+		position = token.End
+	}
+	if end < len(tokens) {
+		appendText(ellipsis, false)
+	} else {
+		appendText(field[position:], false)
+	}
+	return snippet
+}
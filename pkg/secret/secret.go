@@ -0,0 +1,163 @@
+// Package secret reads secrets, e.g. API secrets and auth tokens, from where
+// users keep them: the output of a command like "pass show tir", a file, or the
+// OS keyring.
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Service names tir's items in keyrings.
+const Service = "tir"
+
+// ErrNotFound is returned by [Keyring.Get] for accounts without a secret.
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// Secret is a secret setting: its value, or where to read it from. Use the
+// first that's set of Value, Command, File, and Account.
+type Secret struct {
+	Value string
+	// Command is a shell command printing the secret.
+	Command string
+	// File contains the secret.
+	File string
+	// Account in Keyring holding the secret.
+	Account string
+	// Keyring holding Account; by default, [SecretService].
+	Keyring Keyring
+}
+
+// IsZero reports whether s doesn't set a secret.
+func (s Secret) IsZero() bool {
+	return s.Value == "" && s.Command == "" && s.File == "" && s.Account == ""
+}
+
+// Get the secret, running its command or reading its file or keyring item if
+// necessary. Surrounding whitespace is trimmed from secrets read from commands
+// and files. Returns an empty string if s is zero.
+func (s Secret) Get() (string, error) {
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+	case s.Command != "":
+		command := exec.Command("sh", "-c", s.Command)
+		if runtime.GOOS == "windows" {
+			command = exec.Command("cmd", "/C", s.Command)
+		}
+		var stderr bytes.Buffer
+		command.Stdin, command.Stderr = os.Stdin, &stderr
+		output, err := command.Output()
+		if err != nil {
+			return "", fmt.Errorf("error running %q: %w: %s", s.Command, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return strings.TrimSpace(string(output)), nil
+	case s.File != "":
+		contents, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %w", err)
+		}
+		return strings.TrimSpace(string(contents)), nil
+	case s.Account != "":
+		keyring := s.Keyring
+		if keyring == nil {
+			keyring = SecretService()
+		}
+		secret, err := keyring.Get(s.Account)
+		if errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("%w: no secret for %q in %v; store one with tir auth login", err, s.Account, keyring)
+		} else if err != nil {
+			return "", fmt.Errorf("error reading %q from %v: %w", s.Account, keyring, err)
+		}
+		return secret, nil
+	default:
+		return "", nil
+	}
+}
+
+// Keyring stores secrets by account.
+type Keyring interface {
+	// Get the secret for account, or an error wrapping [ErrNotFound].
+	Get(account string) (string, error)
+	// Set the secret for account.
+	Set(account, secret string) error
+}
+
+// SecretService is the OS keyring: the Secret Service, over D-Bus, on Linux
+// and BSDs; the Keychain on macOS; or the Windows Credential Manager.
+func SecretService() Keyring { return secretService{} }
+
+type secretService struct{}
+
+func (secretService) Get(account string) (string, error) {
+	secret, err := keyring.Get(Service, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+func (secretService) Set(account, secret string) error {
+	return keyring.Set(Service, account, secret)
+}
+
+func (secretService) String() string { return "the OS keyring" }
+
+// File is a keyring in a JSON file, readable only by its owner, at path. It
+// stands in for the OS keyring where there isn't one, e.g. in tests; it
+// doesn't encrypt secrets.
+func File(path string) Keyring { return fileKeyring(path) }
+
+type fileKeyring string
+
+func (path fileKeyring) read() (map[string]string, error) {
+	secrets := make(map[string]string)
+	contents, err := os.ReadFile(string(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(contents, &secrets); err != nil {
+		return nil, fmt.Errorf("error parsing keyring file: %w", err)
+	}
+	return secrets, nil
+}
+
+func (path fileKeyring) Get(account string) (string, error) {
+	secrets, err := path.read()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func (path fileKeyring) Set(account, secret string) error {
+	secrets, err := path.read()
+	if err != nil {
+		return err
+	}
+	secrets[account] = secret
+	contents, err := json.MarshalIndent(secrets, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(string(path)), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(string(path), contents, 0o600)
+}
+
+func (path fileKeyring) String() string { return fmt.Sprintf("keyring file %v", string(path)) }
@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0o600))
+	keyring := File(filepath.Join(dir, "keyring.json"))
+	require.NoError(t, keyring.Set("tir.example.com", "from-keyring"))
+
+	for name, test := range map[string]struct {
+		secret Secret
+		want   string
+	}{
+		"zero":    {Secret{}, ""},
+		"value":   {Secret{Value: "value", Command: "echo command"}, "value"},
+		"command": {Secret{Command: "echo ' from-command '"}, "from-command"},
+		"file":    {Secret{File: file}, "from-file"},
+		"keyring": {Secret{Account: "tir.example.com", Keyring: keyring}, "from-keyring"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.secret.Get()
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err := Secret{Command: "echo oops >&2; exit 1"}.Get()
+	assert.ErrorContains(t, err, "oops")
+	_, err = Secret{Account: "other.example.com", Keyring: keyring}.Get()
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tir", "keyring.json")
+	keyring := File(path)
+	_, err := keyring.Get("account")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, keyring.Set("account", "one"))
+	require.NoError(t, keyring.Set("other", "two"))
+	require.NoError(t, keyring.Set("account", "three"))
+	secret, err := keyring.Get("account")
+	require.NoError(t, err)
+	assert.Equal(t, "three", secret)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchesAreAtomic(t *testing.T) {
+	for name, start := range map[string]func(t *testing.T) Interface{
+		"memory": func(t *testing.T) Interface { return useMemory() },
+		"file": func(t *testing.T) Interface {
+			s, err := useFile(filepath.Join(t.TempDir(), "tir.json"), nil)
+			require.NoError(t, err)
+			return s
+		},
+		"jsonl": func(t *testing.T) Interface {
+			s, err := UseJSONL(filepath.Join(t.TempDir(), "tir.jsonl"))
+			require.NoError(t, err)
+			return s
+		},
+		"bolt": func(t *testing.T) Interface { return startBolt(t) },
+		"markdown": func(t *testing.T) Interface {
+			s, err := useMarkdown(t.TempDir())
+			require.NoError(t, err)
+			return s
+		},
+		"git":    func(t *testing.T) Interface { return startGit(t, t.TempDir(), "") },
+		"libsql": func(t *testing.T) Interface { return startLocalLibSQL(t) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := start(t)
+			a, b := syncText("aaaaaaaa", "A", time.Time{}), syncText("bbbbbbbb", "B", time.Time{})
+			upserted, err := s.UpsertMany(t.Context(), []*text.Text{a, b})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb"}, ids(upserted))
+			assert.Equal(t, map[string]string{"aaaaaaaa": "A", "bbbbbbbb": "B"}, titles(t, s))
+
+			_, err = s.DeleteMany(t.Context(), []string{"aaaaaaaa", "cccccccc"})
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.Equal(t, map[string]string{"aaaaaaaa": "A", "bbbbbbbb": "B"}, titles(t, s), "deleted texts despite the missing one")
+
+			deleted, err := s.DeleteMany(t.Context(), []string{"bbbbbbbb", "aaaaaaaa"})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"bbbbbbbb", "aaaaaaaa"}, ids(deleted))
+			assert.Empty(t, titles(t, s))
+		})
+	}
+}
+
+// batchServer mimics cmd/server's POST /texts:batch route for m.
+func batchServer(t testing.TB, m Interface) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /texts:batch", func(w http.ResponseWriter, r *http.Request) {
+		batch := new(Batch)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(batch))
+		var texts []*text.Text
+		var err error
+		if len(batch.Delete) > 0 {
+			texts, err = m.DeleteMany(r.Context(), batch.Delete)
+		} else {
+			texts, err = m.UpsertMany(r.Context(), batch.Upsert)
+		}
+		if err != nil {
+			problem := NewProblem(err, http.StatusInternalServerError)
+			w.Header().Set("Content-Type", ProblemContentType)
+			w.WriteHeader(problem.Status)
+			require.NoError(t, json.NewEncoder(w).Encode(problem))
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(BatchResult{Texts: texts}))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPBatches(t *testing.T) {
+	m := useMemory()
+	s, err := UseHTTP(batchServer(t, m).URL, "")
+	require.NoError(t, err)
+
+	a, b := syncText("aaaaaaaa", "A", time.Time{}), syncText("bbbbbbbb", "B", time.Time{})
+	upserted, err := s.UpsertMany(t.Context(), []*text.Text{a, b})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb"}, ids(upserted))
+	assert.Equal(t, map[string]string{"aaaaaaaa": "A", "bbbbbbbb": "B"}, titles(t, m))
+
+	_, err = s.DeleteMany(t.Context(), []string{"aaaaaaaa", "cccccccc"})
+	assert.ErrorIs(t, err, ErrNotFound)
+	deleted, err := s.DeleteMany(t.Context(), []string{"aaaaaaaa"})
+	require.NoError(t, err)
+	assert.Equal(t, "A", deleted[0].Title)
+	assert.Equal(t, map[string]string{"bbbbbbbb": "B"}, titles(t, m))
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt client defaults.
+const defaultBoltOpenTimeout = 1 * time.Second
+
+// Bolt buckets.
+var (
+	// textsBucket maps IDs to JSON-encoded texts.
+	textsBucket = []byte("texts")
+	// timestampBucket indexes texts by timestampKey.
+	timestampBucket = []byte("texts_by_timestamp")
+	// authorBucket indexes texts by authorKey.
+	authorBucket = []byte("texts_by_author")
+)
+
+// UseBolt at path as a bbolt database. If the file doesn't exist, it's created.
+//
+// bbolt locks the database file while it's open: another process opening it
+// waits briefly, then fails.
+func UseBolt(path string) (Interface, error) {
+	return useBolt(path)
+}
+
+func useBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: defaultBoltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening DB: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{textsBucket, timestampBucket, authorBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return fmt.Errorf("error creating bucket %s: %w", bucket, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Bolt implements [Interface] on a bbolt key-value database; see [UseBolt].
+//
+// Texts are stored by ID, and indexed by timestamp and by author: List scans
+// the index for its sort field, stopping once it has q.Limit texts, rather
+// than loading and sorting every text.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// boltIndex is a secondary index: a bucket whose keys order texts, with empty
+// values.
+type boltIndex struct {
+	bucket []byte
+	// key for t, which sorts like t in Query order (breaking ties by ID).
+	key func(t *text.Text) []byte
+	// id of the text a key indexes.
+	id func(key []byte) string
+}
+
+var (
+	timestampIndex = boltIndex{timestampBucket, timestampKey, func(key []byte) string { return string(key[timestampLength:]) }}
+	authorIndex    = boltIndex{authorBucket, authorKey, func(key []byte) string { return string(key[bytes.LastIndexByte(key, 0)+1:]) }}
+	boltIndexes    = []boltIndex{timestampIndex, authorIndex}
+)
+
+// timestampKey is t's timestamp, then its ID. Timestamps are encoded as
+// big-endian seconds (offset so negative values sort first) and nanoseconds,
+// so keys sort chronologically for any time.
+func timestampKey(t *text.Text) []byte {
+	return append(timestampPrefix(t.Timestamp), t.ID...)
+}
+
+// timestampLength is the length of a timestampKey's timestamp prefix.
+const timestampLength = 12
+
+func timestampPrefix(timestamp time.Time) []byte {
+	key := make([]byte, timestampLength)
+	binary.BigEndian.PutUint64(key, uint64(timestamp.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(key[8:], uint32(timestamp.Nanosecond()))
+	return key
+}
+
+// authorKey is t's author, then a NUL separator, then its ID. Authors are
+// compared bytewise, like [text.Authors].
+func authorKey(t *text.Text) []byte {
+	key := append([]byte(t.Author), 0)
+	return append(key, t.ID...)
+}
+
+// getText gets the text with id from tx.
+func getText(tx *bolt.Tx, id string) (*text.Text, error) {
+	value := tx.Bucket(textsBucket).Get([]byte(id))
+	if value == nil {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	}
+	t := new(text.Text)
+	if err := json.Unmarshal(value, t); err != nil {
+		return nil, fmt.Errorf("error decoding text '%v': %w", id, err)
+	}
+	return t, nil
+}
+
+// removeText removes t and its index entries from tx.
+func removeText(tx *bolt.Tx, t *text.Text) error {
+	for _, index := range boltIndexes {
+		if err := tx.Bucket(index.bucket).Delete(index.key(t)); err != nil {
+			return fmt.Errorf("error deindexing text: %w", err)
+		}
+	}
+	return tx.Bucket(textsBucket).Delete([]byte(t.ID))
+}
+
+// Read implements [Interface].
+func (b *Bolt) Read(ctx context.Context, id string) (t *text.Text, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		t, err = getText(tx, id)
+		return err
+	})
+	return t, err
+}
+
+// putText in the texts bucket, replacing and unindexing any existing text
+// with its ID, and index it.
+func putText(tx *bolt.Tx, t *text.Text) error {
+	value, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("error encoding text: %w", err)
+	}
+	if extant, err := getText(tx, t.ID); err == nil {
+		if err := removeText(tx, extant); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(textsBucket).Put([]byte(t.ID), value); err != nil {
+		return fmt.Errorf("error writing text: %w", err)
+	}
+	for _, index := range boltIndexes {
+		if err := tx.Bucket(index.bucket).Put(index.key(t), nil); err != nil {
+			return fmt.Errorf("error indexing text: %w", err)
+		}
+	}
+	return nil
+}
+
+// Upsert implements [Interface].
+func (b *Bolt) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		return putText(tx, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UpsertMany implements [Interface] in a single transaction.
+func (b *Bolt) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, t := range texts {
+			if err := putText(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// Delete implements [Interface].
+func (b *Bolt) Delete(ctx context.Context, id string) (t *text.Text, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if t, err = getText(tx, id); err != nil {
+			return err
+		}
+		return removeText(tx, t)
+	})
+	return t, err
+}
+
+// DeleteMany implements [Interface] in a single transaction.
+func (b *Bolt) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	texts := make([]*text.Text, len(ids))
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for i, id := range ids {
+			t, err := getText(tx, id)
+			if err != nil {
+				return err
+			} else if err := removeText(tx, t); err != nil {
+				return err
+			}
+			texts[i] = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// List implements [Interface]. Queries sorted by timestamp or author scan the
+// corresponding index; others load every text and [Query.Apply].
+func (b *Bolt) List(ctx context.Context, q Query) (texts []*text.Text, err error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	err = b.db.View(func(tx *bolt.Tx) error {
+		switch q.Sort {
+		case "", SortTimestamp:
+			var lower, upper []byte
+			if !q.Since.IsZero() {
+				lower = timestampPrefix(q.Since)
+			}
+			if !q.Until.IsZero() {
+				upper = timestampPrefix(q.Until)
+			}
+			texts, err = scanIndex(ctx, tx, timestampIndex, q, lower, upper)
+		case SortAuthor:
+			texts, err = scanIndex(ctx, tx, authorIndex, q, nil, nil)
+		default:
+			var all []*text.Text
+			if all, err = loadTexts(tx); err == nil {
+				texts, err = q.Apply(all)
+			}
+		}
+		return err
+	})
+	return texts, err
+}
+
+// scanIndex scans idx for texts matching q, in q's direction, within keys [lower, upper)
+// (nil bounds are unbounded). Applies q's After, Offset, and Limit.
+func scanIndex(ctx context.Context, tx *bolt.Tx, idx boltIndex, q Query, lower, upper []byte) ([]*text.Text, error) {
+	// After narrows the scan to keys strictly beyond it. The least key
+	// greater than k is k followed by a zero byte.
+	if q.After != nil {
+		after := idx.key(q.After)
+		if q.Direction == text.Descending && (upper == nil || bytes.Compare(after, upper) < 0) {
+			upper = after
+		} else if q.Direction == text.Ascending && bytes.Compare(append(after, 0), lower) > 0 {
+			lower = append(after, 0)
+		}
+	}
+
+	cursor := tx.Bucket(idx.bucket).Cursor()
+	var key []byte
+	var next func() ([]byte, []byte)
+	var inRange func(key []byte) bool
+	if q.Direction == text.Descending {
+		next = cursor.Prev
+		inRange = func(key []byte) bool { return lower == nil || bytes.Compare(key, lower) >= 0 }
+		if upper == nil {
+			key, _ = cursor.Last()
+		} else if key, _ = cursor.Seek(upper); key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+	} else {
+		next = cursor.Next
+		inRange = func(key []byte) bool { return upper == nil || bytes.Compare(key, upper) < 0 }
+		if lower == nil {
+			key, _ = cursor.First()
+		} else {
+			key, _ = cursor.Seek(lower)
+		}
+	}
+
+	texts := []*text.Text{}
+	skipped := 0
+	for ; key != nil && inRange(key); key, _ = next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		t, err := getText(tx, idx.id(key))
+		if err != nil {
+			return nil, err
+		} else if !q.Matches(t) {
+			continue
+		} else if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		texts = append(texts, t)
+		if q.Limit > 0 && len(texts) == q.Limit {
+			break
+		}
+	}
+	return texts, nil
+}
+
+// loadTexts loads every text in tx.
+func loadTexts(tx *bolt.Tx) ([]*text.Text, error) {
+	texts := []*text.Text{}
+	err := tx.Bucket(textsBucket).ForEach(func(id, value []byte) error {
+		t := new(text.Text)
+		if err := json.Unmarshal(value, t); err != nil {
+			return fmt.Errorf("error decoding text '%s': %w", id, err)
+		}
+		texts = append(texts, t)
+		return nil
+	})
+	return texts, err
+}
+
+// Search implements [Interface] with an in-memory index of every text.
+func (b *Bolt) Search(ctx context.Context, query string, limit int) (results []search.Result, err error) {
+	var texts []*text.Text
+	err = b.db.View(func(tx *bolt.Tx) error {
+		texts, err = loadTexts(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return useMemory(texts...).Search(ctx, query, limit)
+}
+
+// Close implements [Interface].
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// startBolt in a temporary directory, loaded with fixtures.
+func startBolt(t *testing.T, fixtures ...*text.Text) *Bolt {
+	b, err := useBolt(filepath.Join(t.TempDir(), "tir.db"))
+	require.NoError(t, err)
+	for _, fixture := range fixtures {
+		_, err := b.Upsert(t.Context(), fixture)
+		require.NoError(t, err)
+	}
+	return b
+}
+
+// indexed IDs in bucket, in key order.
+func indexed(t *testing.T, b *Bolt, idx boltIndex) []string {
+	ids := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(idx.bucket).ForEach(func(key, _ []byte) error {
+			ids = append(ids, idx.id(key))
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	return ids
+}
+
+func TestBoltMaintainsIndexes(t *testing.T) {
+	b := startBolt(t, queryFixtures()...)
+	defer b.Close()
+	assert.Equal(t, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb", "cccccccc"}, indexed(t, b, timestampIndex))
+	assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb", "dddddddd", "cccccccc"}, indexed(t, b, authorIndex))
+
+	// Updating a text replaces its index entries.
+	updated := queryFixtures()[0]
+	updated.Author = "Zed"
+	updated.Timestamp = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := b.Upsert(t.Context(), updated)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "bbbbbbbb", "cccccccc", "aaaaaaaa"}, indexed(t, b, timestampIndex))
+	assert.Equal(t, []string{"bbbbbbbb", "dddddddd", "cccccccc", "aaaaaaaa"}, indexed(t, b, authorIndex))
+
+	// Deleting a text removes them.
+	_, err = b.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "cccccccc", "aaaaaaaa"}, indexed(t, b, timestampIndex))
+	assert.Equal(t, []string{"dddddddd", "cccccccc", "aaaaaaaa"}, indexed(t, b, authorIndex))
+
+	_, err = b.Delete(t.Context(), "bbbbbbbb")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBoltTimestampKeysSortChronologically(t *testing.T) {
+	times := []time.Time{
+		{},
+		time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 4, 7, 12, 0, 0, 1, time.UTC),
+		time.Date(2023, 4, 7, 13, 0, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	}
+	for i := 1; i < len(times); i++ {
+		assert.Less(t, string(timestampPrefix(times[i-1])), string(timestampPrefix(times[i])), times[i])
+	}
+}
+
+func TestBoltPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tir.db")
+	b, err := UseBolt(path)
+	require.NoError(t, err)
+	_, err = b.Upsert(t.Context(), queryFixtures()[0])
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	b, err = UseBolt(path)
+	require.NoError(t, err)
+	defer b.Close()
+	read, err := b.Read(t.Context(), "aaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "Visualizing IP data", read.Title)
+}
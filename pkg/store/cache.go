@@ -0,0 +1,545 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// UseCache wraps remote in a [Cache], which serves reads from mirror while
+// remote is unavailable and queues changes in a file at outboxPath. The Cache
+// owns remote and mirror: closing it closes them.
+func UseCache(remote, mirror Interface, outboxPath string) (Interface, error) {
+	return useCache(remote, mirror, outboxPath)
+}
+
+func useCache(remote, mirror Interface, outboxPath string) (*Cache, error) {
+	lock, err := openLock(outboxPath + lockSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+	return &Cache{fileLock: fileLock{lock: lock}, remote: remote, mirror: mirror, outboxPath: outboxPath, ttl: cacheTTL}, nil
+}
+
+// cacheTTL is how long a [Cache] serves lists and searches from its mirror
+// before refreshing it from the remote.
+const cacheTTL = 5 * time.Minute
+
+// refreshedSuffix names the file, next to the outbox, recording when a
+// [Cache] last refreshed its mirror.
+const refreshedSuffix = ".refreshed"
+
+// Cache implements [Interface] and [Outbox] as an offline-first decorator
+// around a remote store, e.g. [HTTP]. See [UseCache].
+//
+// Each operation first replays changes queued in the outbox. Read reads from
+// the remote; List and Search read from the mirror, a local copy of the
+// remote's texts. Cache refreshes the mirror after replaying changes, when
+// it's older than a few minutes, and on [Cache.Replay]. If the remote is
+// unavailable (see [ErrUnavailable]), Cache serves reads from the mirror as it
+// was, and applies changes to the mirror while queueing them in the outbox.
+//
+// A queued change conflicts if the remote text changed after the change was
+// queued; Cache keeps conflicting changes, and later changes to the same
+// text, in the outbox until they're resolved with [Cache.Resolve].
+type Cache struct {
+	// fileLock on the outbox serializes operations across processes.
+	fileLock
+	remote     Interface
+	mirror     Interface
+	outboxPath string
+	// ttl after which the mirror is refreshed; see [cacheTTL].
+	ttl time.Duration
+}
+
+// replacer is implemented by stores that can replace all their texts at once,
+// e.g. in a single commit, so refreshing a mirror is a single write.
+type replacer interface {
+	replace(ctx context.Context, texts []*text.Text) error
+}
+
+// load pending changes from c's outbox.
+func (c *Cache) load() ([]*PendingChange, error) {
+	contents, err := os.ReadFile(c.outboxPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*PendingChange{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't read outbox: %w", err)
+	}
+	outbox := []*PendingChange{}
+	if err := json.Unmarshal(contents, &outbox); err != nil {
+		return nil, fmt.Errorf("couldn't parse outbox %v: %w", c.outboxPath, err)
+	}
+	return outbox, nil
+}
+
+// save outbox as c's pending changes.
+func (c *Cache) save(outbox []*PendingChange) error {
+	contents, err := json.MarshalIndent(outbox, "", "\t")
+	if err != nil {
+		return fmt.Errorf("couldn't marshal outbox: %w", err)
+	} else if _, err := replaceFile(c.outboxPath, contents); err != nil {
+		return fmt.Errorf("couldn't write outbox: %w", err)
+	}
+	return nil
+}
+
+// sync replays c's pending changes and, if none remain, refreshes the mirror
+// from the remote if any were replayed, if the mirror is stale, or if force is
+// set. Returns an error wrapping [ErrUnavailable] if the remote is
+// unavailable.
+func (c *Cache) sync(ctx context.Context, force bool) ([]*PendingChange, error) {
+	outbox, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	replayed := len(outbox) > 0
+	if replayed {
+		remaining, err := c.replay(ctx, outbox)
+		if saveErr := c.save(remaining); saveErr != nil {
+			return nil, saveErr
+		} else if err != nil || len(remaining) > 0 {
+			// The mirror holds changes the remote doesn't yet; keep it.
+			return remaining, err
+		}
+		outbox = remaining
+	}
+	if !replayed && !force && !c.stale() {
+		return outbox, nil
+	}
+	return outbox, c.refresh(ctx)
+}
+
+// stale reports whether c's mirror was last refreshed longer than c.ttl ago,
+// or never.
+func (c *Cache) stale() bool {
+	contents, err := os.ReadFile(c.outboxPath + refreshedSuffix)
+	if err != nil {
+		return true
+	}
+	refreshed, err := time.Parse(time.RFC3339Nano, string(contents))
+	return err != nil || time.Since(refreshed) > c.ttl
+}
+
+// replay outbox to the remote in order, returning the changes still pending.
+// Stops at the first change for which the remote is unavailable. Marks changes
+// that conflict with the remote, keeping them and any later changes to the
+// same text.
+func (c *Cache) replay(ctx context.Context, outbox []*PendingChange) ([]*PendingChange, error) {
+	remaining := []*PendingChange{}
+	blocked := map[string]bool{}
+	for i, change := range outbox {
+		if blocked[change.ID] || change.Conflict != "" {
+			blocked[change.ID] = true
+			remaining = append(remaining, change)
+			continue
+		}
+		var validation *text.ValidationError
+		if err := c.apply(ctx, change, outbox[i+1:]); errors.Is(err, ErrConflict) || errors.As(err, &validation) {
+			log.Printf("[WARN] change to %v conflicts with remote: %v", change.ID, err)
+			change.Conflict = err.Error()
+			blocked[change.ID] = true
+			remaining = append(remaining, change)
+		} else if err != nil {
+			return append(remaining, outbox[i:]...), err
+		}
+	}
+	return remaining, nil
+}
+
+// apply change to the remote, unless the remote text changed since change was
+// queued. If the remote assigns a created text a new ID, later changes to it
+// are updated to match.
+func (c *Cache) apply(ctx context.Context, change *PendingChange, later []*PendingChange) error {
+	current, err := c.remote.Read(ctx, change.ID)
+	if errors.Is(err, ErrNotFound) {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+
+	switch change.Op {
+	case string(opUpsert):
+		if sameText(current, change.Text) {
+			return nil
+		} else if !sameText(current, change.Base) {
+			return fmt.Errorf("%w: remote text changed after local update at %v", ErrConflict, change.At.Format(time.DateTime))
+		}
+		result, err := c.remote.Upsert(ctx, change.Text)
+		if err != nil {
+			return err
+		} else if result.ID != change.ID {
+			return c.remap(ctx, change.ID, result, later)
+		}
+		return nil
+	case string(opDelete):
+		if current == nil {
+			return nil
+		} else if !sameText(current, change.Base) {
+			return fmt.Errorf("%w: remote text changed after local delete at %v", ErrConflict, change.At.Format(time.DateTime))
+		}
+		if _, err := c.remote.Delete(ctx, change.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q", change.Op)
+	}
+}
+
+// remap the text with id to created, the text the remote created for it with
+// a different ID (e.g. [HTTP] against a server that assigns IDs to new texts).
+func (c *Cache) remap(ctx context.Context, id string, created *text.Text, later []*PendingChange) error {
+	log.Printf("remote created %v as %v", id, created.ID)
+	if _, err := c.mirror.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("error updating mirror: %w", err)
+	} else if _, err := c.mirror.Upsert(ctx, created); err != nil {
+		return fmt.Errorf("error updating mirror: %w", err)
+	}
+	for _, change := range later {
+		if change.ID != id {
+			continue
+		}
+		change.ID = created.ID
+		for _, t := range []**text.Text{&change.Text, &change.Base} {
+			if *t != nil {
+				remapped := **t
+				remapped.ID = created.ID
+				*t = &remapped
+			}
+		}
+	}
+	return nil
+}
+
+// refresh the mirror with the remote's texts, if they differ.
+func (c *Cache) refresh(ctx context.Context) error {
+	remote, err := c.remote.List(ctx, Query{})
+	if err != nil {
+		return err
+	}
+	local, err := c.mirror.List(ctx, Query{})
+	if err != nil {
+		return fmt.Errorf("error reading mirror: %w", err)
+	}
+	if err := c.update(ctx, remote, local); err != nil {
+		return err
+	}
+	refreshed := []byte(time.Now().Format(time.RFC3339Nano))
+	if _, err := replaceFile(c.outboxPath+refreshedSuffix, refreshed); err != nil {
+		return fmt.Errorf("couldn't record refresh: %w", err)
+	}
+	return nil
+}
+
+// update the mirror, which holds local, to hold remote instead.
+func (c *Cache) update(ctx context.Context, remote, local []*text.Text) error {
+	if slices.EqualFunc(remote, local, sameText) {
+		return nil
+	}
+	if r, ok := c.mirror.(replacer); ok {
+		return r.replace(ctx, remote)
+	}
+
+	present := map[string]bool{}
+	for _, t := range remote {
+		present[t.ID] = true
+		if _, err := c.mirror.Upsert(ctx, t); err != nil {
+			return fmt.Errorf("error updating mirror: %w", err)
+		}
+	}
+	for _, t := range local {
+		if present[t.ID] {
+			continue
+		} else if _, err := c.mirror.Delete(ctx, t.ID); err != nil {
+			return fmt.Errorf("error updating mirror: %w", err)
+		}
+	}
+	return nil
+}
+
+// sameText reports whether t1 and t2 have the same contents. Either may be
+// nil, meaning there's no such text.
+func sameText(t1, t2 *text.Text) bool {
+	if t1 == nil || t2 == nil {
+		return t1 == t2
+	}
+	return t1.Equal(t2)
+}
+
+// offline reports whether err means the remote is unavailable, logging it if
+// so. The mirror serves operations while the remote is offline.
+func offline(err error) bool {
+	if errors.Is(err, ErrUnavailable) {
+		log.Printf("[WARN] using cached texts: %v", err)
+		return true
+	}
+	return false
+}
+
+// queue change in outbox, after applying it to the mirror.
+func (c *Cache) queue(ctx context.Context, outbox []*PendingChange, change *PendingChange) error {
+	base, err := c.mirror.Read(ctx, change.ID)
+	if errors.Is(err, ErrNotFound) {
+		base = nil
+	} else if err != nil {
+		return fmt.Errorf("error reading mirror: %w", err)
+	}
+	change.Base = base
+
+	if change.Op == string(opUpsert) {
+		_, err = c.mirror.Upsert(ctx, change.Text)
+	} else {
+		_, err = c.mirror.Delete(ctx, change.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating mirror: %w", err)
+	}
+	return c.save(append(outbox, change))
+}
+
+// write change to the remote with operation, or queue it if the remote is
+// offline or has earlier pending changes to the same text.
+func (c *Cache) write(ctx context.Context, change *PendingChange, operation func() (*text.Text, error)) (*text.Text, error) {
+	var result *text.Text
+	err := c.withLock(exclusiveLock, func() error {
+		outbox, err := c.sync(ctx, false)
+		if offline(err) || slices.ContainsFunc(outbox, func(pending *PendingChange) bool { return pending.ID == change.ID }) {
+			return c.queue(ctx, outbox, change)
+		} else if err != nil {
+			return err
+		}
+
+		if result, err = operation(); offline(err) {
+			return c.queue(ctx, outbox, change)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	} else if result == nil {
+		// Queued.
+		result = change.Text
+	}
+	return result, nil
+}
+
+// read from the mirror with operation after syncing it.
+func (c *Cache) read(ctx context.Context, operation func() error) error {
+	return c.withLock(exclusiveLock, func() error {
+		if _, err := c.sync(ctx, false); err != nil && !offline(err) {
+			return err
+		}
+		return operation()
+	})
+}
+
+// Read implements [Interface]. It reads from the remote, updating the mirror,
+// unless the remote is unavailable or the text has pending changes.
+func (c *Cache) Read(ctx context.Context, id string) (t *text.Text, err error) {
+	err = c.withLock(exclusiveLock, func() error {
+		outbox, err := c.sync(ctx, false)
+		if offline(err) || slices.ContainsFunc(outbox, func(pending *PendingChange) bool { return pending.ID == id }) {
+			t, err = c.mirror.Read(ctx, id)
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		t, err = c.remote.Read(ctx, id)
+		if offline(err) {
+			t, err = c.mirror.Read(ctx, id)
+			return err
+		} else if errors.Is(err, ErrNotFound) {
+			if _, deleteErr := c.mirror.Delete(ctx, id); deleteErr != nil && !errors.Is(deleteErr, ErrNotFound) {
+				return fmt.Errorf("error updating mirror: %w", deleteErr)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		return c.remember(ctx, t)
+	})
+	return t, err
+}
+
+// remember t, just read from the remote, in the mirror.
+func (c *Cache) remember(ctx context.Context, t *text.Text) error {
+	mirrored, err := c.mirror.Read(ctx, t.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("error reading mirror: %w", err)
+	} else if sameText(mirrored, t) {
+		return nil
+	} else if _, err := c.mirror.Upsert(ctx, t); err != nil {
+		return fmt.Errorf("error updating mirror: %w", err)
+	}
+	return nil
+}
+
+// Upsert implements [Interface].
+func (c *Cache) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	change := &PendingChange{Op: string(opUpsert), At: time.Now(), ID: t.ID, Text: t}
+	return c.write(ctx, change, func() (*text.Text, error) {
+		result, err := c.remote.Upsert(ctx, t)
+		if err != nil {
+			return nil, err
+		} else if result.ID != t.ID {
+			if _, err := c.mirror.Delete(ctx, t.ID); err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, fmt.Errorf("error updating mirror: %w", err)
+			}
+		}
+		if _, err := c.mirror.Upsert(ctx, result); err != nil {
+			return nil, fmt.Errorf("error updating mirror: %w", err)
+		}
+		return result, nil
+	})
+}
+
+// Delete implements [Interface]. While the remote is offline, it deletes
+// texts from the mirror.
+func (c *Cache) Delete(ctx context.Context, id string) (*text.Text, error) {
+	var deleted *text.Text
+	change := &PendingChange{Op: string(opDelete), At: time.Now(), ID: id}
+	_, err := c.write(ctx, change, func() (*text.Text, error) {
+		t, err := c.remote.Delete(ctx, id)
+		if err != nil {
+			return nil, err
+		} else if _, err := c.mirror.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("error updating mirror: %w", err)
+		}
+		deleted = t
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	} else if deleted == nil {
+		// Queued: the mirror's text is the base of the change.
+		deleted = change.Base
+	}
+	return deleted, nil
+}
+
+// UpsertMany implements [Interface]. It writes each text in turn, so that
+// changes made while the remote is offline are queued individually: it isn't
+// atomic.
+func (c *Cache) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	results := make([]*text.Text, len(texts))
+	for i, t := range texts {
+		var err error
+		if results[i], err = c.Upsert(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// DeleteMany implements [Interface]. Like [Cache.UpsertMany], it deletes each
+// text in turn.
+func (c *Cache) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	results := make([]*text.Text, len(ids))
+	for i, id := range ids {
+		var err error
+		if results[i], err = c.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// List implements [Interface].
+func (c *Cache) List(ctx context.Context, q Query) (texts []*text.Text, err error) {
+	err = c.read(ctx, func() error {
+		texts, err = c.mirror.List(ctx, q)
+		return err
+	})
+	return texts, err
+}
+
+// Search implements [Interface].
+func (c *Cache) Search(ctx context.Context, query string, limit int) (results []search.Result, err error) {
+	err = c.read(ctx, func() error {
+		results, err = c.mirror.Search(ctx, query, limit)
+		return err
+	})
+	return results, err
+}
+
+// Pending implements [Outbox].
+func (c *Cache) Pending(ctx context.Context) (outbox []*PendingChange, err error) {
+	err = c.withLock(sharedLock, func() error {
+		outbox, err = c.load()
+		return err
+	})
+	return outbox, err
+}
+
+// Replay implements [Outbox]. If no changes remain pending, it refreshes the
+// mirror.
+func (c *Cache) Replay(ctx context.Context) (outbox []*PendingChange, err error) {
+	err = c.withLock(exclusiveLock, func() error {
+		outbox, err = c.sync(ctx, true)
+		return err
+	})
+	return outbox, err
+}
+
+// Resolve implements [Outbox]. Keeping the local change requires the remote
+// to be available.
+func (c *Cache) Resolve(ctx context.Context, id string, keepLocal bool) error {
+	return c.withLock(exclusiveLock, func() error {
+		outbox, err := c.load()
+		if err != nil {
+			return err
+		}
+		conflicted := slices.ContainsFunc(outbox, func(change *PendingChange) bool {
+			return change.ID == id && change.Conflict != ""
+		})
+		if !conflicted {
+			return fmt.Errorf("%w: no conflicting changes to '%v'", ErrNotFound, id)
+		}
+
+		current, err := c.remote.Read(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			current = nil
+		} else if err != nil {
+			return err
+		}
+		if keepLocal {
+			// Rebase the first conflicting change onto the remote text.
+			for _, change := range outbox {
+				if change.ID == id && change.Conflict != "" {
+					change.Base, change.Conflict = current, ""
+					break
+				}
+			}
+		} else {
+			outbox = slices.DeleteFunc(outbox, func(change *PendingChange) bool { return change.ID == id })
+			if current == nil {
+				_, err = c.mirror.Delete(ctx, id)
+			} else {
+				_, err = c.mirror.Upsert(ctx, current)
+			}
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("error updating mirror: %w", err)
+			}
+		}
+		if err := c.save(outbox); err != nil {
+			return err
+		}
+		_, err = c.sync(ctx, true)
+		return err
+	})
+}
+
+// Close implements [Interface].
+func (c *Cache) Close() error {
+	return errors.Join(c.remote.Close(), c.mirror.Close(), c.lock.Close())
+}
@@ -0,0 +1,246 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyRemote is a memory store that fails with ErrUnavailable while offline.
+// If it assigns IDs, it creates texts with new IDs, like cmd/server.
+type flakyRemote struct {
+	*Memory
+	offline   bool
+	assignIDs bool
+	// lists counts calls to List.
+	lists int
+}
+
+func (r *flakyRemote) check() error {
+	if r.offline {
+		return fmt.Errorf("%w: offline", ErrUnavailable)
+	}
+	return nil
+}
+
+func (r *flakyRemote) Read(ctx context.Context, id string) (*text.Text, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r.Memory.Read(ctx, id)
+}
+
+func (r *flakyRemote) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	if _, err := r.Memory.Read(ctx, t.ID); errors.Is(err, ErrNotFound) && r.assignIDs {
+		created := *t
+		created.ID = "assigned"
+		t = &created
+	}
+	return r.Memory.Upsert(ctx, t)
+}
+
+func (r *flakyRemote) Delete(ctx context.Context, id string) (*text.Text, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r.Memory.Delete(ctx, id)
+}
+
+func (r *flakyRemote) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	results := make([]*text.Text, len(texts))
+	for i, t := range texts {
+		var err error
+		if results[i], err = r.Upsert(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func (r *flakyRemote) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r.Memory.DeleteMany(ctx, ids)
+}
+
+func (r *flakyRemote) List(ctx context.Context, q Query) ([]*text.Text, error) {
+	r.lists++
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r.Memory.List(ctx, q)
+}
+
+// startCache around a flaky remote holding fixtures, mirrored by a file store.
+func startCache(t *testing.T, fixtures ...*text.Text) (*Cache, *flakyRemote) {
+	dir := t.TempDir()
+	remote := &flakyRemote{Memory: useMemory(fixtures...)}
+	mirror, err := useFile(filepath.Join(dir, "mirror.json"), nil)
+	require.NoError(t, err)
+	c, err := useCache(remote, mirror, filepath.Join(dir, "outbox.json"))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, c.Close()) })
+	return c, remote
+}
+
+func TestCacheQueuesChangesOffline(t *testing.T) {
+	fixtures := queryFixtures()
+	c, remote := startCache(t, fixtures...)
+
+	texts, err := c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb", "cccccccc"}, ids(texts))
+
+	// Offline, reads are served from the mirror, and changes are queued.
+	remote.offline = true
+	_, err = c.Delete(t.Context(), "cccccccc")
+	require.NoError(t, err)
+	updated := *fixtures[0]
+	updated.Note = "Updated offline"
+	_, err = c.Upsert(t.Context(), &updated)
+	require.NoError(t, err)
+	texts, err = c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb"}, ids(texts))
+	read, err := c.Read(t.Context(), "aaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "Updated offline", read.Note)
+
+	pending, err := c.Pending(t.Context())
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "delete", pending[0].Op)
+	assert.Equal(t, "upsert", pending[1].Op)
+	assert.Equal(t, fixtures[0].Note, pending[1].Base.Note)
+
+	// Online, the next operation replays them.
+	remote.offline = false
+	_, err = c.Read(t.Context(), "aaaaaaaa")
+	require.NoError(t, err)
+	pending, err = c.Pending(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	read, err = remote.Memory.Read(t.Context(), "aaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "Updated offline", read.Note)
+	_, err = remote.Memory.Read(t.Context(), "cccccccc")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCacheReportsConflicts(t *testing.T) {
+	for _, keepLocal := range []bool{true, false} {
+		t.Run(fmt.Sprintf("keepLocal=%v", keepLocal), func(t *testing.T) {
+			fixtures := queryFixtures()
+			c, remote := startCache(t, fixtures...)
+			_, err := c.List(t.Context(), Query{})
+			require.NoError(t, err)
+
+			remote.offline = true
+			local := *fixtures[0]
+			local.Note = "Updated locally"
+			_, err = c.Upsert(t.Context(), &local)
+			require.NoError(t, err)
+			// Someone else updates the text on the remote.
+			remoteUpdate := *fixtures[0]
+			remoteUpdate.Note = "Updated remotely"
+			_, err = remote.Memory.Upsert(t.Context(), &remoteUpdate)
+			require.NoError(t, err)
+
+			remote.offline = false
+			pending, err := c.Replay(t.Context())
+			require.NoError(t, err)
+			require.Len(t, pending, 1)
+			assert.Contains(t, pending[0].Conflict, "remote text changed")
+			read, err := remote.Memory.Read(t.Context(), "aaaaaaaa")
+			require.NoError(t, err)
+			assert.Equal(t, "Updated remotely", read.Note, "conflicting changes aren't applied")
+
+			require.NoError(t, c.Resolve(t.Context(), "aaaaaaaa", keepLocal))
+			pending, err = c.Pending(t.Context())
+			require.NoError(t, err)
+			assert.Empty(t, pending)
+			want := "Updated remotely"
+			if keepLocal {
+				want = "Updated locally"
+			}
+			read, err = remote.Memory.Read(t.Context(), "aaaaaaaa")
+			require.NoError(t, err)
+			assert.Equal(t, want, read.Note)
+			read, err = c.Read(t.Context(), "aaaaaaaa")
+			require.NoError(t, err)
+			assert.Equal(t, want, read.Note)
+		})
+	}
+}
+
+func TestCacheRemapsAssignedIDs(t *testing.T) {
+	c, remote := startCache(t)
+	remote.assignIDs = true
+
+	remote.offline = true
+	created := queryFixtures()[0]
+	_, err := c.Upsert(t.Context(), created)
+	require.NoError(t, err)
+	updated := *created
+	updated.Note = "Updated"
+	_, err = c.Upsert(t.Context(), &updated)
+	require.NoError(t, err)
+
+	remote.offline = false
+	pending, err := c.Replay(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	texts, err := c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assigned"}, ids(texts))
+	assert.Equal(t, "Updated", texts[0].Note)
+}
+
+func TestCacheRefreshesMirror(t *testing.T) {
+	fixtures := queryFixtures()
+	c, remote := startCache(t, fixtures...)
+
+	_, err := c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, remote.lists, "should fill an empty mirror")
+
+	// Someone else changes the remote.
+	remoteUpdate := *fixtures[0]
+	remoteUpdate.Note = "Updated remotely"
+	_, err = remote.Memory.Upsert(t.Context(), &remoteUpdate)
+	require.NoError(t, err)
+
+	read, err := c.Read(t.Context(), "aaaaaaaa")
+	require.NoError(t, err)
+	assert.Equal(t, "Updated remotely", read.Note, "Read reads from the remote")
+	_, err = c.Search(t.Context(), "anything", 0)
+	require.NoError(t, err)
+	texts, err := c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, remote.lists, "shouldn't list the remote while the mirror is fresh")
+	assert.Equal(t, "Updated remotely", texts[1].Note, "Read updates the mirror")
+
+	_, err = remote.Memory.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	_, err = c.Replay(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 2, remote.lists, "Replay refreshes the mirror")
+	texts, err = c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "aaaaaaaa", "cccccccc"}, ids(texts))
+
+	c.ttl = 0
+	_, err = c.List(t.Context(), Query{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, remote.lists, "should refresh a stale mirror")
+}
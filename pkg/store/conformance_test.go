@@ -0,0 +1,61 @@
+package store_test
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/lukasschwab/tiir/pkg/store/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConformance runs the storetest suite against every built-in store but
+// [store.HTTP], which cmd/server's tests run against its handler.
+func TestConformance(t *testing.T) {
+	// open returns a function that opens a store, failing t on error.
+	open := func(t *testing.T) func(store.Interface, error) store.Interface {
+		return func(s store.Interface, err error) store.Interface {
+			require.NoError(t, err)
+			return s
+		}
+	}
+	for name, newStore := range map[string]func(t *testing.T) store.Interface{
+		"memory": func(t *testing.T) store.Interface { return store.UseMemory() },
+		"file": func(t *testing.T) store.Interface {
+			return open(t)(store.UseFile(filepath.Join(t.TempDir(), "tir.json")))
+		},
+		"encrypted_file": func(t *testing.T) store.Interface {
+			dir := t.TempDir()
+			key, err := store.GenerateKeyFile(filepath.Join(dir, "key"))
+			require.NoError(t, err)
+			return open(t)(store.UseEncryptedFile(filepath.Join(dir, "tir.json"), key))
+		},
+		"jsonl": func(t *testing.T) store.Interface {
+			return open(t)(store.UseJSONL(filepath.Join(t.TempDir(), "tir.jsonl")))
+		},
+		"markdown": func(t *testing.T) store.Interface { return open(t)(store.UseMarkdown(t.TempDir())) },
+		"git": func(t *testing.T) store.Interface {
+			if _, err := exec.LookPath("git"); err != nil {
+				t.Skip("git isn't installed")
+			}
+			return open(t)(store.UseGit(t.TempDir(), ""))
+		},
+		"bolt": func(t *testing.T) store.Interface {
+			return open(t)(store.UseBolt(filepath.Join(t.TempDir(), "tir.db")))
+		},
+		"libsql": func(t *testing.T) store.Interface {
+			return open(t)(store.UseLibSQL(fmt.Sprintf("file://%s", filepath.Join(t.TempDir(), "tir.db"))))
+		},
+		"cache": func(t *testing.T) store.Interface {
+			dir := t.TempDir()
+			mirror := open(t)(store.UseFile(filepath.Join(dir, "mirror.json")))
+			return open(t)(store.UseCache(store.UseMemory(), mirror, filepath.Join(dir, "outbox.json")))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			storetest.Run(t, newStore)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// copyBatchSize is the number of texts [Copy] writes at once.
+const copyBatchSize = 100
+
+// CopyOptions configure [Copy].
+type CopyOptions struct {
+	// Overwrite texts in the destination that differ from the source's texts
+	// with the same ID.
+	Overwrite bool
+	// SkipExisting leaves texts in the destination that differ from the
+	// source's texts with the same ID unchanged.
+	SkipExisting bool
+	// DryRun counts the changes Copy would make without making them.
+	DryRun bool
+	// Progress, if set, is called after each batch of source texts is copied
+	// (or skipped) with the number of texts done and the total.
+	Progress func(done, total int)
+}
+
+// CopyResult summarizes a [Copy].
+type CopyResult struct {
+	Created     int
+	Overwritten int
+	// Skipped lists the IDs of texts left unchanged in the destination because
+	// of [CopyOptions.SkipExisting].
+	Skipped []string
+	// Unchanged texts were already in the destination.
+	Unchanged int
+	// IDs maps the ID of each text the destination stored with a different ID
+	// (e.g. [HTTP] against a server that assigns IDs to new texts) to its new ID.
+	IDs map[string]string
+}
+
+// Copy every text in from to to. Texts already in to are left unchanged; if a
+// text in to differs from from's text with the same ID, Copy fails with
+// [ErrConflict] before writing anything unless opts.Overwrite or
+// opts.SkipExisting is set.
+//
+// Texts are written in batches with [Interface.UpsertMany]. If a batch fails, the batches before
+// it remain copied.
+func Copy(ctx context.Context, from, to Interface, opts CopyOptions) (*CopyResult, error) {
+	if opts.Overwrite && opts.SkipExisting {
+		return nil, fmt.Errorf("can't both overwrite and skip existing texts")
+	}
+	sources, err := from.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing source texts: %w", err)
+	}
+	destinations, err := to.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing destination texts: %w", err)
+	}
+	existing := byID(destinations)
+
+	// Plan every write before making any, so conflicts fail the copy early.
+	result := &CopyResult{IDs: map[string]string{}}
+	writes := make([]*text.Text, len(sources))
+	for i, source := range sources {
+		switch current, ok := existing[source.ID]; {
+		case !ok:
+			result.Created++
+			writes[i] = source
+		case current.Equal(source):
+			result.Unchanged++
+		case opts.SkipExisting:
+			result.Skipped = append(result.Skipped, source.ID)
+		case opts.Overwrite:
+			result.Overwritten++
+			writes[i] = source
+		default:
+			return nil, fmt.Errorf("%w: text '%v' differs in the destination", ErrConflict, source.ID)
+		}
+	}
+
+	for start := 0; start < len(writes); start += copyBatchSize {
+		end := min(start+copyBatchSize, len(writes))
+		batch := slices.DeleteFunc(slices.Clone(writes[start:end]), func(t *text.Text) bool { return t == nil })
+		if len(batch) > 0 && !opts.DryRun {
+			written, err := to.UpsertMany(ctx, batch)
+			if err != nil {
+				return result, fmt.Errorf("error copying texts: %w", err)
+			}
+			for i, t := range written {
+				if t.ID != batch[i].ID {
+					result.IDs[batch[i].ID] = t.ID
+				}
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(end, len(sources))
+		}
+	}
+	return result, nil
+}
+
+// Mismatch is a difference between two stores found by [Verify].
+type Mismatch struct {
+	ID string
+	// Reason describes the difference, e.g. "missing from destination".
+	Reason string
+}
+
+// Verify that every text in from is in to, record by record, after copied
+// made a [Copy]. Verify ignores the texts copied skipped, and expects texts
+// copied stored with different IDs to have those IDs. If copied is nil, Verify
+// checks every text by its ID in from.
+func Verify(ctx context.Context, from, to Interface, copied *CopyResult) ([]Mismatch, error) {
+	if copied == nil {
+		copied = &CopyResult{}
+	}
+	sources, err := from.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing source texts: %w", err)
+	}
+	destinations, err := to.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing destination texts: %w", err)
+	}
+	existing := byID(destinations)
+
+	mismatches := []Mismatch{}
+	for _, source := range sources {
+		if slices.Contains(copied.Skipped, source.ID) {
+			continue
+		}
+		expected := *source
+		if id, ok := copied.IDs[source.ID]; ok {
+			expected.ID = id
+		}
+		actual, ok := existing[expected.ID]
+		if !ok {
+			mismatches = append(mismatches, Mismatch{ID: source.ID, Reason: "missing from destination"})
+		} else if fields := differingFields(&expected, actual); len(fields) > 0 {
+			mismatches = append(mismatches, Mismatch{ID: source.ID, Reason: fmt.Sprintf("destination has different %v", fields)})
+		}
+	}
+	return mismatches, nil
+}
+
+// differingFields of t1 and t2, by JSON name. Compares the fields compared by
+// [text.Text.Equal].
+func differingFields(t1, t2 *text.Text) []string {
+	fields := []string{}
+	for _, field := range []struct {
+		name  string
+		equal bool
+	}{
+		{"title", t1.Title == t2.Title},
+		{"url", t1.URL == t2.URL},
+		{"author", t1.Author == t2.Author},
+		{"note", t1.Note == t2.Note},
+		{"timestamp", t1.Timestamp.Equal(t2.Timestamp)},
+		{"tags", slices.Equal(t1.Tags, t2.Tags)},
+		{"status", t1.Status == t2.Status},
+	} {
+		if !field.equal {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyUnnamedTimeZones(t *testing.T) {
+	// Parsing a timestamp with a numeric offset yields an unnamed time zone.
+	var timestamp time.Time
+	require.NoError(t, json.Unmarshal([]byte(`"2023-04-07T12:00:00.5-07:00"`), &timestamp))
+	source := syncText("aaaaaaaa", "unnamed zone", time.Time{})
+	source.Timestamp = timestamp
+
+	destination := startLocalLibSQL(t)
+	result, err := Copy(t.Context(), useMemory(source), destination, CopyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Created)
+
+	mismatches, err := Verify(t.Context(), useMemory(source), destination, result)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestCopyExistingTexts(t *testing.T) {
+	sources := useMemory(syncText("aaaaaaaa", "same", time.Time{}), syncText("bbbbbbbb", "source", time.Time{}), syncText("cccccccc", "new", time.Time{}))
+	start := func() *Memory {
+		return useMemory(syncText("aaaaaaaa", "same", time.Now()), syncText("bbbbbbbb", "destination", time.Time{}))
+	}
+
+	destination := start()
+	_, err := Copy(t.Context(), sources, destination, CopyOptions{})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.Len(t, titles(t, destination), 2, "conflicts fail before writing")
+
+	result, err := Copy(t.Context(), sources, destination, CopyOptions{Overwrite: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, &CopyResult{Created: 1, Overwritten: 1, Unchanged: 1, IDs: map[string]string{}}, result)
+	assert.Len(t, titles(t, destination), 2, "dry runs don't write")
+
+	result, err = Copy(t.Context(), sources, destination, CopyOptions{SkipExisting: true})
+	require.NoError(t, err)
+	assert.Equal(t, &CopyResult{Created: 1, Skipped: []string{"bbbbbbbb"}, Unchanged: 1, IDs: map[string]string{}}, result)
+	assert.Equal(t, "destination", titles(t, destination)["bbbbbbbb"])
+	mismatches, err := Verify(t.Context(), sources, destination, result)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches, "skipped texts aren't verified")
+	mismatches, err = Verify(t.Context(), sources, destination, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Mismatch{{ID: "bbbbbbbb", Reason: "destination has different [title]"}}, mismatches)
+
+	destination = start()
+	var progress []int
+	result, err = Copy(t.Context(), sources, destination, CopyOptions{Overwrite: true, Progress: func(done, total int) {
+		assert.Equal(t, 3, total)
+		progress = append(progress, done)
+	}})
+	require.NoError(t, err)
+	// The texts fit in a single batch.
+	assert.Equal(t, []int{3}, progress)
+	assert.Equal(t, titles(t, sources), titles(t, destination))
+	mismatches, err = Verify(t.Context(), sources, destination, result)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestCopyToAssignedIDs(t *testing.T) {
+	sources := useMemory(syncText("aaaaaaaa", "title", time.Time{}))
+	destination := &flakyRemote{Memory: useMemory(), assignIDs: true}
+
+	result, err := Copy(t.Context(), sources, destination, CopyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"aaaaaaaa": "assigned"}, result.IDs)
+
+	mismatches, err := Verify(t.Context(), sources, destination, result)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+	mismatches, err = Verify(t.Context(), sources, destination, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Mismatch{{ID: "aaaaaaaa", Reason: "missing from destination"}}, mismatches)
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrWrongKey means an encrypted store couldn't be decrypted with the key it
+// was opened with: a wrong passphrase or key file.
+var ErrWrongKey = errors.New("wrong passphrase or key")
+
+// keySize is the size of AES-256 keys, and of key files' keys.
+const keySize = 32
+
+// Key to an [EncryptedFile]: a passphrase, or a random key read from a key
+// file. Construct one with [Passphrase] or [ReadKeyFile].
+type Key struct {
+	passphrase []byte
+	raw        []byte
+}
+
+// Passphrase is a [Key] derived from passphrase with Argon2id.
+func Passphrase(passphrase string) Key {
+	return Key{passphrase: []byte(passphrase)}
+}
+
+// ReadKeyFile reads a [Key] from a file at path holding a base64-encoded
+// 32-byte key, e.g. one written by [GenerateKeyFile].
+func ReadKeyFile(path string) (Key, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("couldn't read key file: %w", err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(contents)))
+	if err != nil || len(raw) != keySize {
+		return Key{}, fmt.Errorf("key file %v must hold a base64-encoded %d-byte key", path, keySize)
+	}
+	return Key{raw: raw}, nil
+}
+
+// GenerateKeyFile writes a random key to a new file at path, readable only by
+// its owner, and returns it. Fails if the file exists.
+func GenerateKeyFile(path string) (Key, error) {
+	raw := make([]byte, keySize)
+	rand.Read(raw)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return Key{}, fmt.Errorf("couldn't create key file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(raw)); err != nil {
+		return Key{}, fmt.Errorf("couldn't write key file: %w", err)
+	} else if err := f.Sync(); err != nil {
+		return Key{}, fmt.Errorf("couldn't write key file: %w", err)
+	}
+	return Key{raw: raw}, nil
+}
+
+// Key derivation functions recorded in sealed files.
+const (
+	kdfArgon2id = "argon2id"
+	// kdfNone means the file is sealed with a key file's key as is.
+	kdfNone = "none"
+)
+
+// argon2Params are Argon2id's cost parameters.
+type argon2Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// defaultArgon2Params are RFC 9106's second recommended option: 64 MiB of
+// memory and 3 passes.
+var defaultArgon2Params = argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// sealedHeader describes how a file was sealed. It's authenticated, but not
+// encrypted: tampering with it fails decryption.
+type sealedHeader struct {
+	// Version of the format; always 1.
+	Version int           `json:"tir_encrypted"`
+	KDF     string        `json:"kdf"`
+	Salt    []byte        `json:"salt,omitempty"`
+	Argon2  *argon2Params `json:"argon2,omitempty"`
+}
+
+// sealedFile is the JSON contents of an encrypted file store.
+type sealedFile struct {
+	sealedHeader
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// sealer encrypts and decrypts a store file's contents with AES-256-GCM.
+type sealer struct {
+	key    Key
+	params argon2Params
+	// header and aead are for the file last opened or sealed; aead caches the
+	// key derived for header, which is slow to derive.
+	header *sealedHeader
+	aead   cipher.AEAD
+}
+
+// use header to seal and open files, deriving its key if necessary.
+func (s *sealer) use(header *sealedHeader) error {
+	if s.header != nil && s.aead != nil {
+		current, _ := json.Marshal(s.header)
+		next, _ := json.Marshal(header)
+		if bytes.Equal(current, next) {
+			return nil
+		}
+	}
+
+	var key []byte
+	switch {
+	case header.Version != 1:
+		return fmt.Errorf("unsupported encrypted file version %d", header.Version)
+	case header.KDF == kdfArgon2id && s.key.passphrase == nil:
+		return fmt.Errorf("%w: the store is encrypted with a passphrase, not a key file", ErrWrongKey)
+	case header.KDF == kdfArgon2id && header.Argon2 != nil:
+		p := header.Argon2
+		key = argon2.IDKey(s.key.passphrase, header.Salt, p.Time, p.Memory, p.Threads, keySize)
+	case header.KDF == kdfNone && s.key.raw == nil:
+		return fmt.Errorf("%w: the store is encrypted with a key file, not a passphrase", ErrWrongKey)
+	case header.KDF == kdfNone:
+		key = s.key.raw
+	default:
+		return fmt.Errorf("unsupported key derivation %q", header.KDF)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("couldn't create cipher: %w", err)
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return fmt.Errorf("couldn't create cipher: %w", err)
+	}
+	s.header = header
+	return nil
+}
+
+// newHeader for sealing a new file with s's key: a fresh salt, if the key is
+// a passphrase.
+func (s *sealer) newHeader() *sealedHeader {
+	if s.key.passphrase == nil {
+		return &sealedHeader{Version: 1, KDF: kdfNone}
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	params := s.params
+	return &sealedHeader{Version: 1, KDF: kdfArgon2id, Salt: salt, Argon2: &params}
+}
+
+// open sealed contents, returning the plaintext.
+func (s *sealer) open(contents []byte) ([]byte, error) {
+	var sealed sealedFile
+	if err := json.Unmarshal(contents, &sealed); err != nil || sealed.Version == 0 {
+		return nil, errors.New("file isn't encrypted; copy it to an encrypted store with tir copy")
+	} else if err := s.use(&sealed.sealedHeader); err != nil {
+		return nil, err
+	}
+	additionalData, _ := json.Marshal(sealed.sealedHeader)
+	plaintext, err := s.aead.Open(nil, sealed.Nonce, sealed.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// seal plaintext with s's current header, or a new one if s hasn't opened a
+// file.
+func (s *sealer) seal(plaintext []byte) ([]byte, error) {
+	if s.header == nil {
+		if err := s.use(s.newHeader()); err != nil {
+			return nil, err
+		}
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	additionalData, _ := json.Marshal(s.header)
+	sealed := sealedFile{
+		sealedHeader: *s.header,
+		Nonce:        nonce,
+		Ciphertext:   s.aead.Seal(nil, nonce, plaintext, additionalData),
+	}
+	return json.MarshalIndent(sealed, "", "\t")
+}
+
+// UseEncryptedFile at path as a JSON store encrypted with key. If the file
+// doesn't exist, it's created and initialized to an empty store. Returns
+// [ErrWrongKey] if the file is encrypted with a different key.
+//
+// Texts are never written to disk unencrypted; see [EncryptedFile].
+func UseEncryptedFile(path string, key Key) (Interface, error) {
+	return useEncryptedFile(path, key, defaultArgon2Params)
+}
+
+func useEncryptedFile(path string, key Key, params argon2Params) (*EncryptedFile, error) {
+	f, err := useFile(path, &sealer{key: key, params: params})
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFile{File: f}, nil
+}
+
+// EncryptedFile implements [Interface] and [Rekeyer] like [File], but seals the
+// file with AES-256-GCM, using a key derived from a passphrase with Argon2id
+// or read from a key file. See [UseEncryptedFile].
+type EncryptedFile struct {
+	*File
+}
+
+// Rekey implements [Rekeyer]. It seals the file with key and a fresh salt.
+func (e *EncryptedFile) Rekey(_ context.Context, key Key) error {
+	return e.withLock(exclusiveLock, func() error {
+		if err := e.reload(); err != nil {
+			return err
+		}
+		previous := e.sealer
+		e.sealer = &sealer{key: key, params: previous.params}
+		if err := e.commit(); err != nil {
+			e.sealer = previous
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cheapArgon2Params keep tests fast; never use them for real stores.
+var cheapArgon2Params = argon2Params{Time: 1, Memory: 64, Threads: 1}
+
+func TestEncryptedFileRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tir.json")
+	e, err := useEncryptedFile(path, Passphrase("correct horse"), cheapArgon2Params)
+	require.NoError(t, err)
+	_, err = e.Upsert(t.Context(), syncText("aaaaaaaa", "Private notes", time.Time{}))
+	require.NoError(t, err)
+	require.NoError(t, e.Close())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "Private notes")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	e, err = useEncryptedFile(path, Passphrase("correct horse"), cheapArgon2Params)
+	require.NoError(t, err)
+	defer e.Close()
+	assert.Equal(t, map[string]string{"aaaaaaaa": "Private notes"}, titles(t, e))
+}
+
+func TestEncryptedFileRejectsWrongKeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tir.json")
+	e, err := useEncryptedFile(path, Passphrase("correct horse"), cheapArgon2Params)
+	require.NoError(t, err)
+	_, err = e.Upsert(t.Context(), syncText("aaaaaaaa", "A", time.Time{}))
+	require.NoError(t, err)
+	require.NoError(t, e.Close())
+
+	_, err = useEncryptedFile(path, Passphrase("battery staple"), cheapArgon2Params)
+	assert.ErrorIs(t, err, ErrWrongKey)
+	key, err := GenerateKeyFile(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	_, err = useEncryptedFile(path, key, cheapArgon2Params)
+	assert.ErrorIs(t, err, ErrWrongKey)
+
+	plaintext := filepath.Join(dir, "plaintext.json")
+	f, err := useFile(plaintext, nil)
+	require.NoError(t, err)
+	_, err = f.Upsert(t.Context(), syncText("aaaaaaaa", "A", time.Time{}))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = useEncryptedFile(plaintext, key, cheapArgon2Params)
+	assert.ErrorContains(t, err, "isn't encrypted")
+}
+
+func TestEncryptedFileRekeys(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tir.json")
+	e, err := useEncryptedFile(path, Passphrase("correct horse"), cheapArgon2Params)
+	require.NoError(t, err)
+	_, err = e.Upsert(t.Context(), syncText("aaaaaaaa", "A", time.Time{}))
+	require.NoError(t, err)
+
+	key, err := GenerateKeyFile(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	require.NoError(t, e.Rekey(t.Context(), key))
+	_, err = e.Upsert(t.Context(), syncText("bbbbbbbb", "B", time.Time{}))
+	require.NoError(t, err)
+	require.NoError(t, e.Close())
+
+	_, err = useEncryptedFile(path, Passphrase("correct horse"), cheapArgon2Params)
+	assert.ErrorIs(t, err, ErrWrongKey)
+	read, err := ReadKeyFile(filepath.Join(dir, "key"))
+	require.NoError(t, err)
+	e, err = useEncryptedFile(path, read, cheapArgon2Params)
+	require.NoError(t, err)
+	defer e.Close()
+	assert.Equal(t, map[string]string{"aaaaaaaa": "A", "bbbbbbbb": "B"}, titles(t, e))
+}
@@ -1,30 +1,59 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"sync"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/text"
 )
 
+// lockSuffix names the lock file guarding a file store: the store at path is
+// locked by path+lockSuffix. The store file itself can't hold the lock, since
+// commits replace it.
+const lockSuffix = ".lock"
+
 // UseFile at path as a JSON store. If the file doesn't exist, it's created and
 // initialized to an empty store.
 //
-// If you don't call [File.Close], the underlying [os.File] won't be closed.
+// Multiple processes can safely use the same file: see [File].
 func UseFile(path string) (Interface, error) {
-	return useFile(path)
+	return useFile(path, nil)
 }
 
-func useFile(path string) (*File, error) {
-	db, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
+// useFile at path, sealing its contents with sealer if it's set.
+func useFile(path string, sealer *sealer) (*File, error) {
+	// Commits replace the file; resolve symlinks so they replace the target,
+	// not the link.
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	perm := os.FileMode(0644)
+	if sealer != nil {
+		perm = 0600
+	}
+	if db, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, perm); err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
+	} else if err := db.Close(); err != nil {
+		return nil, fmt.Errorf("error closing file: %w", err)
 	}
-	f := &File{db: db}
-	if err := f.load(); err != nil {
+	lock, err := openLock(path + lockSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+
+	f := &File{path: path, fileLock: fileLock{lock: lock}, sealer: sealer}
+	if err := f.withLock(sharedLock, f.load); errors.Is(err, ErrWrongKey) {
+		lock.Close()
+		return nil, err
+	} else if err != nil {
+		lock.Close()
 		return nil, fmt.Errorf("can't parse file contents: %w", err)
 	}
 	return f, nil
@@ -32,89 +61,268 @@ func useFile(path string) (*File, error) {
 
 // File implements [Interface]; see [UseFile].
 //
-// Loads all texts from the underlying os.File into a memory store as an
-// intermediate form for each operation; most of the store logic is delegated to
-// the memory implementation.
+// Loads all texts from the underlying file into a memory store, to which most
+// of the store logic is delegated. Each operation reloads the file if another
+// process modified it, holding an advisory lock (see [os.File] and flock(2))
+// so concurrent read-modify-write cycles apply in turn instead of clobbering
+// one another. Commits write a temporary file and rename it over the original,
+// so a crash mid-write leaves the previous contents intact.
 type File struct {
-	// Mutex for file handle operations.
-	sync.Mutex
-	db *os.File
+	fileLock
+	path string
+	// loaded describes the file when it was last loaded or committed.
+	loaded fs.FileInfo
+	// sealer, if set, encrypts the file; see [EncryptedFile].
+	sealer *sealer
 
 	cache *Memory
 }
 
+// fileLock serializes operations on a store file: its mutex within this
+// process, and an advisory lock on a lock file across processes.
+type fileLock struct {
+	sync.Mutex
+	lock *os.File
+}
+
+// withLock runs operation holding l's mutex and its lock file.
+func (l *fileLock) withLock(exclusive bool, operation func() error) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := lockFile(l.lock, exclusive); err != nil {
+		return fmt.Errorf("couldn't lock %v: %w", l.lock.Name(), err)
+	}
+	defer unlockFile(l.lock)
+	return operation()
+}
+
+// Lock modes for withLock.
+const (
+	sharedLock    = false
+	exclusiveLock = true
+)
+
 // parse all records in f into memory.
 func (f *File) load() error {
-	f.Lock()
-	defer f.Unlock()
-
-	result := new(map[string]*text.Text)
-	if _, err := f.db.Seek(0, 0); err != nil {
-		return fmt.Errorf("couldn't seek to beginning of file before parsing: %v", err)
-	} else if bytes, err := io.ReadAll(f.db); err != nil {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat file: %w", err)
+	}
+	bytes, err := os.ReadFile(f.path)
+	if err != nil {
 		return fmt.Errorf("couldn't read file: %w", err)
-	} else if err := json.Unmarshal(bytes, result); err != nil {
-		if len(bytes) == 0 {
-			f.cache = useMemory()
-			return nil
-		}
-		return fmt.Errorf("couldn't parse file JSON: %w", err)
 	}
+	f.loaded = info
 
-	f.cache = &Memory{texts: *result}
+	result := make(map[string]*text.Text)
+	if len(bytes) == 0 {
+		f.cache = useMemory()
+		return nil
+	} else if f.sealer == nil {
+		// Not encrypted.
+	} else if bytes, err = f.sealer.open(bytes); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("couldn't parse file JSON: %w", err)
+	}
+	f.cache = newMemory(result)
 	return nil
 }
 
-// commit all records in memory to the underlying file. Overwrites everything.
-func (f *File) commit() error {
-	f.Lock()
-	defer f.Unlock()
+// reload f if another process modified it since it was last loaded or
+// committed.
+func (f *File) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat file: %w", err)
+	}
+	if f.loaded != nil && os.SameFile(info, f.loaded) && info.ModTime().Equal(f.loaded.ModTime()) && info.Size() == f.loaded.Size() {
+		return nil
+	}
+	return f.load()
+}
 
-	if newContents, err := json.MarshalIndent(f.cache.texts, "", "\t"); err != nil {
+// commit all records in memory to the underlying file. Overwrites everything,
+// atomically; see replaceFile.
+func (f *File) commit() error {
+	newContents, err := json.MarshalIndent(f.cache.texts, "", "\t")
+	if err != nil {
 		return fmt.Errorf("couldn't marshal texts to JSON: %w", err)
-	} else if err := f.db.Truncate(0); err != nil {
-		return fmt.Errorf("couldn't clear file before writing: %v", err)
-	} else if _, err := f.db.Seek(0, 0); err != nil {
-		return fmt.Errorf("couldn't seek to beginning of file after truncating: %v", err)
-	} else if _, err = f.db.Write(newContents); err != nil {
-		return fmt.Errorf("couldn't write to file: %w", err)
+	} else if f.sealer == nil {
+		// Not encrypted.
+	} else if newContents, err = f.sealer.seal(newContents); err != nil {
+		return fmt.Errorf("couldn't encrypt texts: %w", err)
+	}
+	if f.loaded, err = replaceFile(f.path, newContents); err != nil {
+		return err
 	}
 	return nil
 }
 
+// replaceFile at path with contents atomically: write a temporary file, sync
+// it, and rename it over path, so a crash leaves either the old or the new
+// contents. Preserves path's permissions. Returns the new file's info.
+func replaceFile(path string, contents []byte) (fs.FileInfo, error) {
+	dir := filepath.Dir(path)
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temporary file: %w", err)
+	}
+	// Clean up if anything fails before the rename; afterwards, this fails
+	// harmlessly.
+	defer os.Remove(temp.Name())
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if _, err := temp.Write(contents); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("couldn't write to temporary file: %w", err)
+	} else if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("couldn't set temporary file permissions: %w", err)
+	} else if err := temp.Sync(); err != nil {
+		temp.Close()
+		return nil, fmt.Errorf("couldn't sync temporary file: %w", err)
+	} else if err := temp.Close(); err != nil {
+		return nil, fmt.Errorf("couldn't close temporary file: %w", err)
+	} else if err := os.Rename(temp.Name(), path); err != nil {
+		return nil, fmt.Errorf("couldn't replace file: %w", err)
+	} else if err := syncDir(dir); err != nil {
+		return nil, fmt.Errorf("couldn't sync directory: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't stat file: %w", err)
+	}
+	return info, nil
+}
+
+// syncDir flushes dir's entries (e.g. a rename) to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return ignoreUnsupportedSync(d.Sync())
+}
+
+// read from the cache after reloading any external modifications.
+func (f *File) read(operation func() error) error {
+	return f.withLock(sharedLock, func() error {
+		if err := f.reload(); err != nil {
+			return fmt.Errorf("can't parse file contents: %w", err)
+		}
+		return operation()
+	})
+}
+
+// mutate the cache after reloading any external modifications, then commit
+// it. If committing fails, the next operation reloads the file, discarding the
+// mutation.
+func (f *File) mutate(operation func() error) error {
+	return f.withLock(exclusiveLock, func() error {
+		if err := f.reload(); err != nil {
+			return fmt.Errorf("can't parse file contents: %w", err)
+		} else if err := operation(); err != nil {
+			return err
+		} else if err := f.commit(); err != nil {
+			f.loaded = nil
+			return err
+		}
+		return nil
+	})
+}
+
+// replace implements replacer in a single commit.
+func (f *File) replace(ctx context.Context, texts []*text.Text) error {
+	return f.mutate(func() error {
+		f.cache = useMemory(texts...)
+		return nil
+	})
+}
+
 // Read implements [Interface].
-func (f *File) Read(id string) (*text.Text, error) {
-	return f.cache.Read(id)
+func (f *File) Read(ctx context.Context, id string) (t *text.Text, err error) {
+	err = f.read(func() error {
+		t, err = f.cache.Read(ctx, id)
+		return err
+	})
+	return t, err
 }
 
 // Upsert implements [Interface].
-func (f *File) Upsert(t *text.Text) (*text.Text, error) {
-	t, err := f.cache.Upsert(t)
+func (f *File) Upsert(ctx context.Context, t *text.Text) (result *text.Text, err error) {
+	err = f.mutate(func() error {
+		result, err = f.cache.Upsert(ctx, t)
+		return err
+	})
 	if err != nil {
 		return nil, err
-	} else if err := f.commit(); err != nil {
+	}
+	return result, nil
+}
+
+// UpsertMany implements [Interface] in a single commit.
+func (f *File) UpsertMany(ctx context.Context, texts []*text.Text) (results []*text.Text, err error) {
+	err = f.mutate(func() error {
+		results, err = f.cache.UpsertMany(ctx, texts)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	return results, nil
 }
 
 // Delete implements [Interface].
-func (f *File) Delete(id string) (*text.Text, error) {
-	t, err := f.cache.Delete(id)
+func (f *File) Delete(ctx context.Context, id string) (t *text.Text, err error) {
+	err = f.mutate(func() error {
+		t, err = f.cache.Delete(ctx, id)
+		return err
+	})
 	if err != nil {
 		return nil, err
-	} else if err := f.commit(); err != nil {
-		return nil, err
 	}
 	return t, nil
 }
 
+// DeleteMany implements [Interface] in a single commit.
+func (f *File) DeleteMany(ctx context.Context, ids []string) (texts []*text.Text, err error) {
+	err = f.mutate(func() error {
+		texts, err = f.cache.DeleteMany(ctx, ids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
 // List implements [Interface].
-func (f *File) List(c text.Comparator, d text.Direction) ([]*text.Text, error) {
-	return f.cache.List(c, d)
+func (f *File) List(ctx context.Context, q Query) (texts []*text.Text, err error) {
+	err = f.read(func() error {
+		texts, err = f.cache.List(ctx, q)
+		return err
+	})
+	return texts, err
+}
+
+// Search implements [Interface].
+func (f *File) Search(ctx context.Context, query string, limit int) (results []search.Result, err error) {
+	err = f.read(func() error {
+		results, err = f.cache.Search(ctx, query, limit)
+		return err
+	})
+	return results, err
 }
 
 // Close implements [Interface].
 func (f *File) Close() error {
-	return f.db.Close()
+	return f.lock.Close()
 }
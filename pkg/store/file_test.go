@@ -1,11 +1,16 @@
 package store
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/lukasschwab/tiir/pkg/text"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUseFile(t *testing.T) {
@@ -16,7 +21,7 @@ func TestUseFile(t *testing.T) {
 	assert.NoError(t, db.Close())
 
 	// Initial store: from empty DB.
-	f, err := useFile(db.Name())
+	f, err := useFile(db.Name(), nil)
 	assert.NoError(t, err)
 
 	err = f.load()
@@ -34,7 +39,7 @@ func TestUseFile(t *testing.T) {
 	assert.NoError(t, f.Close())
 
 	// Second store.
-	f2, err := useFile(db.Name())
+	f2, err := useFile(db.Name(), nil)
 	assert.NoError(t, err, "can reopen previously-opened file")
 	defer f2.Close()
 
@@ -42,3 +47,63 @@ func TestUseFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, f2.cache.texts, "abc123de", "records should persist when file is closed")
 }
+
+func TestFileMergesConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.ArtifactDir(), "tir.json")
+
+	// Separate File instances behave like separate processes: each holds its
+	// own lock file descriptor and cache.
+	const writers, textsPerWriter = 4, 10
+	var wg sync.WaitGroup
+	for i := range writers {
+		f, err := useFile(path, nil)
+		require.NoError(t, err)
+		defer f.Close()
+		wg.Go(func() {
+			for j := range textsPerWriter {
+				_, err := f.Upsert(t.Context(), &text.Text{ID: fmt.Sprintf("%04d%04d", i, j)})
+				assert.NoError(t, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	f, err := useFile(path, nil)
+	require.NoError(t, err)
+	defer f.Close()
+	texts, err := f.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Len(t, texts, writers*textsPerWriter, "no writer clobbers another")
+}
+
+func TestFileReloadsExternalModifications(t *testing.T) {
+	path := filepath.Join(t.ArtifactDir(), "tir.json")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	f, err := useFile(path, nil)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`{"bbbbbbbb": {"id": "bbbbbbbb"}}`), 0600))
+
+	_, err = f.Read(t.Context(), "aaaaaaaa")
+	assert.ErrorIs(t, err, ErrNotFound, "reads reflect the file's current contents")
+	_, err = f.Upsert(t.Context(), &text.Text{ID: "cccccccc"})
+	require.NoError(t, err)
+	texts, err := f.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bbbbbbbb", "cccccccc"}, ids(texts))
+
+	// Commits replace the file atomically, preserving its permissions.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"tir.json", "tir.json" + lockSuffix}, names, "no temporary files remain")
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// gitIdentity is the author and committer of commits in repositories without
+// a configured user.
+var gitIdentity = []string{
+	"GIT_AUTHOR_NAME=tir", "GIT_AUTHOR_EMAIL=tir@localhost",
+	"GIT_COMMITTER_NAME=tir", "GIT_COMMITTER_EMAIL=tir@localhost",
+}
+
+// UseGit at dir as a git repository of Markdown files; see [Git]. If dir isn't
+// in a git repository, it's initialized as one, or cloned from remote if
+// remote is set.
+//
+// If remote is set, Git pulls from it on opening and before each change, and
+// pushes each change to it. Remote is a URL or path git understands, e.g.
+// "git@github.com:me/reading.git"; it needn't be a configured remote.
+func UseGit(dir, remote string) (Interface, error) {
+	return useGit(context.Background(), dir, remote)
+}
+
+func useGit(ctx context.Context, dir, remote string) (*Git, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git store requires git: %w", err)
+	}
+	g := &Git{dir: dir, remote: remote}
+
+	if _, err := g.git(ctx, "rev-parse", "--is-inside-work-tree"); err != nil {
+		if err := g.create(ctx); err != nil {
+			return nil, fmt.Errorf("error creating repository: %w", err)
+		}
+	}
+	if _, err := g.git(ctx, "var", "GIT_COMMITTER_IDENT"); err != nil {
+		log.Printf("[WARN] no git identity configured in %v; committing as tir", dir)
+		g.env = gitIdentity
+	}
+	if err := g.pull(ctx); err != nil {
+		return nil, err
+	}
+
+	markdown, err := useMarkdown(dir)
+	if err != nil {
+		return nil, err
+	}
+	g.markdown = markdown
+	return g, nil
+}
+
+// Git implements [Interface] and [Historian] with a git repository: texts are
+// stored in a [Markdown] directory, and each Upsert or Delete commits the
+// changed file with a message like "create 35bb8126: Go Proverbs".
+//
+// dir may be a subdirectory of a larger repository, e.g. of a dotfiles
+// repository. Git commits only the files it changes, leaving other changes in
+// the repository uncommitted.
+type Git struct {
+	// Mutex serializes changes, so each commit records exactly one.
+	sync.Mutex
+	dir    string
+	remote string
+	// env overrides the process environment for git commands.
+	env []string
+
+	markdown *Markdown
+}
+
+// git runs a git command in g's directory, returning its standard output.
+func (g *Git) git(ctx context.Context, args ...string) (string, error) {
+	command := exec.CommandContext(ctx, "git", append([]string{"-C", g.dir}, args...)...)
+	// Fail rather than prompt for credentials.
+	command.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), g.env...)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	output, err := command.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return string(output), nil
+}
+
+// create a repository in g's directory: a clone of its remote, if it has one.
+func (g *Git) create(ctx context.Context) error {
+	if err := os.MkdirAll(g.dir, 0755); err != nil {
+		return err
+	} else if g.remote == "" {
+		_, err = g.git(ctx, "init", "--quiet")
+		return err
+	}
+	// Clone into the (empty) directory, rather than beside it.
+	_, err := g.git(ctx, "clone", "--quiet", g.remote, ".")
+	return err
+}
+
+// pull g's current branch from its remote, rebasing local commits onto it.
+// Does nothing if g has no remote, or the remote doesn't have the branch yet.
+func (g *Git) pull(ctx context.Context) error {
+	if g.remote == "" {
+		return nil
+	}
+	branch, err := g.git(ctx, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return fmt.Errorf("error finding current branch: %w", err)
+	}
+	branch = strings.TrimSpace(branch)
+	if heads, err := g.git(ctx, "ls-remote", "--heads", g.remote, branch); err != nil {
+		return fmt.Errorf("error listing remote branches: %w", err)
+	} else if heads == "" {
+		return nil
+	}
+	if _, err := g.git(ctx, "pull", "--quiet", "--rebase", "--autostash", g.remote, branch); err != nil {
+		return fmt.Errorf("error pulling from %v: %w", g.remote, err)
+	}
+	return nil
+}
+
+// push g's current branch to its remote, if it has one.
+func (g *Git) push(ctx context.Context) error {
+	if g.remote == "" {
+		return nil
+	}
+	if _, err := g.git(ctx, "push", "--quiet", g.remote, "HEAD"); err != nil {
+		return fmt.Errorf("error pushing to %v: %w", g.remote, err)
+	}
+	return nil
+}
+
+// change the files for the texts with ids with operation, which returns a
+// commit message, then commit them. Pulls first and pushes after, if g has a
+// remote.
+//
+// Pushing is best-effort: if it fails, the commit is pushed with the next
+// change.
+func (g *Git) change(ctx context.Context, ids []string, operation func() (string, error)) error {
+	g.Lock()
+	defer g.Unlock()
+
+	if err := g.pull(ctx); err != nil {
+		return err
+	}
+	message, err := operation()
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, len(ids))
+	for i, id := range ids {
+		files[i] = id + markdownExtension
+	}
+	if _, err := g.git(ctx, append([]string{"add", "--all", "--"}, files...)...); err != nil {
+		return fmt.Errorf("error staging %v: %w", strings.Join(files, ", "), err)
+	} else if _, err := g.git(ctx, append([]string{"diff", "--cached", "--quiet", "--"}, files...)...); err == nil {
+		// Nothing changed, e.g. an upsert of an identical text.
+		return nil
+	} else if _, err := g.git(ctx, append([]string{"commit", "--quiet", "--message", message, "--"}, files...)...); err != nil {
+		return fmt.Errorf("error committing %v: %w", strings.Join(files, ", "), err)
+	}
+	if err := g.push(ctx); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	return nil
+}
+
+// batchMessage summarizes changes to several texts as a commit message: a
+// summary line, e.g. "upsert 3 texts", followed by a line per change.
+func batchMessage(summary string, changes []string) string {
+	if len(changes) == 1 {
+		return changes[0]
+	}
+	return summary + "\n\n" + strings.Join(changes, "\n")
+}
+
+// History implements [Historian] from the log of commits changing the text's
+// file, including commits from before it was deleted.
+func (g *Git) History(ctx context.Context, id string) ([]Revision, error) {
+	if err := validateID(id); err != nil {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	}
+	if _, err := g.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		// There are no commits yet.
+		return nil, fmt.Errorf("%w: no history for ID '%v'", ErrNotFound, id)
+	}
+	output, err := g.git(ctx, "log", "--format=%H%x1f%an%x1f%aI%x1f%s", "--", id+markdownExtension)
+	if err != nil {
+		return nil, fmt.Errorf("error reading log: %w", err)
+	}
+
+	revisions := []Revision{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected log line %q", line)
+		}
+		timestamp, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("error parsing commit time: %w", err)
+		}
+		revisions = append(revisions, Revision{ID: fields[0], Author: fields[1], Timestamp: timestamp, Message: fields[3]})
+	}
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("%w: no history for ID '%v'", ErrNotFound, id)
+	}
+	return revisions, nil
+}
+
+// Read implements [Interface].
+func (g *Git) Read(ctx context.Context, id string) (*text.Text, error) {
+	return g.markdown.Read(ctx, id)
+}
+
+// Upsert implements [Interface].
+func (g *Git) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	if _, err := g.UpsertMany(ctx, []*text.Text{t}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UpsertMany implements [Interface] in a single commit.
+func (g *Git) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	ids := make([]string, len(texts))
+	for i, t := range texts {
+		ids[i] = t.ID
+	}
+	err := g.change(ctx, ids, func() (string, error) {
+		changes := make([]string, len(texts))
+		for i, t := range texts {
+			verb := "update"
+			if _, err := g.markdown.Read(ctx, t.ID); errors.Is(err, ErrNotFound) {
+				verb = "create"
+			} else if err != nil {
+				return "", err
+			}
+			changes[i] = fmt.Sprintf("%v %v: %v", verb, t.ID, t.Title)
+		}
+		if _, err := g.markdown.UpsertMany(ctx, texts); err != nil {
+			return "", err
+		}
+		return batchMessage(fmt.Sprintf("upsert %d texts", len(texts)), changes), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// Delete implements [Interface].
+func (g *Git) Delete(ctx context.Context, id string) (*text.Text, error) {
+	texts, err := g.DeleteMany(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	return texts[0], nil
+}
+
+// DeleteMany implements [Interface] in a single commit.
+func (g *Git) DeleteMany(ctx context.Context, ids []string) (texts []*text.Text, err error) {
+	err = g.change(ctx, ids, func() (string, error) {
+		if texts, err = g.markdown.DeleteMany(ctx, ids); err != nil {
+			return "", err
+		}
+		changes := make([]string, len(texts))
+		for i, t := range texts {
+			changes[i] = fmt.Sprintf("delete %v: %v", t.ID, t.Title)
+		}
+		return batchMessage(fmt.Sprintf("delete %d texts", len(texts)), changes), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// List implements [Interface].
+func (g *Git) List(ctx context.Context, q Query) ([]*text.Text, error) {
+	return g.markdown.List(ctx, q)
+}
+
+// Search implements [Interface].
+func (g *Git) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	return g.markdown.Search(ctx, query, limit)
+}
+
+// Close implements [Interface].
+func (g *Git) Close() error {
+	return g.markdown.Close()
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startGit in dir, skipping the test if git isn't installed.
+func startGit(t *testing.T, dir, remote string) *Git {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	g, err := useGit(t.Context(), dir, remote)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, g.Close()) })
+	return g
+}
+
+func messages(revisions []Revision) []string {
+	messages := make([]string, len(revisions))
+	for i, revision := range revisions {
+		messages[i] = revision.Message
+	}
+	return messages
+}
+
+func TestGitCommitsEachChange(t *testing.T) {
+	g := startGit(t, t.TempDir(), "")
+	fixture := queryFixtures()[0]
+
+	_, err := g.Upsert(t.Context(), fixture)
+	require.NoError(t, err)
+	// Upserting an identical text doesn't commit.
+	_, err = g.Upsert(t.Context(), fixture)
+	require.NoError(t, err)
+	fixture.Title = "Visualizing IP addresses"
+	_, err = g.Upsert(t.Context(), fixture)
+	require.NoError(t, err)
+	_, err = g.Upsert(t.Context(), queryFixtures()[1])
+	require.NoError(t, err)
+	_, err = g.Delete(t.Context(), fixture.ID)
+	require.NoError(t, err)
+
+	revisions, err := g.History(t.Context(), fixture.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete aaaaaaaa: Visualizing IP addresses",
+		"update aaaaaaaa: Visualizing IP addresses",
+		"create aaaaaaaa: Visualizing IP data",
+	}, messages(revisions))
+	assert.Len(t, revisions[0].ID, 40)
+	assert.False(t, revisions[0].Timestamp.IsZero())
+
+	_, err = g.Read(t.Context(), fixture.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = g.History(t.Context(), "zzzzzzzz")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGitPushesAndPulls(t *testing.T) {
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if err := exec.Command("git", "init", "--quiet", "--bare", remote).Run(); err != nil {
+		t.Skipf("can't create bare repository: %v", err)
+	}
+	fixtures := queryFixtures()
+
+	a := startGit(t, filepath.Join(t.TempDir(), "a"), remote)
+	_, err := a.Upsert(t.Context(), fixtures[0])
+	require.NoError(t, err)
+
+	// b clones a's change.
+	b := startGit(t, filepath.Join(t.TempDir(), "b"), remote)
+	read, err := b.Read(t.Context(), fixtures[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, fixtures[0].Title, read.Title)
+	fixtures[0].Note = "Updated elsewhere"
+	_, err = b.Upsert(t.Context(), fixtures[0])
+	require.NoError(t, err)
+
+	// a pulls b's change before its next one.
+	_, err = a.Upsert(t.Context(), fixtures[1])
+	require.NoError(t, err)
+	read, err = a.Read(t.Context(), fixtures[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated elsewhere", read.Note)
+
+	revisions, err := a.History(t.Context(), fixtures[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update aaaaaaaa: Visualizing IP data", "create aaaaaaaa: Visualizing IP data"}, messages(revisions))
+}
@@ -2,30 +2,38 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/text"
 )
 
-var (
-	errNotFound = errors.New("not found")
-)
-
 // UseHTTP requests to a remote [github.com/lukasschwab/tiir/cmd/server]
 // instance (hosted at baseURL, accepting secret apiSecret) to read and write
 // texts.
 func UseHTTP(baseURL, apiSecret string) (Interface, error) {
+	return UseHTTPWithSecret(baseURL, func() (string, error) { return apiSecret, nil })
+}
+
+// UseHTTPWithSecret is [UseHTTP] with an API secret read by apiSecret when
+// it's first needed, e.g. from a command or keyring.
+func UseHTTPWithSecret(baseURL string, apiSecret func() (string, error)) (Interface, error) {
 	url, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
-	return &HTTP{baseURL: url, apiSecret: apiSecret}, nil
+	return &HTTP{baseURL: url, apiSecret: sync.OnceValues(apiSecret), pageSize: defaultHTTPPageSize}, nil
 }
 
 // HTTP implements [Interface] for a remote cmd/server process. See [UseHTTP].
@@ -36,51 +44,94 @@ func UseHTTP(baseURL, apiSecret string) (Interface, error) {
 // [github.com/lukasschwab/tiir/cmd/server]; these are hidden dependencies!
 type HTTP struct {
 	baseURL   *url.URL
-	apiSecret string
+	apiSecret func() (string, error)
+	pageSize  int
 }
 
-// newRequest wraps http.NewRequest for requests rooted at h.baseURL.
-func (h *HTTP) newRequest(method string, body io.Reader, path ...string) (*http.Request, error) {
+// newRequest wraps http.NewRequestWithContext for requests rooted at
+// h.baseURL.
+func (h *HTTP) newRequest(ctx context.Context, method string, body io.Reader, path ...string) (*http.Request, error) {
 	requestURL := h.baseURL.JoinPath(path...).String()
-	req, err := http.NewRequest(method, requestURL, body)
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
 	if err != nil {
 		return req, err
 	}
 	req.Header.Add("Content-Type", "application/json")
-	if h.apiSecret != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", h.apiSecret))
+	apiSecret, err := h.apiSecret()
+	if err != nil {
+		return nil, fmt.Errorf("error reading API secret: %w", err)
+	} else if apiSecret != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiSecret))
 	}
 	return req, nil
 }
 
+// do sends req. Failures to reach the server wrap [ErrUnavailable], unless
+// req's context was canceled.
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil && req.Context().Err() == nil {
+		return nil, fmt.Errorf("%w: error making request: %w", ErrUnavailable, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	return resp, nil
+}
+
+// checkStatus converts error responses to errors. Responses with [Problem]
+// bodies become the errors they describe; see [Problem.Err]. Gateway errors,
+// e.g. from a proxy in front of an unreachable server, wrap [ErrUnavailable].
 func checkStatus(resp *http.Response) error {
-	if resp.StatusCode/100 != 2 {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error reading response body: %v", err)
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w: server responded %d", ErrUnavailable, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading response body: %v", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == ProblemContentType {
+		problem := &Problem{Status: resp.StatusCode}
+		if err := json.Unmarshal(body, problem); err == nil {
+			problem.Status = resp.StatusCode
+			return problem.Err()
 		}
-		return fmt.Errorf("server responded %d: %s", resp.StatusCode, body)
 	}
-	return nil
+	return fmt.Errorf("server responded %d: %s", resp.StatusCode, body)
+}
+
+// Health checks the server is up: that it responds to its health route.
+func (h *HTTP) Health(ctx context.Context) error {
+	req, err := h.newRequest(ctx, http.MethodGet, nil, "health")
+	if err != nil {
+		return fmt.Errorf("error building request: %w", err)
+	}
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp)
 }
 
 // Read implements [Interface].
-func (h *HTTP) Read(id string) (*text.Text, error) {
-	req, err := h.newRequest(http.MethodGet, nil, "texts", id)
+func (h *HTTP) Read(ctx context.Context, id string) (*text.Text, error) {
+	req, err := h.newRequest(ctx, http.MethodGet, nil, "texts", id)
 	if err != nil {
 		return nil, fmt.Errorf("error building request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	result := new(text.Text)
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, errNotFound
-	} else if err := checkStatus(resp); err != nil {
+	if err := checkStatus(resp); err != nil {
 		return nil, err
 	} else if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
 		return nil, fmt.Errorf("error decoding response: %w", err)
@@ -90,10 +141,19 @@ func (h *HTTP) Read(id string) (*text.Text, error) {
 	return result, nil
 }
 
-// Upsert implements [Interface]. It reads before writing to decide whether to call
-// the server's POST route or its PATCH route, since cmd/server doesn't expose
-// an upsert route.
-func (h *HTTP) Upsert(t *text.Text) (*text.Text, error) {
+// Upsert implements [Interface] with a batch request for t; see [Batch].
+func (h *HTTP) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	texts, err := h.UpsertMany(ctx, []*text.Text{t})
+	if err != nil {
+		return nil, err
+	}
+	return texts[0], nil
+}
+
+// upsertOne upserts t on a server without the batch route. It reads before
+// writing to decide whether to call the server's POST route, which creates t
+// with a new ID, or its PATCH route.
+func (h *HTTP) upsertOne(ctx context.Context, t *text.Text) (*text.Text, error) {
 	marshaled, err := json.Marshal(t)
 	if err != nil {
 		return nil, fmt.Errorf("error encoding text: %w", err)
@@ -102,7 +162,7 @@ func (h *HTTP) Upsert(t *text.Text) (*text.Text, error) {
 
 	var method string
 	var path []string
-	if _, err := h.Read(t.ID); errors.Is(err, errNotFound) {
+	if _, err := h.Read(ctx, t.ID); errors.Is(err, ErrNotFound) {
 		// The record doesn't exist; create it.
 		method, path = http.MethodPost, []string{"texts"}
 	} else if err != nil {
@@ -112,14 +172,14 @@ func (h *HTTP) Upsert(t *text.Text) (*text.Text, error) {
 		method, path = http.MethodPatch, []string{"texts", t.ID}
 	}
 
-	req, err := h.newRequest(method, body, path...)
+	req, err := h.newRequest(ctx, method, body, path...)
 	if err != nil {
 		return nil, fmt.Errorf("error building request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -135,15 +195,15 @@ func (h *HTTP) Upsert(t *text.Text) (*text.Text, error) {
 }
 
 // Delete implements [Interface].
-func (h *HTTP) Delete(id string) (*text.Text, error) {
-	req, err := h.newRequest(http.MethodDelete, nil, "texts", id)
+func (h *HTTP) Delete(ctx context.Context, id string) (*text.Text, error) {
+	req, err := h.newRequest(ctx, http.MethodDelete, nil, "texts", id)
 	if err != nil {
 		return nil, fmt.Errorf("error building request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -158,33 +218,212 @@ func (h *HTTP) Delete(id string) (*text.Text, error) {
 	return result, nil
 }
 
-// List implements [Interface]. It re-sorts the response accoding to c and d.
-func (h *HTTP) List(c text.Comparator, d text.Direction) ([]*text.Text, error) {
-	req, err := h.newRequest(http.MethodGet, nil, "texts")
+// Batch is the body of a request to cmd/server's POST /texts:batch route, which
+// upserts or deletes several texts at once: all of them, or none if any
+// fails. Set Upsert or Delete, not both.
+type Batch struct {
+	// Upsert these texts, keeping their IDs.
+	Upsert []*text.Text `json:"upsert,omitempty"`
+	// Delete the texts with these IDs.
+	Delete []string `json:"delete,omitempty"`
+}
+
+// BatchResult is the body of a successful response to a [Batch] request.
+type BatchResult struct {
+	// Texts upserted or deleted, in the request's order.
+	Texts []*text.Text `json:"texts"`
+}
+
+// errNoBatches means the server predates the batch route; see [Batch].
+var errNoBatches = errors.New("server doesn't accept batches")
+
+// UpsertMany implements [Interface] with a single batch request; see [Batch].
+//
+// If the server predates the batch route, UpsertMany upserts each text in
+// turn, and the server creates new texts with new IDs.
+func (h *HTTP) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	results, err := h.batch(ctx, &Batch{Upsert: texts}, len(texts))
+	if !errors.Is(err, errNoBatches) {
+		return results, err
+	}
+	results = make([]*text.Text, len(texts))
+	for i, t := range texts {
+		if results[i], err = h.upsertOne(ctx, t); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// DeleteMany implements [Interface] with a single batch request; see [Batch].
+// If the server predates the batch route, DeleteMany deletes each text in turn.
+func (h *HTTP) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	results, err := h.batch(ctx, &Batch{Delete: ids}, len(ids))
+	if !errors.Is(err, errNoBatches) {
+		return results, err
+	}
+	results = make([]*text.Text, len(ids))
+	for i, id := range ids {
+		if results[i], err = h.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// batch sends b to the server and returns the texts it upserted or deleted,
+// checking there are expected many.
+func (h *HTTP) batch(ctx context.Context, b *Batch, expected int) ([]*text.Text, error) {
+	if expected == 0 {
+		return []*text.Text{}, nil
+	}
+	marshaled, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding batch: %w", err)
+	}
+	req, err := h.newRequest(ctx, http.MethodPost, bytes.NewReader(marshaled), "texts:batch")
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(BatchResult)
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); resp.StatusCode == http.StatusNotFound && mediaType != ProblemContentType {
+		// Not a missing text: a missing route.
+		return nil, errNoBatches
+	} else if err := checkStatus(resp); err != nil {
+		return nil, err
+	} else if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	} else if len(result.Texts) != expected {
+		return nil, fmt.Errorf("server returned %d texts, expected %d", len(result.Texts), expected)
+	}
+	for _, t := range result.Texts {
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("result is invalid text: %w", err)
+		}
+	}
+	return result.Texts, nil
+}
+
+// defaultHTTPPageSize is the page size HTTP.List requests from the server.
+const defaultHTTPPageSize = 500
+
+// List implements [Interface]. The server evaluates q; List follows the
+// server's pagination links until it has q.Limit texts, or every text if
+// q.Limit is zero.
+func (h *HTTP) List(ctx context.Context, q Query) ([]*text.Text, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	values := q.Values()
+	values.Set("format", "application/json")
+	values.Set(paramLimit, strconv.Itoa(h.pageSize))
+	if q.Limit > 0 {
+		values.Set(paramLimit, strconv.Itoa(min(q.Limit, h.pageSize)))
+	}
+	first, err := h.newRequest(ctx, http.MethodGet, nil, "texts")
 	if err != nil {
 		return nil, fmt.Errorf("error building request: %w", err)
 	}
+	next := first.URL
+	next.RawQuery = values.Encode()
+
+	result := []*text.Text{}
+	for next != nil && (q.Limit == 0 || len(result) < q.Limit) {
+		var page []*text.Text
+		if page, next, err = h.listPage(ctx, next); err != nil {
+			return nil, err
+		}
+		result = append(result, page...)
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+// listPage of texts at pageURL, returning the URL of the next page if there is
+// one.
+func (h *HTTP) listPage(ctx context.Context, pageURL *url.URL) (texts []*text.Text, next *url.URL, err error) {
+	req, err := h.newRequest(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building request: %w", err)
+	}
+	req.URL, req.Host = pageURL, pageURL.Host
 	// Don't want the default HTML representation.
 	req.Header.Add("Accept-Encoding", "application/json")
-	q := req.URL.Query()
-	q.Add("format", "application/json")
-	req.URL.RawQuery = q.Encode()
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	var result []*text.Text
 	if err := checkStatus(resp); err != nil {
+		return nil, nil, err
+	} else if err := json.NewDecoder(resp.Body).Decode(&texts); err != nil {
+		return nil, nil, fmt.Errorf("error decoding response: %w", err)
+	} else if next, err = nextLink(resp); err != nil {
+		return nil, nil, err
+	}
+	return texts, next, nil
+}
+
+// nextLink parses the rel="next" target from resp's Link headers, resolved
+// against the request URL. Returns nil if there's no next link.
+func nextLink(resp *http.Response) (*url.URL, error) {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			target, params, _ := strings.Cut(strings.TrimSpace(link), ";")
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				if strings.ReplaceAll(strings.TrimSpace(param), " ", "") != `rel="next"` {
+					continue
+				}
+				next, err := resp.Request.URL.Parse(strings.Trim(target, "<>"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid next link: %w", err)
+				}
+				return next, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Search implements [Interface]. The server ranks results.
+func (h *HTTP) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	req, err := h.newRequest(ctx, http.MethodGet, nil, "texts", "search")
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+	values := url.Values{"q": {query}, "format": {"application/json"}}
+	if limit > 0 {
+		values.Set(paramLimit, strconv.Itoa(limit))
+	}
+	req.URL.RawQuery = values.Encode()
+
+	resp, err := do(req)
+	if err != nil {
 		return nil, err
-	} else if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
+	defer resp.Body.Close()
 
-	text.Sort(result).By(c, d)
-	return result, nil
+	var results []search.Result
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	} else if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return results, nil
 }
 
 // Close implements [Interface].
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// paginatingServer mimics cmd/server's GET /texts route for m.
+func paginatingServer(t testing.TB, m Interface) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, err := ParseQuery(r.URL.Query(), Query{})
+		require.NoError(t, err)
+		page, err := Paginate(r.Context(), m.List, q, r.URL.Query().Get("cursor"))
+		require.NoError(t, err)
+		if page.Next != "" {
+			next := r.URL.Query()
+			next.Set("cursor", page.Next)
+			next.Del("offset")
+			w.Header().Add("Link", fmt.Sprintf(`</texts?%s>; rel="next"`, next.Encode()))
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(page.Texts))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPListWalksPages(t *testing.T) {
+	server := paginatingServer(t, UseMemory(queryFixtures()...))
+	s, err := UseHTTP(server.URL, "")
+	require.NoError(t, err)
+	s.(*HTTP).pageSize = 1
+
+	texts, err := s.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb", "cccccccc"}, ids(texts))
+
+	texts, err = s.List(t.Context(), Query{Direction: text.Descending, Limit: 2, Offset: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bbbbbbbb", "aaaaaaaa"}, ids(texts))
+}
+
+func TestHTTPCancellation(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		// Block until the client disconnects.
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	s, err := UseHTTP(server.URL, "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		<-received
+		cancel()
+	}()
+	_, err = s.Read(ctx, "aaaaaaaa")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestHTTPFallsBackWithoutBatches(t *testing.T) {
+	// Mimic the routes of a server that predates POST /texts:batch.
+	m := useMemory()
+	mux := http.NewServeMux()
+	respond := func(w http.ResponseWriter, t *text.Text, err error) {
+		if err != nil {
+			problem := NewProblem(err, http.StatusInternalServerError)
+			w.Header().Set("Content-Type", ProblemContentType)
+			w.WriteHeader(problem.Status)
+			json.NewEncoder(w).Encode(problem)
+			return
+		}
+		json.NewEncoder(w).Encode(t)
+	}
+	mux.HandleFunc("POST /texts", func(w http.ResponseWriter, r *http.Request) {
+		created := new(text.Text)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(created))
+		created.ID = "assigned"
+		_, err := m.Upsert(r.Context(), created)
+		respond(w, created, err)
+	})
+	mux.HandleFunc("GET /texts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		read, err := m.Read(r.Context(), r.PathValue("id"))
+		respond(w, read, err)
+	})
+	mux.HandleFunc("DELETE /texts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted, err := m.Delete(r.Context(), r.PathValue("id"))
+		respond(w, deleted, err)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	s, err := UseHTTP(server.URL, "")
+	require.NoError(t, err)
+
+	created, err := s.Upsert(t.Context(), syncText("aaaaaaaa", "A", time.Time{}))
+	require.NoError(t, err)
+	assert.Equal(t, "assigned", created.ID)
+	deleted, err := s.DeleteMany(t.Context(), []string{"assigned"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assigned"}, ids(deleted))
+}
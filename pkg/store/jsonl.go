@@ -0,0 +1,380 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// defaultCompactionMinimum is the number of obsolete records a JSONL log
+// accumulates before it compacts itself automatically.
+const defaultCompactionMinimum = 1000
+
+// UseJSONL at path as an append-only log store. If the file doesn't exist,
+// it's created and initialized to an empty log.
+//
+// Multiple processes can safely use the same log: see [JSONL].
+func UseJSONL(path string) (Interface, error) {
+	return useJSONL(path, defaultCompactionMinimum)
+}
+
+func useJSONL(path string, compactionMinimum int) (*JSONL, error) {
+	// Compaction replaces the file; resolve symlinks so it replaces the
+	// target, not the link.
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if db, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	} else if err := db.Close(); err != nil {
+		return nil, fmt.Errorf("error closing file: %w", err)
+	}
+	lock, err := openLock(path + lockSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+
+	j := &JSONL{path: path, fileLock: fileLock{lock: lock}, compactionMinimum: compactionMinimum}
+	if err := j.withLock(sharedLock, j.replay); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// JSONL implements [Interface] with a JSON Lines log: each line of the file
+// records one upsert or delete, so writes append a line rather than rewriting
+// the collection. See [UseJSONL].
+//
+// The log is replayed into a memory store, to which reads are delegated.
+// Like [File], JSONL holds an advisory lock during each operation and first
+// replays any records other processes appended. Once obsolete records (e.g.
+// superseded upserts) outnumber live texts, and number at least a minimum,
+// JSONL compacts the log; see [JSONL.Compact].
+type JSONL struct {
+	fileLock
+	path string
+	// loaded describes the file when it was last read or written.
+	loaded fs.FileInfo
+	// offset is the length of the log replayed so far, and records the number
+	// of records it contains.
+	offset  int64
+	records int
+	// updated maps each live text's ID to the time of its latest record.
+	updated map[string]time.Time
+
+	compactionMinimum int
+	cache             *Memory
+}
+
+// logOperation is the kind of change a logRecord records.
+type logOperation string
+
+const (
+	opUpsert logOperation = "upsert"
+	opDelete logOperation = "delete"
+)
+
+// logRecord is one line of a JSONL log: either an upsert of Text or a delete
+// of the text with ID.
+type logRecord struct {
+	Op   logOperation `json:"op"`
+	At   time.Time    `json:"at"`
+	ID   string       `json:"id,omitempty"`
+	Text *text.Text   `json:"text,omitempty"`
+}
+
+// replay records appended to the log since it was last read. If another
+// process replaced or truncated the log (e.g. by compacting it), replay it
+// from the beginning.
+//
+// An incomplete final line, left by a crash mid-append, isn't replayed; the
+// next append overwrites it.
+func (j *JSONL) replay() error {
+	info, err := os.Stat(j.path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat log: %w", err)
+	}
+	if j.loaded == nil || !os.SameFile(info, j.loaded) || info.Size() < j.offset {
+		j.cache, j.updated = useMemory(), map[string]time.Time{}
+		j.offset, j.records = 0, 0
+	}
+	j.loaded = info
+	if info.Size() == j.offset {
+		return nil
+	}
+
+	file, err := os.Open(j.path)
+	if err != nil {
+		return fmt.Errorf("couldn't open log: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(j.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("couldn't seek to unread records: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("[WARN] ignoring incomplete final record in %v", j.path)
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("couldn't read log: %w", err)
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			record := new(logRecord)
+			if err := json.Unmarshal(trimmed, record); err != nil {
+				return fmt.Errorf("couldn't parse record %d of %v: %w", j.records+1, j.path, err)
+			} else if err := j.apply(record); err != nil {
+				return fmt.Errorf("invalid record %d of %v: %w", j.records+1, j.path, err)
+			}
+			j.records++
+		}
+		j.offset += int64(len(line))
+	}
+}
+
+// apply record to the cache.
+func (j *JSONL) apply(record *logRecord) error {
+	switch record.Op {
+	case opUpsert:
+		if record.Text == nil || record.Text.ID == "" {
+			return fmt.Errorf("upsert without text ID")
+		}
+		j.cache.Upsert(context.Background(), record.Text)
+		j.updated[record.Text.ID] = record.At
+	case opDelete:
+		// Deleting a missing text is a no-op: logs may be concatenated.
+		j.cache.Delete(context.Background(), record.ID)
+		delete(j.updated, record.ID)
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+	return nil
+}
+
+// append records to the log in a single write, then apply them to the cache.
+func (j *JSONL) append(records ...*logRecord) error {
+	var lines []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("couldn't marshal record: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("couldn't open log: %w", err)
+	}
+	defer file.Close()
+	// Overwrite any incomplete final record.
+	if j.loaded.Size() > j.offset {
+		if err := file.Truncate(j.offset); err != nil {
+			return fmt.Errorf("couldn't truncate incomplete record: %w", err)
+		}
+	}
+	if _, err := file.Write(lines); err != nil {
+		return fmt.Errorf("couldn't append to log: %w", err)
+	} else if err := file.Sync(); err != nil {
+		return fmt.Errorf("couldn't sync log: %w", err)
+	} else if j.loaded, err = file.Stat(); err != nil {
+		return fmt.Errorf("couldn't stat log: %w", err)
+	}
+	j.offset += int64(len(lines))
+	for _, record := range records {
+		j.records++
+		if err := j.apply(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact the log down to one upsert per live text, ordered by ID so
+// compaction is deterministic.
+func (j *JSONL) compact() error {
+	ids := make([]string, 0, len(j.cache.texts))
+	for id := range j.cache.texts {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var contents bytes.Buffer
+	encoder := json.NewEncoder(&contents)
+	encoder.SetEscapeHTML(false)
+	for _, id := range ids {
+		record := &logRecord{Op: opUpsert, At: j.updated[id], Text: j.cache.texts[id]}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("couldn't marshal record: %w", err)
+		}
+	}
+
+	info, err := replaceFile(j.path, contents.Bytes())
+	if err != nil {
+		return err
+	}
+	j.loaded, j.offset, j.records = info, info.Size(), len(ids)
+	return nil
+}
+
+// shouldCompact reports whether obsolete records outweigh live texts.
+func (j *JSONL) shouldCompact() bool {
+	obsolete := j.records - len(j.cache.texts)
+	return obsolete >= max(j.compactionMinimum, len(j.cache.texts))
+}
+
+// read from the cache after replaying any new records.
+func (j *JSONL) read(operation func() error) error {
+	return j.withLock(sharedLock, func() error {
+		if err := j.replay(); err != nil {
+			return err
+		}
+		return operation()
+	})
+}
+
+// write records built by operation after replaying any new records.
+// Compacts the log if it's accumulated enough obsolete records.
+func (j *JSONL) write(operation func() ([]*logRecord, error)) error {
+	return j.withLock(exclusiveLock, func() error {
+		if err := j.replay(); err != nil {
+			return err
+		}
+		records, err := operation()
+		if err != nil {
+			return err
+		} else if err := j.append(records...); err != nil {
+			// Replay from scratch next time, in case the append was partial.
+			j.loaded = nil
+			return err
+		}
+		if j.shouldCompact() {
+			if err := j.compact(); err != nil {
+				log.Printf("[WARN] couldn't compact %v: %v", j.path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Compact implements [Compacter]: it rewrites the log with one record per
+// live text.
+func (j *JSONL) Compact(ctx context.Context) error {
+	return j.withLock(exclusiveLock, func() error {
+		if err := j.replay(); err != nil {
+			return err
+		}
+		return j.compact()
+	})
+}
+
+// Read implements [Interface].
+func (j *JSONL) Read(ctx context.Context, id string) (t *text.Text, err error) {
+	err = j.read(func() error {
+		t, err = j.cache.Read(ctx, id)
+		return err
+	})
+	return t, err
+}
+
+// Upsert implements [Interface].
+func (j *JSONL) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	err := j.write(func() ([]*logRecord, error) {
+		return []*logRecord{{Op: opUpsert, At: time.Now(), Text: t}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UpsertMany implements [Interface] in a single append.
+func (j *JSONL) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	err := j.write(func() ([]*logRecord, error) {
+		now := time.Now()
+		records := make([]*logRecord, len(texts))
+		for i, t := range texts {
+			records[i] = &logRecord{Op: opUpsert, At: now, Text: t}
+		}
+		return records, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// Delete implements [Interface].
+func (j *JSONL) Delete(ctx context.Context, id string) (t *text.Text, err error) {
+	err = j.write(func() ([]*logRecord, error) {
+		if t, err = j.cache.Read(ctx, id); err != nil {
+			return nil, err
+		}
+		return []*logRecord{{Op: opDelete, At: time.Now(), ID: id}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteMany implements [Interface] in a single append. It deletes none of the
+// texts if any is missing.
+func (j *JSONL) DeleteMany(ctx context.Context, ids []string) (texts []*text.Text, err error) {
+	err = j.write(func() ([]*logRecord, error) {
+		now := time.Now()
+		records := make([]*logRecord, len(ids))
+		texts = make([]*text.Text, len(ids))
+		for i, id := range ids {
+			if texts[i], err = j.cache.Read(ctx, id); err != nil {
+				return nil, err
+			}
+			records[i] = &logRecord{Op: opDelete, At: now, ID: id}
+		}
+		return records, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// List implements [Interface].
+func (j *JSONL) List(ctx context.Context, q Query) (texts []*text.Text, err error) {
+	err = j.read(func() error {
+		texts, err = j.cache.List(ctx, q)
+		return err
+	})
+	return texts, err
+}
+
+// Search implements [Interface].
+func (j *JSONL) Search(ctx context.Context, query string, limit int) (results []search.Result, err error) {
+	err = j.read(func() error {
+		results, err = j.cache.Search(ctx, query, limit)
+		return err
+	})
+	return results, err
+}
+
+// Close implements [Interface].
+func (j *JSONL) Close() error {
+	return j.lock.Close()
+}
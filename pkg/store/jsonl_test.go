@@ -0,0 +1,110 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLReplaysLog(t *testing.T) {
+	path := filepath.Join(t.ArtifactDir(), "tir.jsonl")
+	j, err := useJSONL(path, defaultCompactionMinimum)
+	require.NoError(t, err)
+
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa", Title: "first"})
+	require.NoError(t, err)
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa", Title: "second"})
+	require.NoError(t, err)
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "bbbbbbbb"})
+	require.NoError(t, err)
+	_, err = j.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	_, err = j.Delete(t.Context(), "bbbbbbbb")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, j.Close())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(contents)), "\n"), 4, "one line per change")
+
+	reopened, err := useJSONL(path, defaultCompactionMinimum)
+	require.NoError(t, err)
+	defer reopened.Close()
+	texts, err := reopened.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	require.Len(t, texts, 1)
+	assert.Equal(t, "second", texts[0].Title)
+}
+
+func TestJSONLToleratesIncompleteRecord(t *testing.T) {
+	path := filepath.Join(t.ArtifactDir(), "tir.jsonl")
+	log := `{"op":"upsert","at":"2024-01-01T00:00:00Z","text":{"id":"aaaaaaaa"}}` + "\n" + `{"op":"upsert","text":{"id":"bb`
+	require.NoError(t, os.WriteFile(path, []byte(log), 0644))
+
+	j, err := useJSONL(path, defaultCompactionMinimum)
+	require.NoError(t, err)
+	defer j.Close()
+	texts, err := j.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aaaaaaaa"}, ids(texts))
+
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "cccccccc"})
+	require.NoError(t, err)
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), `"bb`, "appends overwrite incomplete records")
+
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0644))
+	_, err = j.List(t.Context(), Query{})
+	assert.ErrorContains(t, err, "record 1")
+}
+
+func TestJSONLCompaction(t *testing.T) {
+	path := filepath.Join(t.ArtifactDir(), "tir.jsonl")
+	j, err := useJSONL(path, 4)
+	require.NoError(t, err)
+	defer j.Close()
+	other, err := useJSONL(path, 4)
+	require.NoError(t, err)
+	defer other.Close()
+
+	lines := func() int {
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Count(string(contents), "\n")
+	}
+
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa"})
+	require.NoError(t, err)
+	_, err = other.Upsert(t.Context(), &text.Text{ID: "bbbbbbbb"})
+	require.NoError(t, err)
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa", Note: "updated"})
+	require.NoError(t, err)
+	_, err = j.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	assert.Equal(t, 4, lines(), "three obsolete records don't trigger compaction")
+
+	_, err = other.Upsert(t.Context(), &text.Text{ID: "aaaaaaaa", Note: "updated again"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, lines(), "four obsolete records trigger compaction")
+
+	// Other instances replay compacted logs from the beginning.
+	read, err := j.Read(t.Context(), "aaaaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated again", read.Note)
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "cccccccc"})
+	require.NoError(t, err)
+	_, err = j.Upsert(t.Context(), &text.Text{ID: "cccccccc", Note: "updated"})
+	require.NoError(t, err)
+
+	require.NoError(t, other.Compact(t.Context()))
+	assert.Equal(t, 2, lines())
+	texts, err := j.List(t.Context(), Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aaaaaaaa", "cccccccc"}, ids(texts))
+}
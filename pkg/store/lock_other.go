@@ -0,0 +1,19 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// Without flock, file stores are only safe for use by one process at a time.
+
+func openLock(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+}
+
+func lockFile(*os.File, bool) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
+
+// ignoreUnsupportedSync ignores errors syncing directories, which some
+// platforms don't support.
+func ignoreUnsupportedSync(error) error { return nil }
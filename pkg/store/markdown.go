@@ -0,0 +1,381 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+	"gopkg.in/yaml.v3"
+)
+
+// markdownExtension of files in a markdown store.
+const markdownExtension = ".md"
+
+// frontMatterDelimiter opens and closes a file's YAML front matter.
+const frontMatterDelimiter = "---"
+
+// UseMarkdown at dir as a directory of Markdown files, one per text. If the
+// directory doesn't exist, it's created.
+func UseMarkdown(dir string) (Interface, error) {
+	return useMarkdown(dir)
+}
+
+func useMarkdown(dir string) (*Markdown, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory: %w", err)
+	}
+	m := &Markdown{dir: dir, files: map[string]fs.FileInfo{}, cache: useMemory()}
+	if _, err := m.sync(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Markdown implements [Interface] with a directory of Markdown files: each
+// text is stored in <dir>/<id>.md, with its fields in YAML front matter and
+// its note as the Markdown body. For example:
+//
+//	---
+//	title: Visualizing IP data
+//	url: https://davidchall.github.io/ggip/articles/visualizing-ip-data.html
+//	author: David Hall
+//	timestamp: 2023-04-07T21:43:52.776451-07:00
+//	---
+//
+//	Use a Hilbert Curve: efficient 2D packing that keeps consecutive sequences
+//	spatially contiguous.
+//
+// Files may be edited by hand, or by other tools: each operation re-reads
+// files that changed. Markdown ignores other files, including Markdown files
+// without a url in their front matter. List and Search skip files that can't
+// be parsed, rather than failing: List returns a [*Warning] describing them
+// alongside the other texts. Read returns their errors.
+type Markdown struct {
+	sync.Mutex
+	dir string
+	// files describes each parsed file when it was last read or written, by ID.
+	files map[string]fs.FileInfo
+	cache *Memory
+}
+
+// markdownFrontMatter holds every [text.Text] field but the ID, which is the
+// file name, and the note, which is the body.
+type markdownFrontMatter struct {
+	Title     string      `yaml:"title"`
+	URL       string      `yaml:"url"`
+	Author    string      `yaml:"author"`
+	Tags      []string    `yaml:"tags,omitempty"`
+	Status    text.Status `yaml:"status,omitempty"`
+	Timestamp time.Time   `yaml:"timestamp"`
+	Updated   time.Time   `yaml:"updated,omitempty"`
+}
+
+// errNotText marks files that aren't tir texts.
+var errNotText = errors.New("not a tir text")
+
+// path to the file for the text with id.
+func (m *Markdown) path(id string) string {
+	return filepath.Join(m.dir, id+markdownExtension)
+}
+
+// validateID as a file name.
+func validateID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return &text.ValidationError{Field: "id", Reason: fmt.Sprintf("ID %q isn't a valid file name", id)}
+	}
+	return nil
+}
+
+// sync the cache with every file in the directory, skipping unparseable files.
+// Returns a warning describing them, or nil if there are none.
+func (m *Markdown) sync() (*Warning, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list directory: %w", err)
+	}
+	var warning *Warning
+	present := map[string]bool{}
+	for _, entry := range entries {
+		id, isMarkdown := strings.CutSuffix(entry.Name(), markdownExtension)
+		if !isMarkdown || entry.IsDir() || validateID(id) != nil {
+			continue
+		}
+		present[id] = true
+		if err := m.syncFile(id); errors.Is(err, errNotText) {
+			continue
+		} else if err != nil {
+			if warning == nil {
+				warning = new(Warning)
+			}
+			warning.Problems = append(warning.Problems, fmt.Errorf("skipped unparseable file %v: %w", m.path(id), err))
+		}
+	}
+	for id := range m.files {
+		if !present[id] {
+			m.forget(id)
+		}
+	}
+	return warning, nil
+}
+
+// syncFile updates the cache for the text with id if its file changed.
+// Returns [ErrNotFound] if there's no such file, or errNotText if it isn't a
+// text; in either case, the text is removed from the cache.
+func (m *Markdown) syncFile(id string) error {
+	info, err := os.Stat(m.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		m.forget(id)
+		return fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	} else if err != nil {
+		return fmt.Errorf("couldn't stat file: %w", err)
+	}
+	if previous, ok := m.files[id]; ok && os.SameFile(info, previous) && info.ModTime().Equal(previous.ModTime()) && info.Size() == previous.Size() {
+		return nil
+	}
+
+	contents, err := os.ReadFile(m.path(id))
+	if err != nil {
+		return fmt.Errorf("couldn't read file: %w", err)
+	}
+	t, err := parseMarkdown(contents)
+	if err != nil {
+		m.forget(id)
+		return err
+	}
+	t.ID = id
+	m.cache.Upsert(context.Background(), t)
+	m.files[id] = info
+	return nil
+}
+
+// forget the text with id.
+func (m *Markdown) forget(id string) {
+	delete(m.files, id)
+	m.cache.Delete(context.Background(), id)
+}
+
+// parseMarkdown parses a text from a Markdown file's contents. Returns
+// errNotText if the contents don't have front matter with a url.
+func parseMarkdown(contents []byte) (*text.Text, error) {
+	contents = bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+	rest, ok := bytes.CutPrefix(contents, []byte(frontMatterDelimiter+"\n"))
+	if !ok {
+		return nil, errNotText
+	}
+	var frontMatter, body []byte
+	if before, after, found := bytes.Cut(rest, []byte("\n"+frontMatterDelimiter+"\n")); found {
+		frontMatter, body = before, after
+	} else if before, found := bytes.CutSuffix(rest, []byte("\n"+frontMatterDelimiter)); found {
+		frontMatter = before
+	} else {
+		return nil, errors.New("unterminated front matter")
+	}
+
+	// Check for a url before decoding into text fields, so unrelated notes
+	// with incompatible front matter are ignored rather than reported.
+	var keys map[string]any
+	if err := yaml.Unmarshal(frontMatter, &keys); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	} else if _, ok := keys["url"]; !ok {
+		return nil, errNotText
+	}
+	var fields markdownFrontMatter
+	if err := yaml.Unmarshal(frontMatter, &fields); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	// Strip the blank line following the front matter and the file's final
+	// newline.
+	note := strings.TrimPrefix(string(body), "\n")
+	note = strings.TrimSuffix(note, "\n")
+	return &text.Text{
+		Title:     fields.Title,
+		URL:       fields.URL,
+		Author:    fields.Author,
+		Note:      note,
+		Tags:      fields.Tags,
+		Status:    fields.Status,
+		Timestamp: fields.Timestamp,
+		Updated:   fields.Updated,
+	}, nil
+}
+
+// renderMarkdown renders t as a Markdown file's contents; see [Markdown].
+func renderMarkdown(t *text.Text) ([]byte, error) {
+	frontMatter, err := yaml.Marshal(markdownFrontMatter{
+		Title:     t.Title,
+		URL:       t.URL,
+		Author:    t.Author,
+		Tags:      t.Tags,
+		Status:    t.Status,
+		Timestamp: t.Timestamp,
+		Updated:   t.Updated,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal front matter: %w", err)
+	}
+	var contents bytes.Buffer
+	contents.WriteString(frontMatterDelimiter + "\n")
+	contents.Write(frontMatter)
+	contents.WriteString(frontMatterDelimiter + "\n\n")
+	contents.WriteString(t.Note)
+	contents.WriteString("\n")
+	return contents.Bytes(), nil
+}
+
+// Read implements [Interface].
+func (m *Markdown) Read(ctx context.Context, id string) (*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := validateID(id); err != nil {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	} else if err := m.syncFile(id); errors.Is(err, errNotText) {
+		return nil, fmt.Errorf("%w: %v isn't a tir text", ErrNotFound, m.path(id))
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", m.path(id), err)
+	}
+	return m.cache.Read(ctx, id)
+}
+
+// Upsert implements [Interface].
+func (m *Markdown) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := validateID(t.ID); err != nil {
+		return nil, err
+	}
+	contents, err := renderMarkdown(t)
+	if err != nil {
+		return nil, err
+	}
+	info, err := replaceFile(m.path(t.ID), contents)
+	if err != nil {
+		return nil, err
+	}
+	m.files[t.ID] = info
+	return m.cache.Upsert(ctx, t)
+}
+
+// UpsertMany implements [Interface]. It validates and renders every text before
+// writing any, but writes their files in turn: if writing one fails, the texts
+// before it remain upserted.
+func (m *Markdown) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	contents := make([][]byte, len(texts))
+	for i, t := range texts {
+		var err error
+		if err = validateID(t.ID); err != nil {
+			return nil, err
+		} else if contents[i], err = renderMarkdown(t); err != nil {
+			return nil, err
+		}
+	}
+	for i, t := range texts {
+		info, err := replaceFile(m.path(t.ID), contents[i])
+		if err != nil {
+			return nil, err
+		}
+		m.files[t.ID] = info
+		m.cache.Upsert(ctx, t)
+	}
+	return texts, nil
+}
+
+// Delete implements [Interface].
+func (m *Markdown) Delete(ctx context.Context, id string) (*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := validateID(id); err != nil {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	} else if err := m.syncFile(id); errors.Is(err, errNotText) {
+		return nil, fmt.Errorf("%w: %v isn't a tir text", ErrNotFound, m.path(id))
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", m.path(id), err)
+	}
+	t, err := m.cache.Read(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if err := os.Remove(m.path(id)); err != nil {
+		return nil, fmt.Errorf("couldn't delete file: %w", err)
+	}
+	m.forget(id)
+	return t, nil
+}
+
+// DeleteMany implements [Interface]. It checks that every text exists before
+// deleting any, but deletes their files in turn: if deleting one fails, the
+// texts before it remain deleted.
+func (m *Markdown) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	texts := make([]*text.Text, len(ids))
+	for i, id := range ids {
+		var err error
+		if err = validateID(id); err != nil {
+			return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+		} else if err = m.syncFile(id); errors.Is(err, errNotText) {
+			return nil, fmt.Errorf("%w: %v isn't a tir text", ErrNotFound, m.path(id))
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading %v: %w", m.path(id), err)
+		} else if texts[i], err = m.cache.Read(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		if err := os.Remove(m.path(id)); err != nil {
+			return nil, fmt.Errorf("couldn't delete file: %w", err)
+		}
+		m.forget(id)
+	}
+	return texts, nil
+}
+
+// List implements [Interface]. If it skipped unparseable files, it returns
+// the other texts and a [*Warning].
+func (m *Markdown) List(ctx context.Context, q Query) ([]*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	warning, err := m.sync()
+	if err != nil {
+		return nil, err
+	}
+	texts, err := m.cache.List(ctx, q)
+	if err != nil {
+		return nil, err
+	} else if warning != nil {
+		return texts, warning
+	}
+	return texts, nil
+}
+
+// Search implements [Interface].
+func (m *Markdown) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, err := m.sync(); err != nil {
+		return nil, err
+	}
+	return m.cache.Search(ctx, query, limit)
+}
+
+// Close implements [Interface].
+func (m *Markdown) Close() error {
+	return nil
+}
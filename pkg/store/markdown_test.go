@@ -0,0 +1,92 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	dir := t.ArtifactDir()
+	m, err := useMarkdown(dir)
+	require.NoError(t, err)
+
+	original := &text.Text{
+		ID:        "35bb8126",
+		Title:     "Visualizing IP data",
+		URL:       "https://davidchall.github.io/ggip/articles/visualizing-ip-data.html",
+		Author:    "David Hall",
+		Note:      "Use a *Hilbert Curve*.\n\n---\n\nIt keeps sequences contiguous.",
+		Tags:      []string{"visualization"},
+		Timestamp: time.Date(2023, 4, 7, 21, 43, 52, 776451000, time.FixedZone("PDT", -7*60*60)),
+	}
+	_, err = m.Upsert(t.Context(), original)
+	require.NoError(t, err)
+	contents, err := os.ReadFile(filepath.Join(dir, "35bb8126.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "title: Visualizing IP data\n")
+	assert.Contains(t, string(contents), "timestamp: 2023-04-07T21:43:52.776451-07:00\n")
+
+	reopened, err := useMarkdown(dir)
+	require.NoError(t, err)
+	read, err := reopened.Read(t.Context(), "35bb8126")
+	require.NoError(t, err)
+	assert.True(t, original.Timestamp.Equal(read.Timestamp))
+	read.Timestamp = original.Timestamp
+	assert.Equal(t, original, read)
+
+	_, err = m.Delete(t.Context(), "35bb8126")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "35bb8126.md"))
+	_, err = reopened.Read(t.Context(), "35bb8126")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = m.Upsert(t.Context(), &text.Text{ID: "../escape"})
+	var validationErr *text.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+}
+
+func TestMarkdownToleratesHandEdits(t *testing.T) {
+	dir := t.ArtifactDir()
+	write := func(name, contents string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+	write("aaaaaaaa.md", "---\ntitle: Hand-written\nurl: https://example.com\nauthor: Me\ntimestamp: 2024-01-02\n---\n\nA note.\n")
+	write("README.md", "# Reading notes\n")
+	write("obsidian.md", "---\naliases: [unrelated]\n---\nAn unrelated note.\n")
+	write("todo.txt", "not markdown")
+	write("broken00.md", "---\nurl: https://example.com\ntimestamp: [not a time\n---\n")
+
+	m, err := useMarkdown(dir)
+	require.NoError(t, err)
+	texts, err := m.List(t.Context(), Query{})
+	var warning *Warning
+	require.ErrorAs(t, err, &warning, "List warns about unparseable files")
+	require.Len(t, warning.Problems, 1)
+	assert.ErrorContains(t, warning, "broken00.md")
+	assert.Equal(t, []string{"aaaaaaaa"}, ids(texts), "unparseable files don't fail List")
+	assert.Equal(t, "A note.", texts[0].Note)
+
+	_, err = m.Read(t.Context(), "broken00")
+	assert.ErrorContains(t, err, "invalid front matter", "Read reports unparseable files")
+	_, err = m.Read(t.Context(), "README")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Edits and new files are picked up.
+	write("aaaaaaaa.md", "---\ntitle: Edited\nurl: https://example.com\nauthor: Me\ntimestamp: 2024-01-02T00:00:00Z\n---\nEdited note.\n")
+	write("bbbbbbbb.md", "---\ntitle: New\nurl: https://example.com\nauthor: Me\ntimestamp: 2024-01-03T00:00:00Z\n---\n")
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken00.md")))
+	texts, err = m.List(t.Context(), Query{Sort: SortTitle})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb"}, ids(texts))
+	assert.Equal(t, "Edited note.", texts[0].Note)
+
+	results, err := m.Search(t.Context(), "edited", 0)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+}
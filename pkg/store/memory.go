@@ -1,10 +1,12 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/text"
 )
 
@@ -18,67 +20,125 @@ func UseMemory(initialTexts ...*text.Text) Interface {
 }
 
 func useMemory(initialTexts ...*text.Text) *Memory {
-	m := &Memory{
-		texts: make(map[string]*text.Text),
-	}
+	m := newMemory(make(map[string]*text.Text))
 	for _, t := range initialTexts {
-		if _, err := m.Upsert(t); err != nil {
+		if _, err := m.Upsert(context.Background(), t); err != nil {
 			log.Printf("ignoring error upserting initial text '%v': %v", t.ID, err)
 		}
 	}
 	return m
 }
 
+// newMemory wraps texts, keyed by ID, in a memory store.
+func newMemory(texts map[string]*text.Text) *Memory {
+	m := &Memory{texts: texts, index: search.NewIndex()}
+	for _, t := range texts {
+		m.index.Add(t)
+	}
+	return m
+}
+
 // Memory implements [Interface] in-memory. See [UseMemory].
 type Memory struct {
 	sync.RWMutex
 	texts map[string]*text.Text
+	index *search.Index
 }
 
 // Read implements [Interface].
-func (m *Memory) Read(id string) (*text.Text, error) {
+func (m *Memory) Read(_ context.Context, id string) (*text.Text, error) {
 	m.RLock()
 	defer m.RUnlock()
 
 	text, ok := m.texts[id]
 	if !ok {
-		return nil, fmt.Errorf("no text with ID '%v'", id)
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
 	}
 	return text, nil
 }
 
 // Upsert implements [Interface].
-func (m *Memory) Upsert(t *text.Text) (*text.Text, error) {
+func (m *Memory) Upsert(_ context.Context, t *text.Text) (*text.Text, error) {
 	m.Lock()
 	defer m.Unlock()
 
 	m.texts[t.ID] = t
+	m.index.Add(t)
 	return t, nil
 }
 
+// UpsertMany implements [Interface].
+func (m *Memory) UpsertMany(_ context.Context, texts []*text.Text) ([]*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, t := range texts {
+		m.texts[t.ID] = t
+		m.index.Add(t)
+	}
+	return texts, nil
+}
+
 // Delete implements [Interface].
-func (m *Memory) Delete(id string) (*text.Text, error) {
+func (m *Memory) Delete(_ context.Context, id string) (*text.Text, error) {
 	m.Lock()
 	defer m.Unlock()
 
 	text, ok := m.texts[id]
 	if !ok {
-		return nil, fmt.Errorf("no text with ID '%v'", id)
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
 	}
 
 	delete(m.texts, id)
+	m.index.Remove(id)
 	return text, nil
 }
 
+// DeleteMany implements [Interface]. It deletes none of the texts if any is
+// missing.
+func (m *Memory) DeleteMany(_ context.Context, ids []string) ([]*text.Text, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	deleted := make([]*text.Text, len(ids))
+	for i, id := range ids {
+		text, ok := m.texts[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+		}
+		deleted[i] = text
+	}
+	for _, id := range ids {
+		delete(m.texts, id)
+		m.index.Remove(id)
+	}
+	return deleted, nil
+}
+
 // List implements [Interface].
-func (m *Memory) List(c text.Comparator, d text.Direction) ([]*text.Text, error) {
+func (m *Memory) List(_ context.Context, q Query) ([]*text.Text, error) {
+	m.RLock()
+	defer m.RUnlock()
+
 	texts := make([]*text.Text, 0, len(m.texts))
 	for _, t := range m.texts {
 		texts = append(texts, t)
 	}
+	return q.Apply(texts)
+}
 
-	text.Sort(texts).By(c, d)
-	return texts, nil
+// Search implements [Interface] with an inverted index.
+func (m *Memory) Search(_ context.Context, query string, limit int) ([]search.Result, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	hits := m.index.Search(query, limit)
+	results := make([]search.Result, len(hits))
+	for i, hit := range hits {
+		t := m.texts[hit.ID]
+		results[i] = search.Result{Text: t, Score: hit.Score, Snippet: search.Highlight(t, query)}
+	}
+	return results, nil
 }
 
 // Close implements [Interface].
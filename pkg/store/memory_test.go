@@ -12,7 +12,7 @@ func TestUseMemory(t *testing.T) {
 
 	m := UseMemory()
 	someText := &text.Text{ID: "some-id"}
-	created, err := m.Upsert(someText)
+	created, err := m.Upsert(t.Context(), someText)
 	assert.NoError(t, err, "stores don't do validation")
 	assert.Equal(t, someText, created)
 }
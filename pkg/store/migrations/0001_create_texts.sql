@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS texts (
+	id varchar(8) NOT NULL UNIQUE,
+	title text NOT NULL,
+	url text NOT NULL,
+	author text NOT NULL,
+	note text NOT NULL,
+	timestamp DATETIME NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE texts ADD COLUMN tags text NOT NULL DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE texts ADD COLUMN status text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Existing rows are backfilled in Go; see (*SQL).backfillUnixMicros.
+ALTER TABLE texts ADD COLUMN unix_micros INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,21 @@
+-- An FTS5 index over texts, and triggers to keep it in sync. Keep its columns
+-- in sync with search.Tokenize's fields.
+CREATE VIRTUAL TABLE IF NOT EXISTS texts_fts USING fts5(
+	title, author, note, content='texts', content_rowid='rowid'
+);
+CREATE TRIGGER IF NOT EXISTS texts_fts_insert AFTER INSERT ON texts BEGIN
+	INSERT INTO texts_fts (rowid, title, author, note)
+	VALUES (new.rowid, new.title, new.author, new.note);
+END;
+CREATE TRIGGER IF NOT EXISTS texts_fts_delete AFTER DELETE ON texts BEGIN
+	INSERT INTO texts_fts (texts_fts, rowid, title, author, note)
+	VALUES ('delete', old.rowid, old.title, old.author, old.note);
+END;
+CREATE TRIGGER IF NOT EXISTS texts_fts_update AFTER UPDATE ON texts BEGIN
+	INSERT INTO texts_fts (texts_fts, rowid, title, author, note)
+	VALUES ('delete', old.rowid, old.title, old.author, old.note);
+	INSERT INTO texts_fts (rowid, title, author, note)
+	VALUES (new.rowid, new.title, new.author, new.note);
+END;
+-- Index rows written before texts_fts existed.
+INSERT INTO texts_fts (texts_fts) VALUES ('rebuild');
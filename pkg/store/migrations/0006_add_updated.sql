@@ -0,0 +1 @@
+ALTER TABLE texts ADD COLUMN updated text NOT NULL DEFAULT '';
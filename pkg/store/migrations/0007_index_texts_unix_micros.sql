@@ -0,0 +1,2 @@
+-- Lists are ordered by timestamp by default; see compileQuery.
+CREATE INDEX IF NOT EXISTS texts_unix_micros ON texts (unix_micros, id);
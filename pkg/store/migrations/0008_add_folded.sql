@@ -0,0 +1,3 @@
+-- String filters match folded, not the columns it copies; see compileQuery.
+-- Existing rows are backfilled in Go; see (*SQL).backfillFolded.
+ALTER TABLE texts ADD COLUMN folded text NOT NULL DEFAULT '';
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// ErrInvalidCursor is returned by [Paginate] for malformed cursors.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page of texts returned by [Paginate].
+type Page struct {
+	Texts []*text.Text
+	// Next and Prev are opaque cursors for the adjacent pages, or empty if
+	// there's no such page.
+	Next, Prev string
+}
+
+// cursor is a position in a Query's order, encoded as an opaque string.
+type cursor struct {
+	// ID and sort fields of the text at the cursor's position.
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"ts,omitzero"`
+	Title     string    `json:"ti,omitempty"`
+	Author    string    `json:"au,omitempty"`
+	// Backward cursors select the page before the position rather than the
+	// page after it.
+	Backward bool `json:"b,omitempty"`
+}
+
+func newCursor(q Query, t *text.Text, backward bool) string {
+	c := cursor{ID: t.ID, Backward: backward}
+	switch q.Sort {
+	case SortTitle:
+		c.Title = t.Title
+	case SortAuthor:
+		c.Author = t.Author
+	default:
+		c.Timestamp = t.Timestamp
+	}
+	// Marshaling these fields can't fail.
+	bytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func parseCursor(encoded string) (*cursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	c := new(cursor)
+	if err := json.Unmarshal(bytes, c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
+
+func (c *cursor) position() *text.Text {
+	return &text.Text{ID: c.ID, Timestamp: c.Timestamp, Title: c.Title, Author: c.Author}
+}
+
+// Paginate lists a page of up to q.Limit texts matching q with list, starting
+// from the position encoded in cursor (or the beginning, if cursor is empty).
+// Cursors are only meaningful for the query that produced them.
+//
+// Unlike offsets, cursors are positions in the collection: walking pages
+// doesn't skip or repeat texts when texts are created concurrently.
+//
+// If list returns a [*Warning] with its texts, Paginate returns it with the
+// page.
+func Paginate(ctx context.Context, list func(context.Context, Query) ([]*text.Text, error), q Query, encodedCursor string) (*Page, error) {
+	if q.Limit <= 0 {
+		return nil, fmt.Errorf("pagination requires a positive limit")
+	}
+	c := new(cursor)
+	if encodedCursor != "" {
+		var err error
+		if c, err = parseCursor(encodedCursor); err != nil {
+			return nil, err
+		}
+		q.After = c.position()
+	}
+
+	// List one extra text to detect whether there's a page beyond this one.
+	limit := q.Limit
+	q.Limit++
+	if c.Backward {
+		q.Direction = reversed(q.Direction)
+	}
+	texts, err := list(ctx, q)
+	if err != nil && !errors.As(err, new(*Warning)) {
+		return nil, err
+	}
+	// Either nil or a warning.
+	warning := err
+	more := len(texts) > limit
+	if more {
+		texts = texts[:limit]
+	}
+	if c.Backward {
+		q.Direction = reversed(q.Direction)
+		slices.Reverse(texts)
+	}
+
+	page := &Page{Texts: texts}
+	if len(texts) == 0 {
+		return page, warning
+	}
+	// Moving backward, there's a next page (we came from it); the extra text
+	// indicates a previous page. Vice versa moving forward.
+	if more || c.Backward {
+		page.Next = newCursor(q, texts[len(texts)-1], false)
+	}
+	if (more && c.Backward) || (!c.Backward && encodedCursor != "") {
+		page.Prev = newCursor(q, texts[0], true)
+	}
+	return page, warning
+}
+
+func reversed(d text.Direction) text.Direction {
+	if d == text.Ascending {
+		return text.Descending
+	}
+	return text.Ascending
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	s := UseMemory(queryFixtures()...)
+	q := Query{Direction: text.Descending, Limit: 3}
+
+	first, err := Paginate(t.Context(), s.List, q, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cccccccc", "bbbbbbbb", "aaaaaaaa"}, ids(first.Texts))
+	assert.Empty(t, first.Prev)
+	require.NotEmpty(t, first.Next)
+
+	// Texts created while paginating don't shift later pages.
+	_, err = s.Upsert(t.Context(), &text.Text{ID: "eeeeeeee", Timestamp: first.Texts[0].Timestamp.Add(1)})
+	require.NoError(t, err)
+
+	second, err := Paginate(t.Context(), s.List, q, first.Next)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dddddddd"}, ids(second.Texts))
+	assert.Empty(t, second.Next)
+	require.NotEmpty(t, second.Prev)
+
+	previous, err := Paginate(t.Context(), s.List, q, second.Prev)
+	require.NoError(t, err)
+	assert.Equal(t, ids(first.Texts), ids(previous.Texts))
+	assert.NotEmpty(t, previous.Next)
+	assert.NotEmpty(t, previous.Prev, "the created text is on a page before the first")
+
+	_, err = Paginate(t.Context(), s.List, q, "not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = Paginate(t.Context(), s.List, Query{}, "")
+	assert.Error(t, err, "pagination requires a limit")
+}
+
+func TestQueryAfter(t *testing.T) {
+	stores := map[string]Interface{
+		"memory": UseMemory(queryFixtures()...),
+		"sql":    startLocalLibSQL(t),
+		"bolt":   startBolt(t),
+	}
+	for _, fixture := range queryFixtures() {
+		for _, name := range []string{"sql", "bolt"} {
+			_, err := stores[name].Upsert(t.Context(), fixture)
+			require.NoError(t, err)
+		}
+	}
+	fixtures := queryFixtures()
+
+	for name, s := range stores {
+		texts, err := s.List(t.Context(), Query{Sort: SortAuthor, After: fixtures[3]})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"cccccccc"}, ids(texts), name)
+
+		texts, err = s.List(t.Context(), Query{Direction: text.Descending, After: fixtures[1]})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{"aaaaaaaa", "dddddddd"}, ids(texts), name)
+		assert.NoError(t, s.Close())
+	}
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// ProblemContentType is the media type of a JSON [Problem].
+const ProblemContentType = "application/problem+json"
+
+// Problem details (RFC 9457) describing an error: the body of
+// [github.com/lukasschwab/tiir/cmd/server] error responses, which [HTTP]
+// converts back into errors with [Problem.Err].
+type Problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Field is the invalid field of a [text.ValidationError].
+	Field string `json:"field,omitempty"`
+}
+
+// NewProblem describes err with the HTTP status its kind implies:
+//
+//   - [ErrNotFound]: 404 Not Found
+//   - [ErrConflict]: 409 Conflict
+//   - [text.ValidationError]: 422 Unprocessable Entity
+//
+// Other errors get the fallback status.
+func NewProblem(err error, fallback int) *Problem {
+	p := &Problem{Status: fallback, Detail: err.Error()}
+	var validationErr *text.ValidationError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		p.Status = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		p.Status = http.StatusConflict
+	case errors.As(err, &validationErr):
+		p.Status = http.StatusUnprocessableEntity
+		p.Detail, p.Field = validationErr.Reason, validationErr.Field
+	}
+	p.Title = http.StatusText(p.Status)
+	return p
+}
+
+// Err converts p back into the kind of error [NewProblem] would describe with
+// p.Status.
+func (p *Problem) Err() error {
+	switch p.Status {
+	case http.StatusNotFound:
+		return &remoteError{detail: p.Detail, kind: ErrNotFound}
+	case http.StatusConflict:
+		return &remoteError{detail: p.Detail, kind: ErrConflict}
+	case http.StatusUnprocessableEntity:
+		return &text.ValidationError{Field: p.Field, Reason: p.Detail}
+	default:
+		return fmt.Errorf("server responded %d: %s", p.Status, p.Detail)
+	}
+}
+
+// remoteError is an error of a known kind reported by a server: it reads as
+// the server's detail, but matches kind with [errors.Is].
+type remoteError struct {
+	detail string
+	kind   error
+}
+
+func (e *remoteError) Error() string {
+	return e.detail
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.kind
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrNotFound(t *testing.T) {
+	for name, s := range map[string]Interface{"memory": UseMemory(), "sql": startLocalLibSQL(t)} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.Read(t.Context(), "missing0")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = s.Delete(t.Context(), "missing0")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestProblemRoundTrip(t *testing.T) {
+	// Respond to every request with the problem describing an error.
+	var respondWith error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem := NewProblem(respondWith, http.StatusInternalServerError)
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(problem.Status)
+		require.NoError(t, json.NewEncoder(w).Encode(problem))
+	}))
+	t.Cleanup(server.Close)
+	s, err := UseHTTP(server.URL, "")
+	require.NoError(t, err)
+
+	respondWith = fmt.Errorf("%w: no text with ID 'missing0'", ErrNotFound)
+	_, err = s.Read(t.Context(), "missing0")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, respondWith.Error())
+
+	respondWith = fmt.Errorf("error writing record: %w", ErrConflict)
+	_, err = s.Delete(t.Context(), "aaaaaaaa")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	respondWith = fmt.Errorf("error writing record: %w", (&text.Text{Title: "t"}).Validate())
+	_, err = s.Delete(t.Context(), "aaaaaaaa")
+	var validationErr *text.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "author", validationErr.Field)
+	assert.Equal(t, "must specify an author", validationErr.Reason)
+
+	respondWith = fmt.Errorf("disk on fire")
+	_, err = s.Delete(t.Context(), "aaaaaaaa")
+	assert.EqualError(t, err, "server responded 500: disk on fire")
+}
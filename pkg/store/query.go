@@ -0,0 +1,350 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// Query selects, orders, and paginates texts for [Interface.List]. The zero
+// Query lists every text by ascending timestamp.
+//
+// String filters are case-insensitive, folding case with [strings.ToLower],
+// including non-ASCII letters. Implementations that can't express a
+// Query natively (e.g. [Memory]) evaluate it with [Query.Apply], which is the
+// reference behavior.
+type Query struct {
+	// Author, if set, must be a substring of the text's author.
+	Author string
+	// URL, if set, must be a substring of the text's URL.
+	URL string
+	// Domain, if set, must be the host of the text's URL or one of its parent
+	// domains: "example.com" matches "https://blog.example.com/post".
+	Domain string
+	// Since, if set, is the earliest matching timestamp (inclusive).
+	Since time.Time
+	// Until, if set, is the latest matching timestamp (exclusive).
+	Until time.Time
+	// Match, if set, must be a substring of the text's title, author, or note.
+	Match string
+	// Tag, if set, must be one of the text's tags.
+	Tag string
+	// Statuses, if set, must include the text's [text.Text.CurrentStatus].
+	Statuses []text.Status
+	// IDs, if set, must include the text's ID.
+	IDs []string
+
+	// Sort by this field, breaking ties by ID.
+	Sort SortField
+	// Direction to sort in.
+	Direction text.Direction
+	// After, if set, excludes texts up to and including this position in q's
+	// order. Only its ID and the field q sorts by are significant. See
+	// [Paginate].
+	After *text.Text
+	// Limit the number of texts returned; zero means no limit.
+	Limit int
+	// Offset skips this many texts after sorting.
+	Offset int
+}
+
+// SortField is a text field a [Query] can sort by.
+type SortField string
+
+// Sortable fields. The zero SortField sorts by timestamp.
+const (
+	SortTimestamp SortField = "timestamp"
+	SortTitle     SortField = "title"
+	SortAuthor    SortField = "author"
+)
+
+// SortFields lists every valid [SortField].
+var SortFields = []SortField{SortTimestamp, SortTitle, SortAuthor}
+
+// comparator corresponding to f.
+func (f SortField) comparator() (text.Comparator, error) {
+	switch f {
+	case "", SortTimestamp:
+		return text.Timestamps, nil
+	case SortTitle:
+		return text.Titles, nil
+	case SortAuthor:
+		return text.Authors, nil
+	default:
+		return nil, fmt.Errorf("invalid sort field %q", f)
+	}
+}
+
+// Validate q's enumerated fields.
+func (q Query) Validate() error {
+	if _, err := q.Sort.comparator(); err != nil {
+		return err
+	}
+	for _, status := range q.Statuses {
+		if !slices.Contains(text.Statuses, status) {
+			valid := make([]string, len(text.Statuses))
+			for i, s := range text.Statuses {
+				valid[i] = string(s)
+			}
+			return fmt.Errorf("invalid status %q; use %v, or %v", status, strings.Join(valid, ", "), StatusAll)
+		}
+	}
+	if q.Direction != text.Ascending && q.Direction != text.Descending {
+		return fmt.Errorf("invalid direction %d", q.Direction)
+	} else if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit and offset must be nonnegative")
+	}
+	return nil
+}
+
+// Matches reports whether t satisfies q's filters.
+func (q Query) Matches(t *text.Text) bool {
+	switch {
+	case !containsFold(t.Author, q.Author):
+		return false
+	case !containsFold(t.URL, q.URL):
+		return false
+	case q.Domain != "" && !inDomain(hostOf(t.URL), q.Domain):
+		return false
+	case !q.Since.IsZero() && t.Timestamp.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !t.Timestamp.Before(q.Until):
+		return false
+	case q.Match != "" && !(containsFold(t.Title, q.Match) || containsFold(t.Author, q.Match) || containsFold(t.Note, q.Match)):
+		return false
+	case q.Tag != "" && !t.HasTag(q.Tag):
+		return false
+	case len(q.Statuses) > 0 && !t.HasStatus(q.Statuses...):
+		return false
+	case len(q.IDs) > 0 && !slices.Contains(q.IDs, t.ID):
+		return false
+	}
+	return true
+}
+
+// Apply q to texts: filter, sort, and paginate them. Apply doesn't modify
+// texts.
+func (q Query) Apply(texts []*text.Text) ([]*text.Text, error) {
+	compare, err := q.Sort.comparator()
+	if err != nil {
+		return nil, err
+	}
+
+	// Break ties by ID, so the order is total and After is unambiguous.
+	less := func(t1, t2 *text.Text) bool {
+		if compare(t1, t2) {
+			return true
+		} else if compare(t2, t1) {
+			return false
+		}
+		return t1.ID < t2.ID
+	}
+	before := less
+	if q.Direction == text.Descending {
+		before = func(t1, t2 *text.Text) bool { return less(t2, t1) }
+	}
+
+	matching := make([]*text.Text, 0, len(texts))
+	for _, t := range texts {
+		if q.Matches(t) && (q.After == nil || before(q.After, t)) {
+			matching = append(matching, t)
+		}
+	}
+	text.Sort(matching).By(less, q.Direction)
+
+	if q.Offset >= len(matching) {
+		return []*text.Text{}, nil
+	}
+	matching = matching[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(matching) {
+		matching = matching[:q.Limit]
+	}
+	return matching, nil
+}
+
+func containsFold(s, substring string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substring))
+}
+
+// hostOf rawURL: everything between its scheme and its path. Keep in sync with
+// hostExpression, which does the same in SQL.
+func hostOf(rawURL string) string {
+	if _, rest, found := strings.Cut(rawURL, "://"); found {
+		rawURL = rest
+	}
+	host, _, _ := strings.Cut(rawURL, "/")
+	return host
+}
+
+func inDomain(host, domain string) bool {
+	host, domain = strings.ToLower(host), strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Query parameter keys; see [Query.Values] and [ParseQuery].
+const (
+	paramAuthor    = "author"
+	paramURL       = "url"
+	paramDomain    = "domain"
+	paramSince     = "since"
+	paramUntil     = "until"
+	paramMatch     = "q"
+	paramTag       = "tag"
+	paramStatus    = "status"
+	paramID        = "id"
+	paramSort      = "sort"
+	paramDirection = "order"
+	paramLimit     = "limit"
+	paramOffset    = "offset"
+)
+
+// StatusAll is a special status parameter value matching texts regardless of
+// status. See [ParseQuery].
+const StatusAll = "all"
+
+// Direction parameter values.
+const (
+	directionAscending  = "asc"
+	directionDescending = "desc"
+)
+
+// Values encodes q as URL query parameters; see [ParseQuery].
+func (q Query) Values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set(paramAuthor, q.Author)
+	set(paramURL, q.URL)
+	set(paramDomain, q.Domain)
+	if !q.Since.IsZero() {
+		set(paramSince, q.Since.Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		set(paramUntil, q.Until.Format(time.RFC3339Nano))
+	}
+	set(paramMatch, q.Match)
+	set(paramTag, q.Tag)
+	if len(q.Statuses) == 0 {
+		set(paramStatus, StatusAll)
+	}
+	for _, status := range q.Statuses {
+		values.Add(paramStatus, string(status))
+	}
+	for _, id := range q.IDs {
+		values.Add(paramID, id)
+	}
+	set(paramSort, string(q.Sort))
+	// Always set the direction, since defaults vary by route.
+	if q.Direction == text.Descending {
+		set(paramDirection, directionDescending)
+	} else {
+		set(paramDirection, directionAscending)
+	}
+	if q.Limit > 0 {
+		set(paramLimit, strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		set(paramOffset, strconv.Itoa(q.Offset))
+	}
+	return values
+}
+
+// ParseQuery parses URL query parameters encoded by [Query.Values] over
+// defaults: omitted parameters keep their default values. Statuses and IDs may
+// be repeated or comma-separated; the status [StatusAll] matches any status.
+func ParseQuery(values url.Values, defaults Query) (Query, error) {
+	q := defaults
+	var err error
+	for key := range values {
+		value := values.Get(key)
+		switch key {
+		case paramAuthor:
+			q.Author = value
+		case paramURL:
+			q.URL = value
+		case paramDomain:
+			q.Domain = value
+		case paramMatch:
+			q.Match = value
+		case paramTag:
+			q.Tag = value
+		case paramSort:
+			q.Sort = SortField(value)
+		case paramSince:
+			if q.Since, err = ParseTime(value); err != nil {
+				return q, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		case paramUntil:
+			if q.Until, err = ParseTime(value); err != nil {
+				return q, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		case paramDirection:
+			if q.Direction, err = ParseDirection(value); err != nil {
+				return q, err
+			}
+		case paramLimit:
+			if q.Limit, err = strconv.Atoi(value); err != nil {
+				return q, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		case paramOffset:
+			if q.Offset, err = strconv.Atoi(value); err != nil {
+				return q, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		case paramStatus:
+			q.Statuses = parseStatuses(values[key])
+		case paramID:
+			q.IDs = nil
+			for _, list := range values[key] {
+				q.IDs = append(q.IDs, strings.Split(list, ",")...)
+			}
+		}
+	}
+	return q, q.Validate()
+}
+
+// parseStatuses from repeated, comma-separated lists. Returns nil if any
+// status is [StatusAll].
+func parseStatuses(lists []string) []text.Status {
+	var statuses []text.Status
+	for _, list := range lists {
+		for _, status := range strings.Split(list, ",") {
+			if status == StatusAll {
+				return nil
+			}
+			statuses = append(statuses, text.Status(status))
+		}
+	}
+	return statuses
+}
+
+// ParseTime parses a date (2006-01-02, in the local time zone) or an RFC 3339
+// timestamp. The empty string parses as the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	} else if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// ParseDirection parses "asc" or "desc". The empty string parses as
+// [text.Ascending].
+func ParseDirection(value string) (text.Direction, error) {
+	switch value {
+	case "", directionAscending:
+		return text.Ascending, nil
+	case directionDescending:
+		return text.Descending, nil
+	default:
+		return text.Ascending, fmt.Errorf("invalid direction %q; use %s or %s", value, directionAscending, directionDescending)
+	}
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queryFixtures() []*text.Text {
+	base := time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC)
+	pacific := time.FixedZone("PDT", -7*60*60)
+	return []*text.Text{
+		{ID: "aaaaaaaa", Title: "Visualizing IP data", Author: "David Hall", URL: "https://davidchall.github.io/ggip/", Note: "Hilbert curves", Tags: []string{"networking"}, Timestamp: base},
+		{ID: "bbbbbbbb", Title: "Go Proverbs", Author: "Rob Pike", URL: "https://go-proverbs.github.io", Note: "Clear is better than clever", Tags: []string{"Go"}, Timestamp: base.Add(time.Hour).In(pacific)},
+		{ID: "cccccccc", Title: "100% coverage", Author: "Someone_Else", URL: "https://example.com/coverage", Note: "", Status: text.StatusQueued, Timestamp: base.Add(2 * time.Hour)},
+		{ID: "dddddddd", Title: "Blog post", Author: "Rob Pike", URL: "https://blog.example.com/post", Note: "A note", Status: text.StatusRead, Tags: []string{"go", "blogs"}, Timestamp: base.Add(-time.Hour)},
+	}
+}
+
+// queryCases and the IDs they should return, in order.
+var queryCases = []struct {
+	name  string
+	query Query
+	ids   []string
+}{
+	{"all", Query{}, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb", "cccccccc"}},
+	{"descending", Query{Direction: text.Descending}, []string{"cccccccc", "bbbbbbbb", "aaaaaaaa", "dddddddd"}},
+	{"author", Query{Author: "rob pike"}, []string{"dddddddd", "bbbbbbbb"}},
+	{"url", Query{URL: "GITHUB.io"}, []string{"aaaaaaaa", "bbbbbbbb"}},
+	{"domain", Query{Domain: "example.com"}, []string{"dddddddd", "cccccccc"}},
+	{"domain excludes partial labels", Query{Domain: "ample.com"}, []string{}},
+	{"since", Query{Since: time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC)}, []string{"aaaaaaaa", "bbbbbbbb", "cccccccc"}},
+	{"until", Query{Until: time.Date(2023, 4, 7, 13, 0, 0, 0, time.UTC)}, []string{"dddddddd", "aaaaaaaa"}},
+	{"match", Query{Match: "CLEVER"}, []string{"bbbbbbbb"}},
+	{"match escapes wildcards", Query{Match: "100%"}, []string{"cccccccc"}},
+	{"match escapes underscores", Query{Match: "e_e"}, []string{"cccccccc"}},
+	{"tag", Query{Tag: "go"}, []string{"dddddddd", "bbbbbbbb"}},
+	{"status", Query{Statuses: []text.Status{text.StatusRead}}, []string{"dddddddd", "aaaaaaaa", "bbbbbbbb"}},
+	{"ids", Query{IDs: []string{"cccccccc", "aaaaaaaa", "missing0"}}, []string{"aaaaaaaa", "cccccccc"}},
+	{"sort by title", Query{Sort: SortTitle}, []string{"cccccccc", "dddddddd", "bbbbbbbb", "aaaaaaaa"}},
+	{"sort by author breaks ties by ID", Query{Sort: SortAuthor, Direction: text.Descending}, []string{"cccccccc", "dddddddd", "bbbbbbbb", "aaaaaaaa"}},
+	{"limit", Query{Limit: 2}, []string{"dddddddd", "aaaaaaaa"}},
+	{"offset", Query{Offset: 3}, []string{"cccccccc"}},
+	{"limit and offset", Query{Limit: 1, Offset: 1}, []string{"aaaaaaaa"}},
+	{"offset past end", Query{Offset: 10}, []string{}},
+}
+
+func ids(texts []*text.Text) []string {
+	ids := make([]string, len(texts))
+	for i, t := range texts {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+func TestQuery(t *testing.T) {
+	stores := map[string]Interface{
+		"memory": UseMemory(queryFixtures()...),
+		"sql":    startLocalLibSQL(t),
+		"bolt":   startBolt(t),
+	}
+	for _, fixture := range queryFixtures() {
+		for _, name := range []string{"sql", "bolt"} {
+			_, err := stores[name].Upsert(t.Context(), fixture)
+			require.NoError(t, err)
+		}
+	}
+
+	for name, s := range stores {
+		for _, c := range queryCases {
+			t.Run(name+"/"+c.name, func(t *testing.T) {
+				texts, err := s.List(t.Context(), c.query)
+				assert.NoError(t, err)
+				assert.Equal(t, c.ids, ids(texts))
+			})
+		}
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestQueryFoldsCase(t *testing.T) {
+	fixture := &text.Text{ID: "aaaaaaaa", Title: "Ça ira", Author: "Émile Zola", URL: "https://ÉCOLE.fr/Œuvres", Note: "n", Tags: []string{"Français"}, Timestamp: time.Now()}
+	stores := map[string]Interface{
+		"memory": UseMemory(fixture),
+		"sql":    startLocalLibSQL(t),
+		"bolt":   startBolt(t),
+	}
+	for _, name := range []string{"sql", "bolt"} {
+		_, err := stores[name].Upsert(t.Context(), fixture)
+		require.NoError(t, err)
+	}
+
+	for name, s := range stores {
+		for _, q := range []Query{
+			{Author: "émile"},
+			{URL: "œuvres"},
+			{Domain: "école.fr"},
+			{Match: "ÇA"},
+			{Tag: "FRANÇAIS"},
+		} {
+			texts, err := s.List(t.Context(), q)
+			assert.NoError(t, err)
+			assert.Len(t, texts, 1, "%v: %+v folds non-ASCII letters", name, q)
+		}
+		assert.NoError(t, s.Close())
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	assert.NoError(t, Query{}.Validate())
+	assert.Error(t, Query{Sort: "note"}.Validate())
+	assert.Error(t, Query{Statuses: []text.Status{""}}.Validate())
+	assert.Error(t, Query{Limit: -1}.Validate())
+}
+
+func TestQueryValues(t *testing.T) {
+	q := Query{
+		Author:    "Rob",
+		Since:     time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC),
+		Tag:       "go",
+		Statuses:  []text.Status{text.StatusQueued, text.StatusReading},
+		IDs:       []string{"aaaaaaaa", "bbbbbbbb"},
+		Sort:      SortTitle,
+		Direction: text.Descending,
+		Limit:     10,
+	}
+	parsed, err := ParseQuery(q.Values(), Query{Statuses: []text.Status{text.StatusRead}})
+	assert.NoError(t, err)
+	assert.Equal(t, q, parsed)
+
+	parsed, err = ParseQuery(Query{}.Values(), Query{Statuses: []text.Status{text.StatusRead}, Direction: text.Descending})
+	assert.NoError(t, err)
+	assert.Empty(t, parsed.Statuses, "zero Query matches all statuses")
+	assert.Equal(t, text.Ascending, parsed.Direction, "explicit direction overrides default")
+
+	defaults := Query{Statuses: []text.Status{text.StatusRead}, Direction: text.Descending}
+	parsed, err = ParseQuery(url.Values{"status": {"queued,reading"}, "since": {"2023-04-07"}}, defaults)
+	assert.NoError(t, err)
+	assert.Equal(t, []text.Status{text.StatusQueued, text.StatusReading}, parsed.Statuses)
+	assert.Equal(t, text.Descending, parsed.Direction)
+	assert.Equal(t, 7, parsed.Since.Day())
+
+	parsed, err = ParseQuery(url.Values{"id": {"aaaaaaaa,bbbbbbbb", "cccccccc"}}, Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aaaaaaaa", "bbbbbbbb", "cccccccc"}, parsed.IDs)
+
+	_, err = ParseQuery(url.Values{"limit": {"many"}}, Query{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Factory opens a store from its configuration, C. See [Register].
+type Factory[C any] func(config C) (Interface, error)
+
+// Registration is a store type added with [Register].
+type Registration struct {
+	// Name of the store type, e.g. "file".
+	Name string
+	// Config is the type of the store type's configuration: a struct.
+	Config reflect.Type
+	open   func(config any) (Interface, error)
+}
+
+// Open a store of r's type with config, a value of type r.Config.
+func (r Registration) Open(config any) (Interface, error) { return r.open(config) }
+
+var registry struct {
+	sync.RWMutex
+	types []Registration
+}
+
+// Register a store type, name, opened by factory. Call Register from an init
+// function, like [database/sql.Register]; it panics if name is registered
+// already, or if C isn't a struct.
+//
+// [github.com/lukasschwab/tiir/pkg/config] configures stores of the type from
+// the store block of a config file whose store.type is name. Each exported
+// field of C is read from the key in its json tag, or from the environment
+// variable in its env tag (by default, TIR_STORE_ and the uppercased key), and
+// may be a string, bool, or number. Two more tags describe fields:
+//
+//   - mask:"secret" masks the field in tir config's output; mask:"url" masks
+//     only passwords and tokens in the URL it holds.
+//   - spec:"path" or spec:"location" marks the field a store URI, like
+//     "file:///home/me/tir.json", sets: a filesystem path or another location.
+//     The URI's query parameters set other fields by key.
+//     spec:"inherit" marks fields that other stores named by URI, e.g. by tir
+//     copy, take from the configuration, e.g. credentials. The secret_env
+//     parameter names an environment variable to read mask:"secret" fields
+//     from.
+func Register[C any](name string, factory Factory[C]) {
+	config := reflect.TypeFor[C]()
+	if config.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("store: %v store's config %v isn't a struct", name, config))
+	} else if name == "" || strings.Contains(name, ":") {
+		panic(fmt.Sprintf("store: invalid store type name %q", name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if slices.ContainsFunc(registry.types, func(r Registration) bool { return r.Name == name }) {
+		panic(fmt.Sprintf("store: %v store is registered twice", name))
+	}
+	registry.types = append(registry.types, Registration{
+		Name:   name,
+		Config: config,
+		open:   func(config any) (Interface, error) { return factory(config.(C)) },
+	})
+}
+
+// Registered store types, in the order they were registered.
+func Registered() []Registration {
+	registry.RLock()
+	defer registry.RUnlock()
+	return slices.Clone(registry.types)
+}
+
+// Lookup the registered store type called name.
+func Lookup(name string) (Registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	i := slices.IndexFunc(registry.types, func(r Registration) bool { return r.Name == name })
+	if i < 0 {
+		return Registration{}, false
+	}
+	return registry.types[i], true
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	type config struct {
+		Name string `json:"name"`
+	}
+	var opened []config
+	Register("registry_test", func(c config) (Interface, error) {
+		opened = append(opened, c)
+		return UseMemory(), nil
+	})
+
+	r, ok := Lookup("registry_test")
+	require.True(t, ok)
+	s, err := r.Open(config{Name: "n"})
+	require.NoError(t, err)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []config{{Name: "n"}}, opened)
+	assert.Equal(t, "registry_test", Registered()[len(Registered())-1].Name)
+
+	assert.Panics(t, func() { Register("registry_test", func(config) (Interface, error) { return nil, nil }) })
+	assert.Panics(t, func() { Register("a:b", func(config) (Interface, error) { return nil, nil }) })
+	assert.Panics(t, func() { Register("string", func(string) (Interface, error) { return nil, nil }) })
+	_, ok = Lookup("unregistered")
+	assert.False(t, ok)
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/search"
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resultIDs(results []search.Result) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.Text.ID
+	}
+	return ids
+}
+
+func TestSearchConsistentAcrossStores(t *testing.T) {
+	sqlStore := startLocalLibSQL(t)
+	// Written before updates, to check the index tracks them.
+	for _, fixture := range queryFixtures() {
+		fixture.Note = "stale"
+		_, err := sqlStore.Upsert(t.Context(), fixture)
+		require.NoError(t, err)
+	}
+	for _, fixture := range queryFixtures() {
+		_, err := sqlStore.Upsert(t.Context(), fixture)
+		require.NoError(t, err)
+	}
+	_, err := sqlStore.Upsert(t.Context(), randomText(t))
+	require.NoError(t, err)
+	memory := UseMemory(append(queryFixtures(), randomText(t))...)
+
+	for _, query := range []string{"rob", "pike blog", "clever", "GO", "stale", "100%", ""} {
+		expected, err := memory.Search(t.Context(), query, 0)
+		require.NoError(t, err)
+		actual, err := sqlStore.Search(t.Context(), query, 0)
+		require.NoError(t, err)
+
+		assert.Equal(t, resultIDs(expected), resultIDs(actual), query)
+		for i := range expected {
+			assert.InDelta(t, expected[i].Score, actual[i].Score, 1e-9, query)
+			assert.Equal(t, expected[i].Snippet, actual[i].Snippet, query)
+		}
+	}
+
+	results, err := memory.Search(t.Context(), "rob", 1)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	deleted, err := sqlStore.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	results, err = sqlStore.Search(t.Context(), "proverbs", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, results, "deleted texts aren't searchable: %v", deleted.Title)
+}
+
+func TestSearchFoldsDiacritics(t *testing.T) {
+	cafe := &text.Text{ID: "aaaaaaaa", Title: "Café society", Author: "Zoë", URL: "https://example.com", Note: "n", Timestamp: time.Now()}
+	file, err := UseFile(filepath.Join(t.TempDir(), "tir.json"))
+	require.NoError(t, err)
+	stores := map[string]Interface{
+		"memory": UseMemory(),
+		"file":   file,
+		"sql":    startLocalLibSQL(t),
+		"bolt":   startBolt(t),
+	}
+	for name, s := range stores {
+		_, err := s.Upsert(t.Context(), cafe)
+		require.NoError(t, err)
+		for _, query := range []string{"cafe", "CAFÉ", "zoe"} {
+			results, err := s.Search(t.Context(), query, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"aaaaaaaa"}, resultIDs(results), "%v: %v", name, query)
+		}
+		assert.NoError(t, s.Close())
+	}
+}
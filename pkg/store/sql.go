@@ -3,10 +3,14 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/text"
 
 	_ "github.com/libsql/libsql-client-go/libsql"
@@ -22,44 +26,91 @@ const (
 // SQL statements to prepare. NOTE: return field order may be signficant; keep
 // in sync with scanText.
 const (
-	initTableQuery = `
-	CREATE TABLE IF NOT EXISTS texts (
-		id varchar(8) NOT NULL UNIQUE,
-		title text NOT NULL,
-		url text NOT NULL,
-		author text NOT NULL,
-		note text NOT NULL,
-		timestamp DATETIME NOT NULL
-	);
-	`
 	deleteQuery = `
 	DELETE
 	FROM texts WHERE id = :id
-	RETURNING id, title, url, author, note, timestamp;
+	RETURNING id, title, url, author, note, timestamp, tags, status, updated;
 	`
 	readQuery = `
-	SELECT id, title, url, author, note, timestamp
+	SELECT id, title, url, author, note, timestamp, tags, status, updated
 	FROM texts WHERE id = :id;
 	`
+	// upsertQuery updates conflicting rows in place rather than replacing them,
+	// so the update trigger keeps texts_fts in sync.
 	upsertQuery = `
-	REPLACE INTO texts (id, title, url, author, note, timestamp) 
-	VALUES (:id, :title, :url, :author, :note, :timestamp) 
-	RETURNING id, title, url, author, note, timestamp;
+	INSERT INTO texts (id, title, url, author, note, timestamp, tags, status, unix_micros, updated, folded)
+	VALUES (:id, :title, :url, :author, :note, :timestamp, :tags, :status, :unix_micros, :updated, :folded)
+	ON CONFLICT (id) DO UPDATE SET
+		title = excluded.title,
+		url = excluded.url,
+		author = excluded.author,
+		note = excluded.note,
+		timestamp = excluded.timestamp,
+		tags = excluded.tags,
+		status = excluded.status,
+		unix_micros = excluded.unix_micros,
+		updated = excluded.updated,
+		folded = excluded.folded
+	RETURNING id, title, url, author, note, timestamp, tags, status, updated;
+	`
+	// searchQuery ranks texts matching the FTS5 query :query. bm25 scores are
+	// negative: lower is more relevant.
+	searchQuery = `
+	SELECT texts.id, texts.title, texts.url, texts.author, texts.note, texts.timestamp, texts.tags, texts.status, texts.updated, -bm25(texts_fts)
+	FROM texts_fts JOIN texts ON texts.rowid = texts_fts.rowid
+	WHERE texts_fts MATCH :query
+	ORDER BY bm25(texts_fts), texts.id
+	LIMIT :limit;
 	`
+	// truncateQuery deletes every text.
+	truncateQuery = `
+	DELETE FROM texts;
+	`
+	// listQuery is completed by compileQuery.
 	listQuery = `
-	SELECT id, title, url, author, note, timestamp FROM texts;
+	SELECT id, title, url, author, note, timestamp, tags, status, updated FROM texts
+	`
+	// backfillQueries set unix_micros for rows written before it existed; see
+	// migrations/0004_add_unix_micros.sql.
+	backfillSelectQuery = `
+	SELECT id, timestamp FROM texts WHERE unix_micros = 0;
+	`
+	backfillUpdateQuery = `
+	UPDATE texts SET unix_micros = :unix_micros WHERE id = :id;
+	`
+	// backfillFoldedQueries set folded for rows written before it existed; see
+	// migrations/0008_add_folded.sql.
+	backfillFoldedSelectQuery = `
+	SELECT id, title, url, author, note, tags FROM texts WHERE folded = '';
+	`
+	backfillFoldedUpdateQuery = `
+	UPDATE texts SET folded = :folded WHERE id = :id;
 	`
 )
 
+// UseLibSQL opens the libSQL database at connectionString, applying pending
+// schema migrations; see [SQL.Migrate].
 func UseLibSQL(connectionString string) (Interface, error) {
-	return useLibSQL(connectionString)
+	return useLibSQL(connectionString, true)
+}
+
+// UseLibSQLWithoutMigrating opens the libSQL database at connectionString like
+// [UseLibSQL], but doesn't apply pending schema migrations. If its schema is too
+// old to use, every operation but [SQL.Migrations] and [SQL.Migrate] fails.
+func UseLibSQLWithoutMigrating(connectionString string) (Interface, error) {
+	return useLibSQL(connectionString, false)
 }
 
-func useLibSQL(connectionString string) (*SQL, error) {
+func useLibSQL(connectionString string, migrate bool) (*SQL, error) {
 	db, err := sql.Open("libsql", connectionString)
 	if err != nil {
 		return nil, fmt.Errorf("error opening DB connection: %w", err)
 	}
+	if strings.HasPrefix(connectionString, "file:") {
+		// SQLite fails concurrent writes to a local file with SQLITE_BUSY
+		// rather than waiting; serialize them on a single connection.
+		db.SetMaxOpenConns(1)
+	}
 	s := &SQL{
 		DB:               db,
 		pingTimeout:      defaultPingTimeout,
@@ -67,21 +118,24 @@ func useLibSQL(connectionString string) (*SQL, error) {
 	}
 	if err := s.ping(); err != nil {
 		return nil, err
-	} else if err := s.prepare(); err != nil {
+	} else if err := s.open(migrate); err != nil {
+		s.Close()
 		return nil, err
 	}
 	return s, nil
 }
 
-// SQL implements [Interface] for libSQL; see [UseSql].
+// SQL implements [Interface] and [Migrator] for libSQL; see [UseLibSQL].
 type SQL struct {
 	*sql.DB
 
 	upsert *sql.Stmt
 	read   *sql.Stmt
-	list   *sql.Stmt
 	delete *sql.Stmt
 
+	// outdated, if set, is why the schema is too old to use.
+	outdated error
+
 	pingTimeout      time.Duration
 	operationTimeout time.Duration
 }
@@ -97,21 +151,43 @@ func (s *SQL) ping() error {
 	return nil
 }
 
-func (s *SQL) prepare() error {
-	ctx, cancel := s.operationContext()
-	defer cancel()
+// open the database: apply pending migrations, if migrate is set, then
+// prepare statements if the schema is recent enough to use.
+//
+// Opening a database with an up-to-date schema doesn't write to it, so
+// read-only access suffices. If migrating fails, e.g. because access is
+// read-only, a schema that's recent enough to use is used as is.
+func (s *SQL) open(migrate bool) error {
+	ctx, cancel := s.operationContext(context.Background())
+	version, err := s.schemaVersion(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
 
-	var err error
-	if _, err = s.ExecContext(ctx, initTableQuery); err != nil {
-		log.Printf("[WARN] table initialization failed; might have read-only access")
+	if latest := len(migrations); migrate && version < latest {
+		if err := s.migrate(context.Background(), version, latest); err == nil {
+			version = latest
+		} else if version < minimumSchemaVersion {
+			return err
+		} else {
+			log.Printf("[WARN] %v; might have read-only access", err)
+		}
+	}
+	if version < minimumSchemaVersion {
+		s.outdated = fmt.Errorf("database schema is at version %d, but tir requires version %d; run tir db migrate", version, minimumSchemaVersion)
+		log.Printf("[WARN] %v", s.outdated)
+		return nil
 	}
+	return s.prepare()
+}
 
+func (s *SQL) prepare() error {
+	var err error
 	if s.upsert, err = s.Prepare(upsertQuery); err != nil {
 		return fmt.Errorf("erorr preparing upsert: %w", err)
 	} else if s.read, err = s.Prepare(readQuery); err != nil {
 		return fmt.Errorf("error preparing read: %w", err)
-	} else if s.list, err = s.Prepare(listQuery); err != nil {
-		return fmt.Errorf("erorr preparing list: %w", err)
 	} else if s.delete, err = s.Prepare(deleteQuery); err != nil {
 		return fmt.Errorf("error preparing delete: %w", err)
 	}
@@ -119,37 +195,114 @@ func (s *SQL) prepare() error {
 	return nil
 }
 
-func (s *SQL) operationContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), s.operationTimeout)
+// backfillUnixMicros derives unix_micros from timestamp. SQLite can't do it
+// alone: the driver writes timestamps in formats its date functions don't
+// parse, so we parse them in Go.
+func backfillUnixMicros(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, backfillSelectQuery)
+	if err != nil {
+		return err
+	}
+	timestamps := map[string]time.Time{}
+	for rows.Next() {
+		var id string
+		var timestamp time.Time
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			rows.Close()
+			return err
+		}
+		timestamps[id] = timestamp
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for id, timestamp := range timestamps {
+		if _, err := tx.ExecContext(ctx, backfillUpdateQuery, sql.Named("id", id), sql.Named("unix_micros", timestamp.UnixMicro())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillFolded derives folded from the columns it copies, folding case in Go;
+// see foldText.
+func backfillFolded(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, backfillFoldedSelectQuery)
+	if err != nil {
+		return err
+	}
+	var texts []*text.Text
+	for rows.Next() {
+		var t text.Text
+		var tags string
+		if err := rows.Scan(&t.ID, &t.Title, &t.URL, &t.Author, &t.Note, &tags); err != nil {
+			rows.Close()
+			return err
+		} else if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+			rows.Close()
+			return fmt.Errorf("error parsing tags: %w", err)
+		}
+		texts = append(texts, &t)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, t := range texts {
+		folded, err := foldText(t)
+		if err != nil {
+			return err
+		} else if _, err := tx.ExecContext(ctx, backfillFoldedUpdateQuery, sql.Named("id", t.ID), sql.Named("folded", folded)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// operationContext bounds an operation on behalf of ctx by the store's
+// operation timeout.
+func (s *SQL) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.operationTimeout)
 }
 
 // Delete implements [Interface].
-func (s *SQL) Delete(id string) (*text.Text, error) {
-	ctx, cancel := s.operationContext()
+func (s *SQL) Delete(ctx context.Context, id string) (*text.Text, error) {
+	if s.outdated != nil {
+		return nil, s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
 	defer cancel()
 
 	t, err := scan(s.delete.QueryRowContext(ctx, sql.Named("id", id)))
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	} else if err != nil {
 		return nil, fmt.Errorf("error deleting row: %w", err)
 	}
 
 	return t, nil
 }
 
-// List implements [Interface].
-func (s *SQL) List(c text.Comparator, d text.Direction) ([]*text.Text, error) {
-	ctx, cancel := s.operationContext()
+// List implements [Interface]. It compiles q to SQL; see compileQuery.
+func (s *SQL) List(ctx context.Context, q Query) ([]*text.Text, error) {
+	if s.outdated != nil {
+		return nil, s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
 	defer cancel()
 
-	// NOTE: ideally c, d are expressible in query (ORDER BY) but that only
-	// works for *some* comparators.
-	rows, err := s.list.QueryContext(ctx)
+	clauses, args, err := compileQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.QueryContext(ctx, listQuery+clauses, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error reading rows: %w", err)
 	}
 	defer rows.Close()
 
-	var texts []*text.Text
+	texts := []*text.Text{}
 	for rows.Next() {
 		t, err := scan(rows)
 		if err != nil {
@@ -157,18 +310,61 @@ func (s *SQL) List(c text.Comparator, d text.Direction) ([]*text.Text, error) {
 		}
 		texts = append(texts, t)
 	}
+	return texts, rows.Err()
+}
+
+// Search implements [Interface] with SQLite's FTS5 extension.
+func (s *SQL) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	if s.outdated != nil {
+		return nil, s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
+	defer cancel()
+
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return []search.Result{}, nil
+	}
+	// Quote each term, so FTS5 doesn't interpret query syntax. Terms are
+	// letters and digits, so they can't contain quotes.
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.QueryContext(ctx, searchQuery, sql.Named("query", strings.Join(quoted, " ")), sql.Named("limit", limit))
+	if err != nil {
+		return nil, fmt.Errorf("error searching rows: %w", err)
+	}
+	defer rows.Close()
 
-	text.Sort(texts).By(c, d)
-	return texts, nil
+	results := []search.Result{}
+	for rows.Next() {
+		var score float64
+		t, err := scan(rows, &score)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, search.Result{Text: t, Score: score, Snippet: search.Highlight(t, query)})
+	}
+	return results, rows.Err()
 }
 
 // Read implements [Interface].
-func (s *SQL) Read(id string) (*text.Text, error) {
-	ctx, cancel := s.operationContext()
+func (s *SQL) Read(ctx context.Context, id string) (*text.Text, error) {
+	if s.outdated != nil {
+		return nil, s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
 	defer cancel()
 
 	t, err := scan(s.read.QueryRowContext(ctx, sql.Named("id", id)))
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+	} else if err != nil {
 		return nil, fmt.Errorf("error loading row: %w", err)
 	}
 
@@ -176,11 +372,18 @@ func (s *SQL) Read(id string) (*text.Text, error) {
 }
 
 // Upsert implements [Interface].
-func (s *SQL) Upsert(t *text.Text) (*text.Text, error) {
-	ctx, cancel := s.operationContext()
+func (s *SQL) Upsert(ctx context.Context, t *text.Text) (*text.Text, error) {
+	if s.outdated != nil {
+		return nil, s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
 	defer cancel()
 
-	result, err := scan(s.upsert.QueryRowContext(ctx, asNamedArgs(t)...))
+	args, err := asNamedArgs(t)
+	if err != nil {
+		return nil, err
+	}
+	result, err := scan(s.upsert.QueryRowContext(ctx, args...))
 	if err != nil {
 		return nil, fmt.Errorf("error upserting text: %w", err)
 	}
@@ -188,27 +391,192 @@ func (s *SQL) Upsert(t *text.Text) (*text.Text, error) {
 	return result, nil
 }
 
+// UpsertMany implements [Interface] in a single transaction.
+func (s *SQL) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	results := make([]*text.Text, len(texts))
+	err := s.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		upsert := tx.StmtContext(ctx, s.upsert)
+		for i, t := range texts {
+			args, err := asNamedArgs(t)
+			if err != nil {
+				return err
+			} else if results[i], err = scan(upsert.QueryRowContext(ctx, args...)); err != nil {
+				return fmt.Errorf("error upserting text: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteMany implements [Interface] in a single transaction.
+func (s *SQL) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	results := make([]*text.Text, len(ids))
+	err := s.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		del := tx.StmtContext(ctx, s.delete)
+		for i, id := range ids {
+			var err error
+			results[i], err = scan(del.QueryRowContext(ctx, sql.Named("id", id)))
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: no text with ID '%v'", ErrNotFound, id)
+			} else if err != nil {
+				return fmt.Errorf("error deleting row: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// transact runs operation in a transaction with the operation timeout,
+// committing if it succeeds and rolling back if it fails.
+func (s *SQL) transact(ctx context.Context, operation func(ctx context.Context, tx *sql.Tx) error) error {
+	if s.outdated != nil {
+		return s.outdated
+	}
+	ctx, cancel := s.operationContext(ctx)
+	defer cancel()
+
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := operation(ctx, tx); err != nil {
+		return err
+	} else if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// replace implements replacer in a single transaction.
+func (s *SQL) replace(ctx context.Context, texts []*text.Text) error {
+	return s.transact(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, truncateQuery); err != nil {
+			return fmt.Errorf("error deleting texts: %w", err)
+		}
+		upsert := tx.StmtContext(ctx, s.upsert)
+		for _, t := range texts {
+			args, err := asNamedArgs(t)
+			if err != nil {
+				return err
+			} else if _, err := scan(upsert.QueryRowContext(ctx, args...)); err != nil {
+				return fmt.Errorf("error upserting text: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
 // scannable describes sql.Row and sql.Rows.
 type scannable interface {
 	Scan(dest ...any) error
 }
 
-// NOTE: scan may need to correspond to field order in prepared queries.
-func scan(headRow scannable) (*text.Text, error) {
+// NOTE: scan may need to correspond to field order in prepared queries. Any
+// extra destinations scan columns following the text's.
+func scan(headRow scannable, extra ...any) (*text.Text, error) {
 	var t text.Text
-	if err := headRow.Scan(&t.ID, &t.Title, &t.URL, &t.Author, &t.Note, &t.Timestamp); err != nil {
+	var tags, updated string
+	destinations := append([]any{&t.ID, &t.Title, &t.URL, &t.Author, &t.Note, &t.Timestamp, &tags, &t.Status, &updated}, extra...)
+	if err := headRow.Scan(destinations...); err != nil {
 		return nil, fmt.Errorf("error scanning text: %w", err)
+	} else if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+		return nil, fmt.Errorf("error parsing tags: %w", err)
+	} else if updated == "" {
+		// Not tracked when the text was written.
+	} else if t.Updated, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return nil, fmt.Errorf("error parsing update time: %w", err)
+	}
+	if len(t.Tags) == 0 {
+		// Normalize to the zero value, matching texts that were never tagged.
+		t.Tags = nil
 	}
 	return &t, nil
 }
 
-func asNamedArgs(t *text.Text) []any {
+func asNamedArgs(t *text.Text) ([]any, error) {
+	tags := t.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	marshaledTags, err := json.Marshal(tags)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding tags: %w", err)
+	}
+	folded, err := foldText(t)
+	if err != nil {
+		return nil, err
+	}
 	return []any{
 		sql.Named("id", t.ID),
 		sql.Named("title", t.Title),
 		sql.Named("url", t.URL),
 		sql.Named("author", t.Author),
 		sql.Named("note", t.Note),
-		sql.Named("timestamp", t.Timestamp),
+		sql.Named("timestamp", normalizeTime(t.Timestamp)),
+		sql.Named("tags", string(marshaledTags)),
+		sql.Named("status", string(t.Status)),
+		sql.Named("unix_micros", t.Timestamp.UnixMicro()),
+		sql.Named("updated", formatUpdated(t.Updated)),
+		sql.Named("folded", folded),
+	}, nil
+}
+
+// foldedText holds the fields of a text that [Query]'s string filters match,
+// folded to lower case, as JSON in the folded column. SQLite's LIKE and lower
+// fold only ASCII letters, so filters match folded fields instead, folding
+// queries the same way in Go. Keep in sync with [Query.Matches].
+type foldedText struct {
+	Title  string   `json:"title"`
+	URL    string   `json:"url"`
+	Author string   `json:"author"`
+	Note   string   `json:"note"`
+	Tags   []string `json:"tags"`
+}
+
+// foldText for the folded column.
+func foldText(t *text.Text) (string, error) {
+	folded := foldedText{
+		Title:  strings.ToLower(t.Title),
+		URL:    strings.ToLower(t.URL),
+		Author: strings.ToLower(t.Author),
+		Note:   strings.ToLower(t.Note),
+		Tags:   make([]string, len(t.Tags)),
+	}
+	for i, tag := range t.Tags {
+		folded.Tags[i] = strings.ToLower(tag)
+	}
+	marshaled, err := json.Marshal(folded)
+	if err != nil {
+		return "", fmt.Errorf("error encoding folded text: %w", err)
+	}
+	return string(marshaled), nil
+}
+
+// normalizeTime converts timestamps in unnamed time zones, e.g. from parsing
+// "2023-04-07T12:00:00-07:00", to UTC: the libSQL driver writes them in a
+// format it can't read back. See
+// https://github.com/libsql/libsql-client-go/issues/79.
+func normalizeTime(t time.Time) time.Time {
+	if name, _ := t.Zone(); name == "" {
+		return t.UTC()
+	}
+	return t
+}
+
+// formatUpdated for the updated column, which is empty for untracked updates.
+// It's text, rather than a DATETIME like timestamp, so it round-trips exactly.
+func formatUpdated(updated time.Time) string {
+	if updated.IsZero() {
+		return ""
 	}
+	return updated.Format(time.RFC3339Nano)
 }
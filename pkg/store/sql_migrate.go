@@ -0,0 +1,269 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles are the SQL store's schema migrations, named like
+// "0002_add_tags.sql". Each is applied at most once, in order, and recorded in
+// schema_migrations. Never edit a released migration: add another.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationHooks finish migrations, by version, in Go.
+var migrationHooks = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	4: backfillUnixMicros,
+	8: backfillFolded,
+}
+
+// migrations are the parsed migrationFiles; migrations[i] has version i+1.
+var migrations = mustLoadMigrations()
+
+// minimumSchemaVersion is the oldest schema version SQL can use: the version
+// that created every column and table its queries use. Later migrations, e.g.
+// adding indexes, are optional.
+const minimumSchemaVersion = 8
+
+// SQL statements for migrations.
+const (
+	// tableQuery counts tables named :name.
+	tableQuery = `
+	SELECT COUNT(*) FROM sqlite_master WHERE name = :name;
+	`
+	// columnQuery counts columns named :name in texts.
+	columnQuery = `
+	SELECT COUNT(*) FROM pragma_table_info('texts') WHERE name = :name;
+	`
+	initMigrationsQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name text NOT NULL,
+		applied text NOT NULL
+	);
+	`
+	listMigrationsQuery = `
+	SELECT version, applied FROM schema_migrations ORDER BY version;
+	`
+	recordMigrationQuery = `
+	INSERT OR IGNORE INTO schema_migrations (version, name, applied)
+	VALUES (:version, :name, :applied);
+	`
+)
+
+// migration is a parsed migration file.
+type migration struct {
+	version    int
+	name, body string
+}
+
+func mustLoadMigrations() []migration {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	result := make([]migration, 0, len(entries))
+	for i, entry := range entries {
+		prefix, name, _ := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if version, err := strconv.Atoi(prefix); err != nil || version != i+1 {
+			panic(fmt.Sprintf("migration %v is out of sequence", entry.Name()))
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, migration{version: i + 1, name: name, body: string(body)})
+	}
+	return result
+}
+
+// legacyFeatures are the tables and columns created by each migration, in
+// order, for inferring the versions of databases created before
+// schema_migrations; see legacyVersion.
+var legacyFeatures = []struct {
+	version     int
+	query, name string
+}{
+	{1, tableQuery, "texts"},
+	{2, columnQuery, "tags"},
+	{3, columnQuery, "status"},
+	{4, columnQuery, "unix_micros"},
+	{5, tableQuery, "texts_fts"},
+	{6, columnQuery, "updated"},
+}
+
+// count the rows matched by a COUNT query.
+func (s *SQL) count(ctx context.Context, query string, args ...any) (int, error) {
+	var count int
+	err := s.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// schemaVersion is the version of the database's schema: the number of
+// migrations applied to it.
+func (s *SQL) schemaVersion(ctx context.Context) (int, error) {
+	applied, _, err := s.migrationTimes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for version < len(migrations) && applied[version+1] {
+		version++
+	}
+	return version, nil
+}
+
+// migrationTimes returns the versions of migrations applied to the database,
+// and when they were applied, if schema_migrations recorded it.
+func (s *SQL) migrationTimes(ctx context.Context) (map[int]bool, map[int]time.Time, error) {
+	applied, times := map[int]bool{}, map[int]time.Time{}
+	if count, err := s.count(ctx, tableQuery, sql.Named("name", "schema_migrations")); err != nil {
+		return nil, nil, fmt.Errorf("error checking for schema_migrations: %w", err)
+	} else if count == 0 {
+		legacy, err := s.legacyVersion(ctx)
+		for version := 1; version <= legacy; version++ {
+			applied[version] = true
+		}
+		return applied, times, err
+	}
+
+	rows, err := s.QueryContext(ctx, listMigrationsQuery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, nil, fmt.Errorf("error reading schema_migrations: %w", err)
+		}
+		applied[version] = true
+		if parsed, err := time.Parse(time.RFC3339, at); err == nil {
+			times[version] = parsed
+		}
+	}
+	return applied, times, rows.Err()
+}
+
+// legacyVersion infers the schema version of a database without
+// schema_migrations from its tables and columns. Before migrations, SQL
+// created them in the same order.
+func (s *SQL) legacyVersion(ctx context.Context) (int, error) {
+	version := 0
+	for _, feature := range legacyFeatures {
+		count, err := s.count(ctx, feature.query, sql.Named("name", feature.name))
+		if err != nil {
+			return 0, fmt.Errorf("error inferring schema version: %w", err)
+		} else if count == 0 {
+			break
+		}
+		version = feature.version
+	}
+	return version, nil
+}
+
+// migrate the schema from version from to version to, applying each migration
+// in its own transaction.
+func (s *SQL) migrate(ctx context.Context, from, to int) error {
+	for _, m := range migrations[from:to] {
+		if err := s.apply(ctx, m, from); err != nil {
+			return fmt.Errorf("error migrating schema to version %d (%v): %w", m.version, m.name, err)
+		}
+		log.Printf("Migrated schema to version %d (%v)", m.version, m.name)
+	}
+	return nil
+}
+
+// apply m in a transaction, recording it in schema_migrations. Also records
+// migrations up to baseline, which were applied before schema_migrations
+// existed.
+func (s *SQL) apply(ctx context.Context, m migration, baseline int) error {
+	ctx, cancel := s.operationContext(ctx)
+	defer cancel()
+
+	tx, err := s.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, initMigrationsQuery); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	for _, applied := range append(migrations[:baseline:baseline], m) {
+		args := []any{sql.Named("version", applied.version), sql.Named("name", applied.name), sql.Named("applied", "")}
+		if applied.version == m.version {
+			args[2] = sql.Named("applied", time.Now().UTC().Format(time.RFC3339))
+		}
+		if _, err := tx.ExecContext(ctx, recordMigrationQuery, args...); err != nil {
+			return fmt.Errorf("error recording migration: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, m.body); err != nil {
+		return err
+	} else if hook := migrationHooks[m.version]; hook == nil {
+		// Nothing to do in Go.
+	} else if err := hook(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// Migrations implements [Migrator].
+func (s *SQL) Migrations(ctx context.Context) ([]Migration, error) {
+	ctx, cancel := s.operationContext(ctx)
+	defer cancel()
+
+	applied, times, err := s.migrationTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		result[i] = Migration{Version: m.version, Name: m.name, Applied: applied[m.version], AppliedAt: times[m.version]}
+	}
+	return result, nil
+}
+
+// Migrate implements [Migrator]. It applies each migration in its own
+// transaction, so if one fails, the schema is left at the previous version.
+func (s *SQL) Migrate(ctx context.Context, to int) error {
+	if to == 0 {
+		to = len(migrations)
+	} else if to < 0 || to > len(migrations) {
+		return fmt.Errorf("no schema version %d; the latest is %d", to, len(migrations))
+	}
+	version, err := func() (int, error) {
+		ctx, cancel := s.operationContext(ctx)
+		defer cancel()
+		return s.schemaVersion(ctx)
+	}()
+	if err != nil {
+		return err
+	} else if to < version {
+		return fmt.Errorf("can't migrate schema down from version %d to %d", version, to)
+	} else if err := s.migrate(ctx, version, to); err != nil {
+		return err
+	}
+
+	if to >= minimumSchemaVersion && s.outdated != nil {
+		if err := s.prepare(); err != nil {
+			return err
+		}
+		s.outdated = nil
+	}
+	return nil
+}
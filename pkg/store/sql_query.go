@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// hostExpression extracts the host from the folded URL. Keep in sync with
+// hostOf, which does the same in Go.
+var hostExpression = fmt.Sprintf(`
+	CASE WHEN instr(%[1]s, '://') > 0 THEN
+		CASE WHEN instr(substr(%[1]s, instr(%[1]s, '://') + 3), '/') > 0
+		THEN substr(substr(%[1]s, instr(%[1]s, '://') + 3), 1, instr(substr(%[1]s, instr(%[1]s, '://') + 3), '/') - 1)
+		ELSE substr(%[1]s, instr(%[1]s, '://') + 3) END
+	ELSE
+		CASE WHEN instr(%[1]s, '/') > 0 THEN substr(%[1]s, 1, instr(%[1]s, '/') - 1) ELSE %[1]s END
+	END
+`, foldedColumn("url"))
+
+// foldedColumn is an expression for field of the folded column, e.g. "author";
+// see foldedText.
+func foldedColumn(field string) string {
+	return fmt.Sprintf("json_extract(folded, '$.%s')", field)
+}
+
+// sortColumns by SortField. Timestamps sort by unix_micros, since the
+// timestamp column's text format isn't ordered.
+var sortColumns = map[SortField]string{
+	"":            "unix_micros",
+	SortTimestamp: "unix_micros",
+	SortTitle:     "title",
+	SortAuthor:    "author",
+}
+
+// compileQuery to WHERE, ORDER BY, LIMIT, and OFFSET clauses for listQuery,
+// with their named arguments. Its results should match [Query.Apply]: string
+// filters fold case like [Query.Matches] by matching the folded column.
+func compileQuery(q Query) (clauses string, args []any, err error) {
+	if err := q.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	var conditions []string
+	where := func(condition string, namedArgs ...sql.NamedArg) {
+		conditions = append(conditions, condition)
+		for _, arg := range namedArgs {
+			args = append(args, arg)
+		}
+	}
+
+	if q.Author != "" {
+		where(foldedColumn("author")+` LIKE :author ESCAPE '\'`, sql.Named("author", likePattern(q.Author)))
+	}
+	if q.URL != "" {
+		where(foldedColumn("url")+` LIKE :url ESCAPE '\'`, sql.Named("url", likePattern(q.URL)))
+	}
+	if q.Domain != "" {
+		domain := strings.ToLower(q.Domain)
+		where(
+			fmt.Sprintf(`(%[1]s = :domain OR %[1]s LIKE :subdomain ESCAPE '\')`, hostExpression),
+			sql.Named("domain", domain),
+			sql.Named("subdomain", "%."+escapeLike(domain)),
+		)
+	}
+	if !q.Since.IsZero() {
+		where(`unix_micros >= :since`, sql.Named("since", q.Since.UnixMicro()))
+	}
+	if !q.Until.IsZero() {
+		where(`unix_micros < :until`, sql.Named("until", q.Until.UnixMicro()))
+	}
+	if q.Match != "" {
+		where(
+			fmt.Sprintf(`(%s LIKE :match ESCAPE '\' OR %s LIKE :match ESCAPE '\' OR %s LIKE :match ESCAPE '\')`,
+				foldedColumn("title"), foldedColumn("author"), foldedColumn("note")),
+			sql.Named("match", likePattern(q.Match)),
+		)
+	}
+	if q.Tag != "" {
+		where(`EXISTS (SELECT 1 FROM json_each(texts.folded, '$.tags') WHERE json_each.value = :tag)`, sql.Named("tag", strings.ToLower(q.Tag)))
+	}
+	if len(q.Statuses) > 0 {
+		placeholders := make([]string, 0, len(q.Statuses)+1)
+		var statusArgs []sql.NamedArg
+		for i, status := range q.Statuses {
+			name := fmt.Sprintf("status%d", i)
+			placeholders = append(placeholders, ":"+name)
+			statusArgs = append(statusArgs, sql.Named(name, string(status)))
+			if status == text.StatusRead {
+				// Texts recorded before statuses existed are read.
+				placeholders = append(placeholders, "''")
+			}
+		}
+		where(fmt.Sprintf("status IN (%s)", strings.Join(placeholders, ", ")), statusArgs...)
+	}
+	if len(q.IDs) > 0 {
+		placeholders := make([]string, len(q.IDs))
+		idArgs := make([]sql.NamedArg, len(q.IDs))
+		for i, id := range q.IDs {
+			name := fmt.Sprintf("id%d", i)
+			placeholders[i] = ":" + name
+			idArgs[i] = sql.Named(name, id)
+		}
+		where(fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ", ")), idArgs...)
+	}
+
+	comparison := ">"
+	if q.Direction == text.Descending {
+		comparison = "<"
+	}
+	if q.After != nil {
+		where(
+			fmt.Sprintf("(%[1]s %[2]s :after_key OR (%[1]s = :after_key AND id %[2]s :after_id))", sortColumns[q.Sort], comparison),
+			sql.Named("after_key", sortKey(q.Sort, q.After)),
+			sql.Named("after_id", q.After.ID),
+		)
+	}
+
+	var b strings.Builder
+	if len(conditions) > 0 {
+		fmt.Fprintf(&b, "WHERE %s\n", strings.Join(conditions, "\n\tAND "))
+	}
+
+	direction := "ASC"
+	if q.Direction == text.Descending {
+		direction = "DESC"
+	}
+	fmt.Fprintf(&b, "ORDER BY %s %s, id %s\n", sortColumns[q.Sort], direction, direction)
+
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit == 0 {
+			// SQLite requires a LIMIT for OFFSET; negative means no limit.
+			limit = -1
+		}
+		fmt.Fprintf(&b, "LIMIT %d OFFSET %d", limit, q.Offset)
+	}
+	return b.String(), args, nil
+}
+
+// sortKey is t's value in the column for field. See sortColumns.
+func sortKey(field SortField, t *text.Text) any {
+	switch field {
+	case SortTitle:
+		return t.Title
+	case SortAuthor:
+		return t.Author
+	default:
+		return t.Timestamp.UnixMicro()
+	}
+}
+
+// likePattern matching folded values containing substring.
+func likePattern(substring string) string {
+	return "%" + escapeLike(strings.ToLower(substring)) + "%"
+}
+
+// escapeLike escapes LIKE wildcards in s, for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,6 +1,9 @@
 package store
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -8,6 +11,7 @@ import (
 
 	"github.com/lukasschwab/tiir/pkg/text"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	_ "github.com/libsql/libsql-client-go/libsql"
 	_ "modernc.org/sqlite"
@@ -21,7 +25,7 @@ func startLocalLibSQL(t testing.TB) *SQL {
 	t.Logf("Using DB at file %v", emptyFile.Name())
 
 	connectionString := fmt.Sprintf("file://%s", emptyFile.Name())
-	s, err := useLibSQL(connectionString)
+	s, err := useLibSQL(connectionString, true)
 	if err != nil {
 		t.Fatalf("Failed initializing LibSQL store: %v", err)
 	}
@@ -31,54 +35,139 @@ func startLocalLibSQL(t testing.TB) *SQL {
 func TestUseLibSQL(t *testing.T) {
 	// Initialize.
 	s := startLocalLibSQL(t)
-	texts, err := s.List(text.Timestamps, text.Descending)
+	texts, err := s.List(t.Context(), Query{Direction: text.Descending})
 	assert.NoError(t, err, "Shouldn't error listing on empty database")
 	assert.Empty(t, texts)
 
 	// Insert.
 	firstText := randomText(t)
-	upserted, err := s.Upsert(firstText)
+	upserted, err := s.Upsert(t.Context(), firstText)
 	assert.NoError(t, err)
 	assert.Equal(t, firstText, upserted)
 
-	read, err := s.Read(firstText.ID)
+	read, err := s.Read(t.Context(), firstText.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, firstText, read)
 
 	// Update.
 	firstText.Author = firstText.Author + " Jr."
-	upserted, err = s.Upsert(firstText)
+	upserted, err = s.Upsert(t.Context(), firstText)
 	assert.NoError(t, err)
 	assert.Equal(t, firstText, upserted)
 
-	texts, err = s.List(text.Timestamps, text.Descending)
+	texts, err = s.List(t.Context(), Query{Direction: text.Descending})
 	assert.NoError(t, err)
 	assert.Len(t, texts, 1)
 
 	// Second insert.
 	secondText := randomText(t)
 	secondText.Timestamp = secondText.Timestamp.Add(1 * time.Second)
-	upserted, err = s.Upsert(secondText)
+	upserted, err = s.Upsert(t.Context(), secondText)
 	assert.NoError(t, err)
 	assert.Equal(t, secondText, upserted)
 
-	texts, err = s.List(text.Timestamps, text.Descending)
+	texts, err = s.List(t.Context(), Query{Direction: text.Descending})
 	assert.NoError(t, err)
 	assert.Len(t, texts, 2)
 	assert.Equal(t, secondText.ID, texts[0].ID)
 	assert.Equal(t, firstText.ID, texts[1].ID)
 
 	// Delete.
-	deleted, err := s.Delete(secondText.ID)
+	deleted, err := s.Delete(t.Context(), secondText.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, secondText, deleted)
 
-	texts, err = s.List(text.Timestamps, text.Descending)
+	texts, err = s.List(t.Context(), Query{Direction: text.Descending})
 	assert.NoError(t, err)
 	assert.Len(t, texts, 1)
 	assert.Equal(t, firstText, texts[0])
 }
 
+func TestLibSQLTags(t *testing.T) {
+	s := startLocalLibSQL(t)
+	defer s.Close()
+
+	tagged := randomText(t)
+	tagged.Tags = []string{"go", "databases"}
+	upserted, err := s.Upsert(t.Context(), tagged)
+	assert.NoError(t, err)
+	assert.Equal(t, tagged, upserted)
+
+	read, err := s.Read(t.Context(), tagged.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go", "databases"}, read.Tags)
+}
+
+func TestLibSQLUnnamedTimeZones(t *testing.T) {
+	s := startLocalLibSQL(t)
+	defer s.Close()
+
+	// Parsing a timestamp with a numeric offset yields an unnamed time zone,
+	// which the libSQL driver writes in a format it can't read back.
+	var timestamp time.Time
+	require.NoError(t, json.Unmarshal([]byte(`"2023-04-07T12:00:00.5-07:00"`), &timestamp))
+	upserted := randomText(t)
+	upserted.Timestamp = timestamp
+	_, err := s.Upsert(t.Context(), upserted)
+	require.NoError(t, err)
+	batched := randomText(t)
+	batched.Timestamp = timestamp
+	_, err = s.UpsertMany(t.Context(), []*text.Text{batched})
+	require.NoError(t, err)
+	assert.Equal(t, timestamp, upserted.Timestamp, "shouldn't modify upserted texts")
+
+	texts, err := s.List(t.Context(), Query{})
+	require.NoError(t, err)
+	require.Len(t, texts, 2)
+	for _, read := range texts {
+		assert.True(t, timestamp.Equal(read.Timestamp))
+	}
+}
+
+func TestLibSQLMigratesColumns(t *testing.T) {
+	dbFile, err := os.CreateTemp(t.ArtifactDir(), "*.db")
+	assert.NoError(t, err)
+	connectionString := fmt.Sprintf("file://%s", dbFile.Name())
+
+	// Create a table without the tags column, as older versions did.
+	db, err := sql.Open("libsql", connectionString)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+	CREATE TABLE texts (
+		id varchar(8) NOT NULL UNIQUE,
+		title text NOT NULL,
+		url text NOT NULL,
+		author text NOT NULL,
+		note text NOT NULL,
+		timestamp DATETIME NOT NULL
+	);`)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO texts VALUES ('abc123de', 't', 'u', 'a', 'n', ?)`, time.Now().UTC())
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	s, err := useLibSQL(connectionString, true)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	read, err := s.Read(t.Context(), "abc123de")
+	assert.NoError(t, err)
+	assert.Empty(t, read.Tags)
+	assert.Equal(t, text.StatusRead, read.CurrentStatus())
+
+	recent, err := s.List(t.Context(), Query{Since: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, recent, 1, "existing rows are backfilled with sortable timestamps")
+
+	queued := randomText(t)
+	queued.Status = text.StatusQueued
+	_, err = s.Upsert(t.Context(), queued)
+	assert.NoError(t, err)
+	read, err = s.Read(t.Context(), queued.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, text.StatusQueued, read.Status)
+}
+
 func randomText(t testing.TB) *text.Text {
 	id, err := text.RandomID()
 	if err != nil {
@@ -93,3 +182,98 @@ func randomText(t testing.TB) *text.Text {
 		Timestamp: time.Now().UTC(),
 	}
 }
+
+func TestLibSQLCancellation(t *testing.T) {
+	s := startLocalLibSQL(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := s.List(ctx, Query{})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.Upsert(ctx, randomText(t))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLibSQLRecordsMigrations(t *testing.T) {
+	s := startLocalLibSQL(t)
+	defer s.Close()
+
+	applied, err := s.Migrations(t.Context())
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	for _, migration := range applied {
+		assert.True(t, migration.Applied, "migration %v", migration.Version)
+		assert.False(t, migration.AppliedAt.IsZero(), "migration %v", migration.Version)
+	}
+	assert.NoError(t, s.Migrate(t.Context(), 0), "migrating a current schema does nothing")
+	assert.ErrorContains(t, s.Migrate(t.Context(), len(migrations)+1), "no schema version")
+}
+
+// startLegacyLibSQL creates a database as SQL did before migrations, without
+// the columns added after tags.
+func startLegacyLibSQL(t *testing.T) string {
+	dbFile, err := os.CreateTemp(t.ArtifactDir(), "*.db")
+	assert.NoError(t, err)
+	connectionString := fmt.Sprintf("file://%s", dbFile.Name())
+
+	db, err := sql.Open("libsql", connectionString)
+	assert.NoError(t, err)
+	_, err = db.Exec(migrations[0].body + migrations[1].body)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO texts VALUES ('abc123de', 't', 'u', 'a', 'n', ?, '[]')`, time.Now().UTC())
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	return connectionString
+}
+
+func TestLibSQLMigratesManually(t *testing.T) {
+	connectionString := startLegacyLibSQL(t)
+	s, err := useLibSQL(connectionString, false)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.Read(t.Context(), "abc123de")
+	assert.ErrorContains(t, err, "schema is at version 2")
+
+	assert.NoError(t, s.Migrate(t.Context(), 4))
+	assert.ErrorContains(t, s.Migrate(t.Context(), 3), "can't migrate schema down")
+	applied, err := s.Migrations(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, Migration{Version: 1, Name: "create_texts", Applied: true}, applied[0], "inferred migrations have no times")
+	assert.False(t, applied[3].AppliedAt.IsZero())
+	assert.False(t, applied[4].Applied)
+
+	assert.NoError(t, s.Migrate(t.Context(), 0))
+	read, err := s.Read(t.Context(), "abc123de")
+	assert.NoError(t, err)
+	assert.Equal(t, "t", read.Title)
+	results, err := s.Search(t.Context(), "t", 0)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1, "migrations index existing rows")
+	texts, err := s.List(t.Context(), Query{Author: "A"})
+	assert.NoError(t, err)
+	assert.Len(t, texts, 1, "migrations fold existing rows")
+}
+
+func TestLibSQLOpensReadOnly(t *testing.T) {
+	connectionString := startLegacyLibSQL(t)
+	_, err := useLibSQL(connectionString+"?mode=ro", true)
+	assert.ErrorContains(t, err, "error migrating schema to version 3", "can't use a schema that's too old")
+
+	s, err := useLibSQL(connectionString, false)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Migrate(t.Context(), minimumSchemaVersion))
+	migrated, err := s.Migrations(t.Context())
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	readOnly, err := useLibSQL(connectionString+"?mode=ro", true)
+	assert.NoError(t, err, "uses a schema that's recent enough without migrating")
+	defer readOnly.Close()
+	read, err := readOnly.Read(t.Context(), "abc123de")
+	assert.NoError(t, err)
+	assert.Equal(t, "t", read.Title)
+	applied, err := readOnly.Migrations(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, migrated, applied, "doesn't apply later migrations")
+}
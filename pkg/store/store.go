@@ -8,23 +8,163 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"io"
+	"time"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/text"
 )
 
+// Errors returned by [Interface] implementations and the operations in this
+// package, possibly wrapped with details. Test for them with [errors.Is].
+var (
+	// ErrNotFound means there's no text with the requested ID. Every
+	// implementation returns it.
+	ErrNotFound = errors.New("text not found")
+	// ErrConflict means a write conflicts with the stored texts. Stores don't
+	// detect conflicts themselves, since upserts overwrite: it's returned by
+	// operations that check before writing, e.g. [Copy], replaying a [Cache]'s
+	// outbox, and creating a text whose random ID is taken; see
+	// [github.com/lukasschwab/tiir/pkg/tir.Interface]. [HTTP] returns it when
+	// the server does.
+	ErrConflict = errors.New("conflicting text")
+	// ErrUnavailable means a remote store couldn't be reached, e.g. because
+	// the network is down. The same operation may succeed later.
+	ErrUnavailable = errors.New("store unavailable")
+)
+
+// Warning describes problems that didn't stop an operation, e.g. files a
+// [Markdown] store couldn't parse and skipped. Operations return it alongside
+// their results, which are usable: report the problems, but don't fail. Test
+// for it with [errors.As]. Operations in this package that write what they
+// list, e.g. [Copy] and [Sync], fail on warnings rather than act on partial
+// results.
+type Warning struct {
+	Problems []error
+}
+
+func (w *Warning) Error() string {
+	return errors.Join(w.Problems...).Error()
+}
+
+func (w *Warning) Unwrap() []error {
+	return w.Problems
+}
+
 // Interface for storing texts somewhere. An initialized store must be closed:
 // call Close when you're done writing to the store.
+//
+// Implementations that block on I/O abandon operations when their context is
+// canceled, returning an error wrapping the context's error.
 type Interface interface {
 	// Close the Store, rendering it unusable for future operations.
 	io.Closer
-	// Read a text by ID.
-	Read(id string) (*text.Text, error)
-	// Delete a text by ID and return the deleted text.
-	Delete(id string) (*text.Text, error)
+	// Read a text by ID. Returns [ErrNotFound] if there's no such text.
+	Read(ctx context.Context, id string) (*text.Text, error)
+	// Delete a text by ID and return the deleted text. Returns [ErrNotFound]
+	// if there's no such text.
+	Delete(ctx context.Context, id string) (*text.Text, error)
 	// Upsert a text by t.ID and return the resulting text. Assumes t.ID is set
 	// and t is valid; see (*text.Text).Validate(...).
-	Upsert(t *text.Text) (*text.Text, error)
-	// List all texts in the store in order.
-	List(c text.Comparator, d text.Direction) ([]*text.Text, error)
+	Upsert(ctx context.Context, t *text.Text) (*text.Text, error)
+	// UpsertMany upserts texts like Upsert and returns the resulting texts in
+	// order. Stores that can write atomically, e.g. in a transaction, upsert
+	// every text or none.
+	UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error)
+	// DeleteMany deletes the texts with ids and returns them in order. Returns
+	// [ErrNotFound] if there's no text with one of the IDs; stores that can
+	// write atomically then delete none.
+	DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error)
+	// List the texts in the store matching q, in q's order. See [Query].
+	// Stores that skip texts they can't read return the rest with a
+	// [*Warning].
+	List(ctx context.Context, q Query) ([]*text.Text, error)
+	// Search for texts whose title, author, or note contain every term in
+	// query, most relevant first. If limit is positive, Search returns at most
+	// limit results. See [search.Result].
+	Search(ctx context.Context, query string, limit int) ([]search.Result, error)
+}
+
+// Compacter is implemented by stores that can rewrite their storage to reclaim
+// space taken by obsolete records, e.g. [JSONL].
+type Compacter interface {
+	// Compact the store's storage without changing its texts.
+	Compact(ctx context.Context) error
+}
+
+// Historian is implemented by stores that record each change to a text, e.g.
+// [Git].
+type Historian interface {
+	// History of changes to the text with id, most recent first. Returns an
+	// error wrapping [ErrNotFound] if there's no record of the text. History
+	// includes deleted texts.
+	History(ctx context.Context, id string) ([]Revision, error)
+}
+
+// Revision is a recorded change to a text; see [Historian].
+type Revision struct {
+	// ID identifies the revision in the store, e.g. a commit hash.
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	// Message describes the change, e.g. "create 35bb8126: Go Proverbs".
+	Message string `json:"message"`
+}
+
+// Rekeyer is implemented by stores encrypted with a [Key], e.g.
+// [EncryptedFile].
+type Rekeyer interface {
+	// Rekey re-encrypts the store with key. The old key no longer opens it.
+	Rekey(ctx context.Context, key Key) error
+}
+
+// Outbox is implemented by stores that queue changes to a remote store while
+// it's unavailable, e.g. [Cache].
+type Outbox interface {
+	// Pending changes, in the order they'll be applied.
+	Pending(ctx context.Context) ([]*PendingChange, error)
+	// Replay pending changes to the remote store, returning those still
+	// pending. Returns an error wrapping [ErrUnavailable] if the remote store
+	// is unavailable.
+	Replay(ctx context.Context) ([]*PendingChange, error)
+	// Resolve conflicting changes to the text with id by keeping the local
+	// changes, overwriting the remote text, or by discarding them.
+	Resolve(ctx context.Context, id string, keepLocal bool) error
+}
+
+// PendingChange is a change queued by an [Outbox].
+type PendingChange struct {
+	// Op is "upsert" or "delete".
+	Op string    `json:"op"`
+	At time.Time `json:"at"`
+	ID string    `json:"id"`
+	// Text is the upserted text.
+	Text *text.Text `json:"text,omitempty"`
+	// Base is the text the change was made to, or nil if it created the text.
+	Base *text.Text `json:"base,omitempty"`
+	// Conflict, if set, describes why the change can't be applied to the
+	// remote store.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Migrator is implemented by stores with versioned schemas, e.g. [SQL].
+type Migrator interface {
+	// Migrations known to the store, in order, and whether each has been
+	// applied.
+	Migrations(ctx context.Context) ([]Migration, error)
+	// Migrate the schema forward to version to, or to the latest version if
+	// to is zero.
+	Migrate(ctx context.Context, to int) error
+}
+
+// Migration is a schema migration; see [Migrator].
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	// AppliedAt is when the migration was applied, or zero if it's pending or
+	// was applied before the store recorded migrations.
+	AppliedAt time.Time `json:"applied_at,omitzero"`
 }
@@ -0,0 +1,246 @@
+// Package storetest checks that implementations of [store.Interface] satisfy
+// its contract. Every built-in store runs it; third-party stores can too:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Interface { return NewMyStore() })
+//	}
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/store"
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run the conformance suite against stores constructed by newStore, which must
+// return a new, empty store each time it's called. newStore gets the test
+// using the store, e.g. for [testing.T.TempDir]. Run closes the stores.
+func Run(t *testing.T, newStore func(t *testing.T) store.Interface) {
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, s store.Interface)
+	}{
+		{"NotFound", testNotFound},
+		{"UpsertIsIdempotent", testUpsertIsIdempotent},
+		{"UpsertReplaces", testUpsertReplaces},
+		{"DeleteReturnsText", testDeleteReturnsText},
+		{"Batches", testBatches},
+		{"ListOrder", testListOrder},
+		{"TimestampsRoundTrip", testTimestampsRoundTrip},
+		{"ConcurrentAccess", testConcurrentAccess},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStore(t)
+			t.Cleanup(func() {
+				assert.NoError(t, s.Close())
+			})
+			test.run(t, s)
+		})
+	}
+}
+
+// newText is a valid text with id, title, author, and timestamp.
+func newText(id, title, author string, timestamp time.Time) *text.Text {
+	return &text.Text{
+		ID:        id,
+		Title:     title,
+		URL:       "https://example.com/" + id,
+		Author:    author,
+		Note:      "A note on " + title,
+		Timestamp: timestamp,
+		Tags:      []string{"tag"},
+		Status:    text.StatusRead,
+	}
+}
+
+// base is a fixed timestamp for texts.
+var base = time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC)
+
+// assertTextEqual asserts that expected and actual have the same contents; see
+// [text.Text.Equal].
+func assertTextEqual(t *testing.T, expected, actual *text.Text) {
+	t.Helper()
+	if assert.NotNil(t, actual) && !expected.Equal(actual) {
+		assert.Failf(t, "texts differ", "expected: %+v\nactual:   %+v", expected, actual)
+	}
+}
+
+func ids(texts []*text.Text) []string {
+	ids := make([]string, len(texts))
+	for i, t := range texts {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+func testNotFound(t *testing.T, s store.Interface) {
+	_, err := s.Read(t.Context(), "missing0")
+	assert.ErrorIs(t, err, store.ErrNotFound, "Read")
+	_, err = s.Delete(t.Context(), "missing0")
+	assert.ErrorIs(t, err, store.ErrNotFound, "Delete")
+	_, err = s.DeleteMany(t.Context(), []string{"missing0"})
+	assert.ErrorIs(t, err, store.ErrNotFound, "DeleteMany")
+
+	texts, err := s.List(t.Context(), store.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, texts)
+}
+
+func testUpsertIsIdempotent(t *testing.T, s store.Interface) {
+	original := newText("aaaaaaaa", "Title", "Author", base)
+	for range 2 {
+		upserted, err := s.Upsert(t.Context(), original)
+		require.NoError(t, err)
+		assertTextEqual(t, original, upserted)
+	}
+
+	texts, err := s.List(t.Context(), store.Query{})
+	require.NoError(t, err)
+	require.Len(t, texts, 1)
+	assertTextEqual(t, original, texts[0])
+	read, err := s.Read(t.Context(), original.ID)
+	require.NoError(t, err)
+	assertTextEqual(t, original, read)
+}
+
+func testUpsertReplaces(t *testing.T, s store.Interface) {
+	original := newText("aaaaaaaa", "Title", "Author", base)
+	_, err := s.Upsert(t.Context(), original)
+	require.NoError(t, err)
+
+	// Clear optional fields, too.
+	updated := newText("aaaaaaaa", "New Title", "New Author", base.Add(time.Hour))
+	updated.Tags, updated.Status = nil, text.StatusQueued
+	upserted, err := s.Upsert(t.Context(), updated)
+	require.NoError(t, err)
+	assertTextEqual(t, updated, upserted)
+
+	read, err := s.Read(t.Context(), original.ID)
+	require.NoError(t, err)
+	assertTextEqual(t, updated, read)
+}
+
+func testDeleteReturnsText(t *testing.T, s store.Interface) {
+	original := newText("aaaaaaaa", "Title", "Author", base)
+	_, err := s.Upsert(t.Context(), original)
+	require.NoError(t, err)
+
+	deleted, err := s.Delete(t.Context(), original.ID)
+	require.NoError(t, err)
+	assertTextEqual(t, original, deleted)
+
+	_, err = s.Read(t.Context(), original.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = s.Delete(t.Context(), original.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound, "deleted twice")
+}
+
+func testBatches(t *testing.T, s store.Interface) {
+	texts := []*text.Text{
+		newText("bbbbbbbb", "B", "Author", base),
+		newText("aaaaaaaa", "A", "Author", base),
+	}
+	upserted, err := s.UpsertMany(t.Context(), texts)
+	require.NoError(t, err)
+	require.Equal(t, ids(texts), ids(upserted), "upserted texts out of order")
+	for i := range texts {
+		assertTextEqual(t, texts[i], upserted[i])
+	}
+
+	deleted, err := s.DeleteMany(t.Context(), []string{"aaaaaaaa", "bbbbbbbb"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"aaaaaaaa", "bbbbbbbb"}, ids(deleted), "deleted texts out of order")
+	assertTextEqual(t, texts[1], deleted[0])
+	assertTextEqual(t, texts[0], deleted[1])
+
+	remaining, err := s.List(t.Context(), store.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+
+	empty, err := s.UpsertMany(t.Context(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testListOrder(t *testing.T, s store.Interface) {
+	// Ties in every field, broken by ID.
+	fixtures := []*text.Text{
+		newText("cccccccc", "Beta", "Ann", base),
+		newText("aaaaaaaa", "Beta", "Bob", base.Add(time.Hour)),
+		newText("dddddddd", "Alpha", "Bob", base.Add(-time.Hour)),
+		newText("bbbbbbbb", "Gamma", "Ann", base),
+	}
+	for _, fixture := range fixtures {
+		_, err := s.Upsert(t.Context(), fixture)
+		require.NoError(t, err)
+	}
+
+	for _, sort := range store.SortFields {
+		for _, direction := range []text.Direction{text.Ascending, text.Descending} {
+			q := store.Query{Sort: sort, Direction: direction}
+			expected, err := q.Apply(fixtures)
+			require.NoError(t, err)
+			actual, err := s.List(t.Context(), q)
+			require.NoError(t, err)
+			assert.Equal(t, ids(expected), ids(actual), "sort %v, direction %v", sort, direction)
+		}
+	}
+}
+
+func testTimestampsRoundTrip(t *testing.T, s store.Interface) {
+	zones := []*time.Location{
+		time.UTC,
+		time.FixedZone("JST", 9*60*60),
+		time.FixedZone("PDT", -7*60*60),
+		// Parsing a timestamp with a numeric offset yields an unnamed zone.
+		time.FixedZone("", -7*60*60),
+	}
+	for i, zone := range zones {
+		original := newText(fmt.Sprintf("tz%06d", i), "Title", "Author", base.In(zone))
+		original.Updated = base.Add(time.Minute).In(zone)
+		_, err := s.Upsert(t.Context(), original)
+		require.NoError(t, err)
+
+		read, err := s.Read(t.Context(), original.ID)
+		require.NoError(t, err)
+		assert.True(t, original.Timestamp.Equal(read.Timestamp), "%v: timestamp %v read as %v", zone, original.Timestamp, read.Timestamp)
+		if !read.Updated.IsZero() {
+			// Some stores don't record when texts were updated.
+			assert.True(t, original.Updated.Equal(read.Updated), "%v: update time %v read as %v", zone, original.Updated, read.Updated)
+		}
+	}
+
+	// Timestamps in different zones sort as instants.
+	texts, err := s.List(t.Context(), store.Query{Since: base, Until: base.Add(time.Second)})
+	require.NoError(t, err)
+	assert.Len(t, texts, len(zones))
+}
+
+func testConcurrentAccess(t *testing.T, s store.Interface) {
+	const writers, textsPerWriter = 4, 5
+	var wg sync.WaitGroup
+	for writer := range writers {
+		wg.Go(func() {
+			for i := range textsPerWriter {
+				id := fmt.Sprintf("w%dt%05d", writer, i)
+				if _, err := s.Upsert(t.Context(), newText(id, "Title", "Author", base)); err != nil {
+					t.Errorf("error upserting %v: %v", id, err)
+				}
+				if _, err := s.List(t.Context(), store.Query{}); err != nil {
+					t.Errorf("error listing texts: %v", err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	texts, err := s.List(t.Context(), store.Query{})
+	require.NoError(t, err)
+	assert.Len(t, texts, writers*textsPerWriter)
+}
@@ -0,0 +1,339 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+)
+
+// Checkpoint records the texts two stores had in common when they were last
+// synced; see [Sync]. Sync compares each store's texts to the checkpoint to
+// tell which store changed a text, or deleted it.
+type Checkpoint struct {
+	// At is when the stores were last synced; zero if they never were.
+	At time.Time `json:"at"`
+	// Texts maps the ID of each text the stores had in common to a hash of its
+	// contents; see [ContentHash].
+	Texts map[string]string `json:"texts"`
+	// Tombstones maps the ID of each text deleted from both stores to the
+	// deletion, so a copy that reappears from a stale store isn't recreated.
+	Tombstones map[string]Tombstone `json:"tombstones,omitempty"`
+}
+
+// Tombstone records a text's deletion in a [Checkpoint].
+type Tombstone struct {
+	// Hash of the deleted text's contents; see [ContentHash].
+	Hash string `json:"hash"`
+	// At is when [Sync] found the text deleted.
+	At time.Time `json:"at"`
+}
+
+// LoadCheckpoint from a file at path, or return an empty checkpoint if there's
+// no such file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't read checkpoint: %w", err)
+	} else if err := json.Unmarshal(contents, checkpoint); err != nil {
+		return nil, fmt.Errorf("couldn't parse checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// Save c to a file at path atomically, creating its directory if necessary.
+func (c *Checkpoint) Save(path string) error {
+	contents, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return fmt.Errorf("couldn't encode checkpoint: %w", err)
+	} else if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("couldn't create checkpoint directory: %w", err)
+	} else if _, err := replaceFile(path, contents); err != nil {
+		return err
+	}
+	return nil
+}
+
+// synced records that both stores have a text with hash.
+func (c *Checkpoint) synced(id, hash string) {
+	if c.Texts == nil {
+		c.Texts = make(map[string]string)
+	}
+	c.Texts[id] = hash
+	delete(c.Tombstones, id)
+}
+
+// deleted records that neither store has the text with id.
+func (c *Checkpoint) deleted(id, hash string) {
+	if c.Tombstones == nil {
+		c.Tombstones = make(map[string]Tombstone)
+	}
+	c.Tombstones[id] = Tombstone{Hash: hash, At: time.Now()}
+	delete(c.Texts, id)
+}
+
+// ContentHash of t: a hex-encoded SHA-256 hash of its contents, ignoring
+// t.Updated and the time zone of t.Timestamp. Texts with equal contents (see
+// [text.Text.Equal]) have equal hashes.
+func ContentHash(t *text.Text) string {
+	canonical := *t
+	canonical.Updated = time.Time{}
+	canonical.Timestamp = t.Timestamp.UTC()
+	if canonical.Tags == nil {
+		canonical.Tags = []string{}
+	}
+	// Marshaling a text can't fail.
+	contents, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolver picks the version of a text to keep when two stores both changed
+// it since their last sync. Either version is nil if its store deleted the
+// text. Resolver may return a new version, e.g. one merged by the user, or nil
+// to delete the text from both stores.
+type Resolver func(ctx context.Context, a, b *text.Text) (*text.Text, error)
+
+// LastWriterWins is a [Resolver] that keeps the version updated most recently,
+// preferring a in a tie. It keeps a changed text over a deletion, so a conflict
+// never loses changes.
+func LastWriterWins(_ context.Context, a, b *text.Text) (*text.Text, error) {
+	if a == nil {
+		return b, nil
+	} else if b == nil || !b.Updated.After(a.Updated) {
+		return a, nil
+	}
+	return b, nil
+}
+
+// SyncOptions configure [Sync].
+type SyncOptions struct {
+	// Resolve conflicting changes; [LastWriterWins] if nil.
+	Resolve Resolver
+	// DryRun reports the changes Sync would make without making them or
+	// updating the checkpoint. Conflicts are reported, but not resolved.
+	DryRun bool
+}
+
+// SyncChange is a change [Sync] made to one of the stores it synced.
+type SyncChange struct {
+	// Op is "create", "update", or "delete".
+	Op    string `json:"op"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Store is "a" or "b": the store Sync changed.
+	Store string `json:"store"`
+	// Conflict is set if both stores changed the text since the checkpoint.
+	Conflict bool `json:"conflict,omitempty"`
+}
+
+// Sync stores a and b: copy texts created or updated in one store since
+// checkpoint to the other, and delete texts deleted from one store from the
+// other. Returns the changes made, in order.
+//
+// Sync detects changes by comparing content hashes (see [ContentHash]) to the
+// checkpoint, so it works with stores that don't record when texts were
+// updated. Texts changed in both stores are resolved with opts.Resolve.
+//
+// Sync updates checkpoint as it goes: if it fails partway, checkpoint records
+// the texts synced so far, and should be saved for the next attempt.
+func Sync(ctx context.Context, a, b Interface, checkpoint *Checkpoint, opts SyncOptions) ([]SyncChange, error) {
+	if opts.Resolve == nil {
+		opts.Resolve = LastWriterWins
+	}
+	textsA, err := a.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing texts: %w", err)
+	}
+	textsB, err := b.List(ctx, Query{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing texts: %w", err)
+	}
+	byIDA, byIDB := byID(textsA), byID(textsB)
+
+	ids := make([]string, 0, len(byIDA)+len(byIDB)+len(checkpoint.Texts))
+	for id := range byIDA {
+		ids = append(ids, id)
+	}
+	for id := range byIDB {
+		ids = append(ids, id)
+	}
+	for id := range checkpoint.Texts {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	s := &syncer{a: a, b: b, checkpoint: checkpoint, opts: opts}
+	for _, id := range slices.Compact(ids) {
+		if err := s.sync(ctx, id, byIDA[id], byIDB[id]); err != nil {
+			return s.changes, fmt.Errorf("error syncing %v: %w", id, err)
+		}
+	}
+	if !opts.DryRun {
+		checkpoint.At = time.Now()
+	}
+	return s.changes, nil
+}
+
+func byID(texts []*text.Text) map[string]*text.Text {
+	result := make(map[string]*text.Text, len(texts))
+	for _, t := range texts {
+		result[t.ID] = t
+	}
+	return result
+}
+
+// syncer holds the state of a [Sync].
+type syncer struct {
+	a, b       Interface
+	checkpoint *Checkpoint
+	opts       SyncOptions
+	changes    []SyncChange
+}
+
+// sync the versions of the text with id in a and b; either is nil if its
+// store doesn't have the text.
+func (s *syncer) sync(ctx context.Context, id string, a, b *text.Text) error {
+	base, inBase := s.checkpoint.Texts[id]
+	hashA, hashB := hashOf(a), hashOf(b)
+
+	if hashA == hashB {
+		// The stores agree, including if both deleted the text.
+		if s.opts.DryRun {
+			return nil
+		} else if a == nil {
+			s.checkpoint.deleted(id, base)
+		} else {
+			s.checkpoint.synced(id, hashA)
+		}
+		return nil
+	}
+
+	// A text is changed if it differs from the checkpoint. A text that isn't
+	// in the checkpoint is new, unless it's a stale copy of a deleted text.
+	changed := func(t *text.Text, hash string) bool {
+		if inBase {
+			return hash != base
+		}
+		tombstone, deleted := s.checkpoint.Tombstones[id]
+		return t != nil && !(deleted && tombstone.Hash == hash)
+	}
+	changedA, changedB := changed(a, hashA), changed(b, hashB)
+
+	winner, conflict := a, false
+	switch {
+	case changedA && changedB:
+		conflict = true
+		if s.opts.DryRun {
+			winner, _ = LastWriterWins(ctx, a, b)
+		} else {
+			resolved, err := s.opts.Resolve(ctx, a, b)
+			if err != nil {
+				return fmt.Errorf("error resolving conflict: %w", err)
+			}
+			winner = resolved
+		}
+	case changedB:
+		winner = b
+	case !changedA:
+		// Neither store changed the text, e.g. both have stale copies of a
+		// deleted text; delete it.
+		winner = nil
+	}
+
+	winner, err := s.apply(ctx, winner, conflict, &side{"a", s.a, a}, &side{"b", s.b, b})
+	if err != nil || s.opts.DryRun {
+		return err
+	} else if winner == nil {
+		s.checkpoint.deleted(id, cmp.Or(base, hashA, hashB))
+	} else {
+		delete(s.checkpoint.Texts, id)
+		s.checkpoint.synced(winner.ID, hashOf(winner))
+	}
+	return nil
+}
+
+// side is one of the stores [Sync] syncs, with its version of a text.
+type side struct {
+	name    string
+	store   Interface
+	current *text.Text
+}
+
+// apply winner to each side whose current version differs, returning winner as
+// stored. A nil winner deletes the text.
+//
+// If a store assigns winner a new ID (e.g. [HTTP] against a server that
+// assigns IDs to new texts), apply moves the other store's version to the new
+// ID too.
+func (s *syncer) apply(ctx context.Context, winner *text.Text, conflict bool, sides ...*side) (*text.Text, error) {
+	remapped := false
+	for i := 0; i < len(sides); i++ {
+		side := sides[i]
+		if hashOf(side.current) == hashOf(winner) {
+			continue
+		}
+		result, err := s.write(ctx, side, winner, conflict)
+		if err != nil {
+			return nil, err
+		} else if result == nil || result.ID == winner.ID {
+			continue
+		} else if remapped {
+			return nil, fmt.Errorf("both stores assigned new IDs to %v", winner.ID)
+		}
+		log.Printf("store %v created %v as %v", side.name, winner.ID, result.ID)
+		winner, side.current, remapped = result, result, true
+		// Revisit the other store.
+		i = -1
+	}
+	return winner, nil
+}
+
+// write winner to side, replacing its current version, and return the stored
+// text. A nil winner deletes the current version.
+func (s *syncer) write(ctx context.Context, side *side, winner *text.Text, conflict bool) (*text.Text, error) {
+	change := SyncChange{Store: side.name, Conflict: conflict}
+	switch {
+	case winner == nil:
+		change.Op, change.ID, change.Title = "delete", side.current.ID, side.current.Title
+	case side.current == nil || side.current.ID != winner.ID:
+		change.Op, change.ID, change.Title = "create", winner.ID, winner.Title
+	default:
+		change.Op, change.ID, change.Title = "update", winner.ID, winner.Title
+	}
+	s.changes = append(s.changes, change)
+	if s.opts.DryRun {
+		return winner, nil
+	}
+
+	if side.current != nil && (winner == nil || side.current.ID != winner.ID) {
+		if _, err := side.store.Delete(ctx, side.current.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+	if winner == nil {
+		return nil, nil
+	}
+	return side.store.Upsert(ctx, winner)
+}
+
+// hashOf t, or "" if t is nil.
+func hashOf(t *text.Text) string {
+	if t == nil {
+		return ""
+	}
+	return ContentHash(t)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukasschwab/tiir/pkg/text"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func syncText(id, title string, updated time.Time) *text.Text {
+	return &text.Text{
+		ID: id, Title: title, URL: "https://example.com/" + id, Author: "a", Note: "n",
+		Timestamp: time.Date(2023, 4, 7, 12, 0, 0, 0, time.UTC), Updated: updated,
+	}
+}
+
+func titles(t *testing.T, s Interface) map[string]string {
+	texts, err := s.List(t.Context(), Query{})
+	require.NoError(t, err)
+	result := make(map[string]string, len(texts))
+	for _, text := range texts {
+		result[text.ID] = text.Title
+	}
+	return result
+}
+
+func TestSyncCopiesChangesBothWays(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := useMemory(syncText("aaaaaaaa", "shared", earlier), syncText("bbbbbbbb", "deleted later", earlier))
+	b := useMemory(syncText("aaaaaaaa", "shared", earlier), syncText("bbbbbbbb", "deleted later", earlier), syncText("cccccccc", "only b", earlier))
+	checkpoint := &Checkpoint{}
+
+	changes, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []SyncChange{{Op: "create", ID: "cccccccc", Title: "only b", Store: "a"}}, changes)
+	assert.Equal(t, titles(t, a), titles(t, b))
+	assert.Len(t, checkpoint.Texts, 3)
+
+	later := earlier.Add(time.Hour)
+	_, err = a.Upsert(t.Context(), syncText("aaaaaaaa", "updated in a", later))
+	require.NoError(t, err)
+	_, err = b.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+	_, err = b.Upsert(t.Context(), syncText("dddddddd", "created in b", later))
+	require.NoError(t, err)
+
+	changes, err = Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []SyncChange{
+		{Op: "update", ID: "aaaaaaaa", Title: "updated in a", Store: "b"},
+		{Op: "delete", ID: "bbbbbbbb", Title: "deleted later", Store: "a"},
+		{Op: "create", ID: "dddddddd", Title: "created in b", Store: "a"},
+	}, changes)
+	assert.Equal(t, map[string]string{"aaaaaaaa": "updated in a", "cccccccc": "only b", "dddddddd": "created in b"}, titles(t, a))
+	assert.Equal(t, titles(t, a), titles(t, b))
+	assert.Contains(t, checkpoint.Tombstones, "bbbbbbbb")
+
+	changes, err = Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, changes, "synced stores are in sync")
+}
+
+func TestSyncDoesntRecreateTombstonedTexts(t *testing.T) {
+	deleted := syncText("aaaaaaaa", "deleted", time.Time{})
+	a, b := useMemory(deleted), useMemory(deleted)
+	checkpoint := &Checkpoint{}
+	_, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+
+	_, err = a.Delete(t.Context(), deleted.ID)
+	require.NoError(t, err)
+	_, err = Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, titles(t, b))
+
+	// A stale copy reappears, e.g. restored from a backup.
+	_, err = b.Upsert(t.Context(), deleted)
+	require.NoError(t, err)
+	changes, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []SyncChange{{Op: "delete", ID: deleted.ID, Title: "deleted", Store: "b"}}, changes)
+	assert.Empty(t, titles(t, a))
+	assert.Empty(t, titles(t, b))
+}
+
+func TestSyncResolvesConflicts(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	shared := []*text.Text{syncText("aaaaaaaa", "original", start), syncText("bbbbbbbb", "original", start)}
+	a, b := useMemory(shared...), useMemory(shared...)
+	checkpoint := &Checkpoint{}
+	_, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+
+	_, err = a.Upsert(t.Context(), syncText("aaaaaaaa", "older edit", start.Add(time.Minute)))
+	require.NoError(t, err)
+	_, err = b.Upsert(t.Context(), syncText("aaaaaaaa", "newer edit", start.Add(time.Hour)))
+	require.NoError(t, err)
+	_, err = a.Upsert(t.Context(), syncText("bbbbbbbb", "edited", start.Add(time.Minute)))
+	require.NoError(t, err)
+	_, err = b.Delete(t.Context(), "bbbbbbbb")
+	require.NoError(t, err)
+
+	t.Run("dry run", func(t *testing.T) {
+		changes, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.Len(t, changes, 2)
+		assert.Equal(t, "older edit", titles(t, a)["aaaaaaaa"], "dry runs don't change stores")
+	})
+
+	changes, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []SyncChange{
+		{Op: "update", ID: "aaaaaaaa", Title: "newer edit", Store: "a", Conflict: true},
+		{Op: "create", ID: "bbbbbbbb", Title: "edited", Store: "b", Conflict: true},
+	}, changes, "last writer wins, and edits win over deletes")
+	assert.Equal(t, map[string]string{"aaaaaaaa": "newer edit", "bbbbbbbb": "edited"}, titles(t, a))
+	assert.Equal(t, titles(t, a), titles(t, b))
+
+	_, err = a.Upsert(t.Context(), syncText("aaaaaaaa", "mine", start.Add(2*time.Hour)))
+	require.NoError(t, err)
+	_, err = b.Upsert(t.Context(), syncText("aaaaaaaa", "theirs", start.Add(3*time.Hour)))
+	require.NoError(t, err)
+	merge := func(_ context.Context, a, b *text.Text) (*text.Text, error) {
+		merged := *a
+		merged.Title = a.Title + " and " + b.Title
+		return &merged, nil
+	}
+	_, err = Sync(t.Context(), a, b, checkpoint, SyncOptions{Resolve: merge})
+	require.NoError(t, err)
+	assert.Equal(t, "mine and theirs", titles(t, a)["aaaaaaaa"])
+	assert.Equal(t, "mine and theirs", titles(t, b)["aaaaaaaa"])
+}
+
+func TestSyncRemapsAssignedIDs(t *testing.T) {
+	a := useMemory(syncText("aaaaaaaa", "local", time.Time{}))
+	b := &flakyRemote{Memory: useMemory(), assignIDs: true}
+	checkpoint := &Checkpoint{}
+
+	_, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"assigned": "local"}, titles(t, a), "local text moves to the assigned ID")
+	assert.Equal(t, titles(t, a), titles(t, b))
+
+	changes, err := Sync(t.Context(), a, b, checkpoint, SyncOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestCheckpointPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync", "checkpoint.json")
+	empty, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Zero(t, empty.At)
+
+	a, b := useMemory(syncText("aaaaaaaa", "a", time.Time{})), useMemory()
+	_, err = Sync(t.Context(), a, b, empty, SyncOptions{})
+	require.NoError(t, err)
+	require.NoError(t, empty.Save(path))
+
+	loaded, err := LoadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, empty.Texts, loaded.Texts)
+	assert.True(t, empty.At.Equal(loaded.At))
+}
+
+func TestContentHashIgnoresUpdatedAndTimeZone(t *testing.T) {
+	t1 := syncText("aaaaaaaa", "title", time.Now())
+	t2 := *t1
+	t2.Updated = time.Time{}
+	t2.Timestamp = t1.Timestamp.In(time.FixedZone("PDT", -7*60*60))
+	t2.Tags = []string{}
+	assert.Equal(t, ContentHash(t1), ContentHash(&t2))
+
+	t2.Note = "different"
+	assert.NotEqual(t, ContentHash(t1), ContentHash(&t2))
+}
@@ -53,3 +53,13 @@ func (ts *textSorter) Less(i, j int) bool {
 func Timestamps(t1, t2 *Text) bool {
 	return t1.Timestamp.Before(t2.Timestamp)
 }
+
+// Titles is a Comparator: sort texts by title.
+func Titles(t1, t2 *Text) bool {
+	return t1.Title < t2.Title
+}
+
+// Authors is a Comparator: sort texts by author.
+func Authors(t1, t2 *Text) bool {
+	return t1.Author < t2.Author
+}
@@ -5,7 +5,9 @@ package text
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -15,33 +17,92 @@ const (
 
 // Text you read and recorded in this application.
 type Text struct {
-	Title     string    `json:"title"`
-	URL       string    `json:"url"`
-	Author    string    `json:"author"`
-	Note      string    `json:"note"`
-	ID        string    `json:"id"`
+	Title  string   `json:"title"`
+	URL    string   `json:"url"`
+	Author string   `json:"author"`
+	Note   string   `json:"note"`
+	Tags   []string `json:"tags,omitempty"`
+	ID     string   `json:"id"`
+	// Status of the text in your reading queue. The zero value is equivalent to
+	// [StatusRead]; see [Text.CurrentStatus].
+	Status Status `json:"status,omitempty"`
+	// Timestamp when the text was read or, for unread texts, when it was
+	// queued.
 	Timestamp time.Time `json:"timestamp"`
+	// Updated is when the text was last created or changed, or zero for texts
+	// recorded before updates were tracked.
+	Updated time.Time `json:"updated,omitzero"`
+}
+
+// Status of a text in your reading queue.
+type Status string
+
+// Texts move from the queue into the log of texts you read.
+const (
+	StatusQueued    Status = "queued"
+	StatusReading   Status = "reading"
+	StatusRead      Status = "read"
+	StatusAbandoned Status = "abandoned"
+)
+
+// Statuses lists every valid [Status].
+var Statuses = []Status{StatusQueued, StatusReading, StatusRead, StatusAbandoned}
+
+// CurrentStatus of t, defaulting to [StatusRead] for texts recorded before
+// statuses existed.
+func (t *Text) CurrentStatus() Status {
+	if t.Status == "" {
+		return StatusRead
+	}
+	return t.Status
+}
+
+// HasStatus reports whether t's [Text.CurrentStatus] is any of statuses.
+func (t *Text) HasStatus(statuses ...Status) bool {
+	for _, status := range statuses {
+		if t.CurrentStatus() == status {
+			return true
+		}
+	}
+	return false
 }
 
 // Validate t has nonzero values for all required fields:
 //
 //   - Title
 //   - Author
-//   - Note
+//   - Note, unless t is still queued or being read, or was abandoned
 //   - URL
+//
+// Status, if set, must be one of [Statuses]. Validate returns a
+// [*ValidationError] naming the first invalid field.
 func (t *Text) Validate() error {
 	switch "" {
 	case t.Title:
-		return errors.New("must specify a title")
+		return &ValidationError{Field: "title", Reason: "must specify a title"}
 	case t.Author:
-		return errors.New("must specify an author")
-	case t.Note:
-		return errors.New("must specify note")
+		return &ValidationError{Field: "author", Reason: "must specify an author"}
 	case t.URL:
-		return errors.New("must specify ID")
-	default:
-		return nil
+		return &ValidationError{Field: "url", Reason: "must specify URL"}
+	}
+	if !t.HasStatus(Statuses...) {
+		return &ValidationError{Field: "status", Reason: fmt.Sprintf("invalid status %q", t.Status)}
+	} else if t.Note == "" && t.HasStatus(StatusRead) {
+		return &ValidationError{Field: "note", Reason: "must specify note"}
 	}
+	return nil
+}
+
+// ValidationError explains why a text is invalid. See [Text.Validate].
+type ValidationError struct {
+	// Field is the JSON name of the invalid field, e.g. "url".
+	Field string
+	// Reason the field is invalid.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
 }
 
 // EditWith gets updates to t from the user with e.
@@ -72,6 +133,84 @@ func (t *Text) Integrate(updates *Text) {
 	if updates.URL != "" {
 		t.URL = updates.URL
 	}
+	if updates.Tags != nil {
+		t.Tags = updates.Tags
+	}
+	if updates.Status != "" {
+		t.Status = updates.Status
+	}
+}
+
+// Equal reports whether t and other have the same contents. Timestamps are
+// compared as instants, and Updated is ignored: it records when contents
+// changed, not what they are.
+func (t *Text) Equal(other *Text) bool {
+	return t.ID == other.ID && t.Title == other.Title && t.URL == other.URL &&
+		t.Author == other.Author && t.Note == other.Note && t.Status == other.Status &&
+		slices.Equal(t.Tags, other.Tags) && t.Timestamp.Equal(other.Timestamp)
+}
+
+// HasTag reports whether t is tagged with tag. Tags are compared
+// case-insensitively.
+func (t *Text) HasTag(tag string) bool {
+	for _, candidate := range t.Tags {
+		if strings.EqualFold(candidate, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tagged returns the subset of texts tagged with tag, preserving order. An
+// empty tag matches every text.
+func Tagged(texts []*Text, tag string) []*Text {
+	if tag == "" {
+		return texts
+	}
+	tagged := make([]*Text, 0, len(texts))
+	for _, t := range texts {
+		if t.HasTag(tag) {
+			tagged = append(tagged, t)
+		}
+	}
+	return tagged
+}
+
+// WithStatus returns the subset of texts with any of statuses, preserving
+// order. No statuses matches every text.
+func WithStatus(texts []*Text, statuses ...Status) []*Text {
+	if len(statuses) == 0 {
+		return texts
+	}
+	matching := make([]*Text, 0, len(texts))
+	for _, t := range texts {
+		if t.HasStatus(statuses...) {
+			matching = append(matching, t)
+		}
+	}
+	return matching
+}
+
+// ParseTags splits a comma-separated list of tags, trimming whitespace and
+// dropping empty or duplicate entries. It's the inverse of [JoinTags].
+func ParseTags(list string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// JoinTags formats tags as a comma-separated list for editing. It's the
+// inverse of [ParseTags].
+func JoinTags(tags []string) string {
+	return strings.Join(tags, ", ")
 }
 
 func RandomID() (string, error) {
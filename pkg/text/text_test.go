@@ -14,6 +14,39 @@ func TestValidate(t *testing.T) {
 	assert.Error(t, (&Text{Note: "n", URL: "u"}).Validate())
 
 	assert.NoError(t, (&Text{Author: "a", Note: "n", URL: "u", Title: "t"}).Validate())
+
+	var validationErr *ValidationError
+	assert.ErrorAs(t, (&Text{Author: "a", Note: "n", Title: "t"}).Validate(), &validationErr)
+	assert.Equal(t, "url", validationErr.Field)
+}
+
+func TestValidateStatus(t *testing.T) {
+	unnoted := Text{Author: "a", URL: "u", Title: "t"}
+
+	for _, status := range []Status{"", StatusRead} {
+		unnoted.Status = status
+		assert.Error(t, unnoted.Validate(), "%q texts need notes", status)
+	}
+	for _, status := range []Status{StatusQueued, StatusReading, StatusAbandoned} {
+		unnoted.Status = status
+		assert.NoError(t, unnoted.Validate(), "%q texts don't need notes", status)
+	}
+
+	unnoted.Status = "skimmed"
+	assert.Error(t, unnoted.Validate(), "unknown statuses are invalid")
+}
+
+func TestWithStatus(t *testing.T) {
+	texts := []*Text{
+		{ID: "a"},
+		{ID: "b", Status: StatusQueued},
+		{ID: "c", Status: StatusRead},
+	}
+	read := WithStatus(texts, StatusRead)
+	assert.Len(t, read, 2)
+	assert.Equal(t, "a", read[0].ID, "empty status is read")
+	assert.Equal(t, "c", read[1].ID)
+	assert.Len(t, WithStatus(texts), 3)
 }
 
 func TestRandomID(t *testing.T) {
@@ -26,3 +59,30 @@ func TestRandomID(t *testing.T) {
 		set[id] = true
 	}
 }
+
+func TestIntegrateTags(t *testing.T) {
+	original := &Text{Tags: []string{"go"}}
+
+	original.Integrate(&Text{Author: "a"})
+	assert.Equal(t, []string{"go"}, original.Tags, "nil tags are ignored")
+
+	original.Integrate(&Text{Tags: []string{}})
+	assert.Empty(t, original.Tags, "empty tags clear existing tags")
+}
+
+func TestTags(t *testing.T) {
+	assert.Equal(t, []string{"go", "Databases"}, ParseTags(" go, Databases,,GO "))
+	assert.Equal(t, "go, databases", JoinTags([]string{"go", "databases"}))
+	assert.Empty(t, ParseTags(""))
+
+	texts := []*Text{
+		{ID: "a", Tags: []string{"go"}},
+		{ID: "b", Tags: []string{"Go", "sql"}},
+		{ID: "c"},
+	}
+	tagged := Tagged(texts, "go")
+	assert.Len(t, tagged, 2)
+	assert.Equal(t, "a", tagged[0].ID)
+	assert.Equal(t, "b", tagged[1].ID)
+	assert.Len(t, Tagged(texts, ""), 3)
+}
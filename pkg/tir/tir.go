@@ -2,10 +2,14 @@
 package tir
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"time"
 
+	"github.com/lukasschwab/tiir/pkg/search"
 	"github.com/lukasschwab/tiir/pkg/store"
 	"github.com/lukasschwab/tiir/pkg/text"
 )
@@ -13,20 +17,76 @@ import (
 // Interface for managing tir texts. Callers should use this in lieu of
 // store.Store; the latter assumes application-level validation implemented in
 // this package. See [New].
+//
+// Every method but Close takes a context, which it passes to the underlying
+// store: canceling it abandons the operation.
 type Interface interface {
 	io.Closer
 	// Create a new text. This function is responsible for assigning
-	// [text.Text.ID] and [text.Text.Timestamp].
-	Create(new *text.Text) (*text.Text, error)
+	// [text.Text.ID] and [text.Text.Timestamp]. Returns a
+	// [*text.ValidationError] if new is invalid, or [store.ErrConflict] if its
+	// random ID is already taken: IDs are short, and stores' upserts would
+	// overwrite the existing text, so Create reads before writing.
+	Create(ctx context.Context, new *text.Text) (*text.Text, error)
+	// CreateMany creates several texts like Create: all of them, or none if
+	// the underlying store can write atomically; see
+	// [store.Interface.UpsertMany]. Returns a [*text.ValidationError] before
+	// creating any text if one is invalid.
+	CreateMany(ctx context.Context, new []*text.Text) ([]*text.Text, error)
 	// Read a text by its ID.
-	Read(id string) (*text.Text, error)
+	Read(ctx context.Context, id string) (*text.Text, error)
 	// Update a text with ID to include updates. Zero-valued fields in updates
-	// (e.g. empty-string fields) are ignored.
-	Update(id string, updates *text.Text) (*text.Text, error)
+	// (e.g. empty-string fields) are ignored. Returns a [*text.ValidationError]
+	// if the updated text is invalid.
+	Update(ctx context.Context, id string, updates *text.Text) (*text.Text, error)
+	// UpsertMany writes texts as they are, keeping their IDs and timestamps,
+	// e.g. to import them from another store. See [store.Interface.UpsertMany].
+	// Returns a [*text.ValidationError] before writing any text if one is
+	// invalid or has no ID.
+	UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error)
 	// Delete a text by its ID.
-	Delete(id string) (*text.Text, error)
-	// List all texts sorted by decreasing [text.Text.Timestamp].
-	List() ([]*text.Text, error)
+	Delete(ctx context.Context, id string) (*text.Text, error)
+	// DeleteMany deletes texts by their IDs; see [store.Interface.DeleteMany].
+	DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error)
+	// Finish reading a text with ID: integrate updates (e.g. a note), mark it
+	// [text.StatusRead], and set its [text.Text.Timestamp] to now.
+	Finish(ctx context.Context, id string, updates *text.Text) (*text.Text, error)
+	// List read texts sorted by decreasing [text.Text.Timestamp].
+	List(ctx context.Context) ([]*text.Text, error)
+	// Queue lists queued and in-progress texts sorted by increasing
+	// [text.Text.Timestamp], so the longest-queued texts come first.
+	Queue(ctx context.Context) ([]*text.Text, error)
+	// Query lists the texts matching q, in q's order. See [store.Query].
+	//
+	// List, Queue, and Query may return texts alongside a [*store.Warning]
+	// about texts the store skipped.
+	Query(ctx context.Context, q store.Query) ([]*text.Text, error)
+	// Search texts' titles, authors, and notes for query, most relevant first.
+	// If limit is positive, Search returns at most limit results.
+	Search(ctx context.Context, query string, limit int) ([]search.Result, error)
+	// Compact the underlying store, if it supports compaction; see
+	// [store.Compacter].
+	Compact(ctx context.Context) error
+	// Rekey the underlying store, if it's encrypted; see [store.Rekeyer].
+	Rekey(ctx context.Context, key store.Key) error
+	// History of changes to the text with id, most recent first, if the
+	// underlying store records it; see [store.Historian].
+	History(ctx context.Context, id string) ([]store.Revision, error)
+	// Outbox of changes queued for a remote store, if the underlying store
+	// queues them; see [store.Outbox].
+	Outbox() (store.Outbox, error)
+	// Migrator for the underlying store's schema, if it has a versioned
+	// schema; see [store.Migrator].
+	Migrator() (store.Migrator, error)
+	// Sync the underlying store with other since checkpoint; see [store.Sync].
+	// Changes to the underlying store are reported with store "a".
+	Sync(ctx context.Context, other store.Interface, checkpoint *store.Checkpoint, opts store.SyncOptions) ([]store.SyncChange, error)
+	// Copy every text in the underlying store to another store; see
+	// [store.Copy].
+	Copy(ctx context.Context, to store.Interface, opts store.CopyOptions) (*store.CopyResult, error)
+	// Verify that every text in the underlying store is in another store; see
+	// [store.Verify].
+	Verify(ctx context.Context, to store.Interface, copied *store.CopyResult) ([]store.Mismatch, error)
 }
 
 // New constructs a new application [Interface] around s. In general, use
@@ -42,43 +102,228 @@ type app struct {
 }
 
 // Create a text.
-func (s *app) Create(t *text.Text) (*text.Text, error) {
+func (s *app) Create(ctx context.Context, t *text.Text) (*text.Text, error) {
 	var err error
 	if err = t.Validate(); err != nil {
 		return nil, err
 	} else if t.ID, err = text.RandomID(); err != nil {
 		return nil, fmt.Errorf("couldn't randomize ID: %w", err)
 	}
+	if _, err := s.provider.Read(ctx, t.ID); err == nil {
+		return nil, fmt.Errorf("%w: ID '%v' is taken", store.ErrConflict, t.ID)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("error checking for existing ID: %w", err)
+	}
 	if t.Timestamp.IsZero() {
 		t.Timestamp = time.Now()
 	}
-	return s.provider.Upsert(t)
+	t.Updated = time.Now()
+	return s.provider.Upsert(ctx, t)
+}
+
+// CreateMany texts.
+func (s *app) CreateMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	for _, t := range texts {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(texts) == 0 {
+		return []*text.Text{}, nil
+	}
+	now := time.Now()
+	ids := make([]string, len(texts))
+	for i, t := range texts {
+		var err error
+		if t.ID, err = text.RandomID(); err != nil {
+			return nil, fmt.Errorf("couldn't randomize ID: %w", err)
+		} else if slices.Contains(ids[:i], t.ID) {
+			return nil, fmt.Errorf("%w: ID '%v' is taken", store.ErrConflict, t.ID)
+		}
+		ids[i] = t.ID
+		if t.Timestamp.IsZero() {
+			t.Timestamp = now
+		}
+		t.Updated = now
+	}
+	// Check every ID at once, rather than reading each text.
+	taken, err := s.provider.List(ctx, store.Query{IDs: ids})
+	var warning *store.Warning
+	if err != nil && !errors.As(err, &warning) {
+		return nil, fmt.Errorf("error checking for existing IDs: %w", err)
+	} else if len(taken) > 0 {
+		return nil, fmt.Errorf("%w: ID '%v' is taken", store.ErrConflict, taken[0].ID)
+	}
+	return s.provider.UpsertMany(ctx, texts)
+}
+
+// UpsertMany texts as they are.
+func (s *app) UpsertMany(ctx context.Context, texts []*text.Text) ([]*text.Text, error) {
+	for _, t := range texts {
+		if t.ID == "" {
+			return nil, &text.ValidationError{Field: "id", Reason: "must specify an ID"}
+		} else if err := t.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return s.provider.UpsertMany(ctx, texts)
 }
 
 // Read a text by ID.
-func (s *app) Read(id string) (*text.Text, error) {
-	return s.provider.Read(id)
+func (s *app) Read(ctx context.Context, id string) (*text.Text, error) {
+	return s.provider.Read(ctx, id)
 }
 
 // Update a text by ID and return the resulting text.
-func (s *app) Update(id string, updates *text.Text) (*text.Text, error) {
-	extant, err := s.provider.Read(id)
+func (s *app) Update(ctx context.Context, id string, updates *text.Text) (*text.Text, error) {
+	extant, err := s.provider.Read(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("error reading old record: %w", err)
 	}
-	// Don't validate: updates can be partial.
-	extant.Integrate(updates)
-	return s.provider.Upsert(extant)
+	// Validate the result rather than updates, which can be partial. Copy
+	// before modifying: don't alter a memory-backed record before it's
+	// validated.
+	updated := *extant
+	updated.Integrate(updates)
+	if err := updated.Validate(); err != nil {
+		return nil, err
+	} else if !updated.Equal(extant) {
+		updated.Updated = time.Now()
+	}
+	return s.provider.Upsert(ctx, &updated)
 }
 
 // Delete a text by ID and return the deleted text.
-func (s *app) Delete(id string) (*text.Text, error) {
-	return s.provider.Delete(id)
+func (s *app) Delete(ctx context.Context, id string) (*text.Text, error) {
+	return s.provider.Delete(ctx, id)
+}
+
+// DeleteMany texts by ID and return the deleted texts.
+func (s *app) DeleteMany(ctx context.Context, ids []string) ([]*text.Text, error) {
+	return s.provider.DeleteMany(ctx, ids)
+}
+
+// Finish reading a text by ID and return the resulting text.
+func (s *app) Finish(ctx context.Context, id string, updates *text.Text) (*text.Text, error) {
+	extant, err := s.provider.Read(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading old record: %w", err)
+	}
+	// Copy before modifying: don't alter a memory-backed record before it's
+	// validated.
+	finished := *extant
+	finished.Integrate(updates)
+	finished.Status = text.StatusRead
+	finished.Timestamp = time.Now()
+	finished.Updated = finished.Timestamp
+	if err := finished.Validate(); err != nil {
+		return nil, err
+	}
+	return s.provider.Upsert(ctx, &finished)
+}
+
+// List read texts available to the service.
+func (s *app) List(ctx context.Context) ([]*text.Text, error) {
+	return s.Query(ctx, ListQuery())
+}
+
+// Queue lists unread texts available to the service, oldest first.
+func (s *app) Queue(ctx context.Context) ([]*text.Text, error) {
+	return s.Query(ctx, QueueQuery())
+}
+
+// ListQuery is the query for [Interface.List]: read texts, most recent first.
+// Use it as a base for narrower queries.
+func ListQuery() store.Query {
+	return store.Query{
+		Statuses:  []text.Status{text.StatusRead},
+		Direction: text.Descending,
+	}
+}
+
+// QueueQuery is the query for [Interface.Queue]: unread texts, oldest first.
+// Use it as a base for narrower queries.
+func QueueQuery() store.Query {
+	return store.Query{
+		Statuses:  []text.Status{text.StatusQueued, text.StatusReading},
+		Direction: text.Ascending,
+	}
+}
+
+// Query texts available to the service.
+func (s *app) Query(ctx context.Context, q store.Query) ([]*text.Text, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return s.provider.List(ctx, q)
+}
+
+// Search texts available to the service.
+func (s *app) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must be nonnegative")
+	}
+	return s.provider.Search(ctx, query, limit)
+}
+
+// Compact the underlying store.
+func (s *app) Compact(ctx context.Context) error {
+	compacter, ok := s.provider.(store.Compacter)
+	if !ok {
+		return fmt.Errorf("%T doesn't support compaction", s.provider)
+	}
+	return compacter.Compact(ctx)
+}
+
+// Rekey the underlying store.
+func (s *app) Rekey(ctx context.Context, key store.Key) error {
+	rekeyer, ok := s.provider.(store.Rekeyer)
+	if !ok {
+		return fmt.Errorf("%T isn't encrypted", s.provider)
+	}
+	return rekeyer.Rekey(ctx, key)
+}
+
+// History of the text with id in the underlying store.
+func (s *app) History(ctx context.Context, id string) ([]store.Revision, error) {
+	historian, ok := s.provider.(store.Historian)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't record history", s.provider)
+	}
+	return historian.History(ctx, id)
+}
+
+// Outbox of the underlying store.
+func (s *app) Outbox() (store.Outbox, error) {
+	outbox, ok := s.provider.(store.Outbox)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't queue changes; configure a cache", s.provider)
+	}
+	return outbox, nil
+}
+
+// Migrator of the underlying store.
+func (s *app) Migrator() (store.Migrator, error) {
+	migrator, ok := s.provider.(store.Migrator)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't have schema migrations", s.provider)
+	}
+	return migrator, nil
+}
+
+// Sync the underlying store with other.
+func (s *app) Sync(ctx context.Context, other store.Interface, checkpoint *store.Checkpoint, opts store.SyncOptions) ([]store.SyncChange, error) {
+	return store.Sync(ctx, s.provider, other, checkpoint, opts)
+}
+
+// Copy the underlying store's texts to another store.
+func (s *app) Copy(ctx context.Context, to store.Interface, opts store.CopyOptions) (*store.CopyResult, error) {
+	return store.Copy(ctx, s.provider, to, opts)
 }
 
-// List all texts available to the service.
-func (s *app) List() ([]*text.Text, error) {
-	return s.provider.List(text.Timestamps, text.Descending)
+// Verify the underlying store's texts are in another store.
+func (s *app) Verify(ctx context.Context, to store.Interface, copied *store.CopyResult) ([]store.Mismatch, error) {
+	return store.Verify(ctx, s.provider, to, copied)
 }
 
 // Close the underlying Store.
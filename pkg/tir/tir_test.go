@@ -1,6 +1,8 @@
 package tir
 
 import (
+	"context"
+	"errors"
 	"io"
 	"testing"
 
@@ -16,7 +18,7 @@ func TestService(t *testing.T) {
 
 	original := &text.Text{Author: "a", Note: "n", URL: "u", Title: "t"}
 
-	created, err := s.Create(original)
+	created, err := s.Create(t.Context(), original)
 	assert.NoError(t, err)
 	assert.Equal(t, created.Author, original.Author)
 	assert.Equal(t, created.Note, original.Note)
@@ -24,29 +26,139 @@ func TestService(t *testing.T) {
 	assert.NotEmpty(t, created.ID, "should create ID before creating text")
 
 	// No-op update.
-	updated, err := s.Update(created.ID, &text.Text{})
+	updated, err := s.Update(t.Context(), created.ID, &text.Text{})
 	assert.NoError(t, err)
 	assert.Equal(t, created, updated)
 
-	updated, err = s.Update(created.ID, &text.Text{Author: "New Author"})
+	updated, err = s.Update(t.Context(), created.ID, &text.Text{Author: "New Author"})
 	assert.NoError(t, err)
 	assert.Equal(t, "New Author", updated.Author)
-	reRead, err := s.Read(created.ID)
+	reRead, err := s.Read(t.Context(), created.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, "New Author", reRead.Author)
 
-	deleted, err := s.Delete(created.ID)
+	deleted, err := s.Delete(t.Context(), created.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, deleted, reRead)
 
-	_, err = s.Read(created.ID)
+	_, err = s.Read(t.Context(), created.ID)
 	assert.Error(t, err)
 }
 
 func TestValidation(t *testing.T) {
 	s := New(store.UseMemory())
 
-	created, err := s.Create(&text.Text{})
+	created, err := s.Create(t.Context(), &text.Text{})
 	assert.Error(t, err)
 	assert.Nil(t, created)
 }
+
+func TestQueue(t *testing.T) {
+	s := New(store.UseMemory())
+
+	read, err := s.Create(t.Context(), &text.Text{Author: "a", Note: "n", URL: "u", Title: "read"})
+	assert.NoError(t, err)
+	queued, err := s.Create(t.Context(), &text.Text{Author: "a", URL: "u", Title: "queued", Status: text.StatusQueued})
+	assert.NoError(t, err, "queued texts don't need notes")
+
+	listed, err := s.List(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []*text.Text{read}, listed, "List only includes read texts")
+
+	inQueue, err := s.Queue(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, []*text.Text{queued}, inQueue)
+
+	all, err := s.Query(t.Context(), store.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	_, err = s.Finish(t.Context(), queued.ID, &text.Text{})
+	assert.Error(t, err, "finished texts need notes")
+
+	queuedAt := queued.Timestamp
+	finished, err := s.Finish(t.Context(), queued.ID, &text.Text{Note: "finally"})
+	assert.NoError(t, err)
+	assert.Equal(t, text.StatusRead, finished.Status)
+	assert.Equal(t, "finally", finished.Note)
+	assert.True(t, finished.Timestamp.After(queuedAt), "finishing sets the read timestamp")
+
+	inQueue, err = s.Queue(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, inQueue)
+	listed, err = s.List(t.Context())
+	assert.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	unread, err := s.Create(t.Context(), &text.Text{Author: "a", URL: "u", Title: "unread", Status: text.StatusQueued})
+	assert.NoError(t, err)
+	abandoned, err := s.Update(t.Context(), unread.ID, &text.Text{Status: text.StatusAbandoned})
+	assert.NoError(t, err, "abandoned texts don't need notes")
+	assert.Equal(t, text.StatusAbandoned, abandoned.Status)
+}
+
+func TestErrors(t *testing.T) {
+	s := New(store.UseMemory())
+
+	_, err := s.Update(t.Context(), "missing0", &text.Text{Note: "n"})
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	created, err := s.Create(t.Context(), &text.Text{Author: "a", Note: "n", URL: "u", Title: "t"})
+	assert.NoError(t, err)
+	_, err = s.Update(t.Context(), created.ID, &text.Text{Status: "skimmed"})
+	var validationErr *text.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "status", validationErr.Field)
+
+	read, err := s.Read(t.Context(), created.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, read.Status, "invalid updates aren't written")
+}
+
+func TestCompactUnsupported(t *testing.T) {
+	s := New(store.UseMemory())
+	assert.ErrorContains(t, s.Compact(t.Context()), "doesn't support compaction")
+}
+
+func TestHistoryUnsupported(t *testing.T) {
+	s := New(store.UseMemory())
+	_, err := s.History(t.Context(), "aaaaaaaa")
+	assert.ErrorContains(t, err, "doesn't record history")
+}
+
+func TestRekeyUnsupported(t *testing.T) {
+	s := New(store.UseMemory())
+	assert.ErrorContains(t, s.Rekey(t.Context(), store.Passphrase("p")), "isn't encrypted")
+}
+
+// listOnly is a store whose Read fails, so CreateMany must check IDs with List.
+type listOnly struct {
+	store.Interface
+}
+
+func (listOnly) Read(ctx context.Context, id string) (*text.Text, error) {
+	return nil, errors.New("Read called")
+}
+
+func TestCreateMany(t *testing.T) {
+	s := New(listOnly{store.UseMemory()})
+
+	_, err := s.CreateMany(t.Context(), []*text.Text{
+		{Author: "a", Note: "n", URL: "u", Title: "valid"},
+		{Author: "a", Note: "n", URL: "u"},
+	})
+	var validationErr *text.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	texts, err := s.Query(t.Context(), store.Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, texts, "should validate every text before creating any")
+
+	created, err := s.CreateMany(t.Context(), []*text.Text{
+		{Author: "a", Note: "n", URL: "u", Title: "first"},
+		{Author: "a", Note: "n", URL: "u", Title: "second"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, created, 2)
+	assert.NotEqual(t, created[0].ID, created[1].ID)
+	assert.False(t, created[0].Timestamp.IsZero())
+}